@@ -2,15 +2,15 @@ package config
 
 import (
 	_ "embed"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
-	yaml "gopkg.in/yaml.v3"
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
 )
 
 //go:embed default_config.yaml
@@ -22,14 +22,39 @@ type Config struct {
 	Modules   map[string]ModuleConfig `yaml:"modules" json:"modules"`
 	Workspace WorkspaceConfig         `yaml:"workspace" json:"workspace"`
 	Prompts   PromptConfig            `yaml:"prompts" json:"prompts"`
+	Git       GitConfig               `yaml:"git" json:"git"`
+
+	// tree, origins and sources describe the layers the config was merged
+	// from; see LoadLayers.
+	tree    map[string]any
+	origins map[string]string
+	sources []Source
+	// profile is the active profile and profileOrigin what selected it.
+	profile, profileOrigin string
 }
 
 // RepoConfig describes starter repository inputs.
 type RepoConfig struct {
-	URL        string `yaml:"url" json:"url"`
-	Branch     string `yaml:"branch" json:"branch"`
+	URL    string `yaml:"url" json:"url"`
+	Branch string `yaml:"branch" json:"branch"`
+	// Ref pins the starter to a tag or commit SHA and takes precedence over Branch.
+	Ref        string `yaml:"ref" json:"ref"`
 	Protocol   string `yaml:"protocol" json:"protocol"`
 	AuthPrompt bool   `yaml:"authPrompt" json:"authPrompt"`
+	// CredentialStore makes authPrompt consult the system git credential store
+	// before prompting and save credentials that work.
+	CredentialStore bool `yaml:"credentialStore" json:"credentialStore"`
+}
+
+// ResolveRef returns the ref to check out: the override when set, then Ref, then Branch.
+func (r RepoConfig) ResolveRef(override string) string {
+	if strings.TrimSpace(override) != "" {
+		return strings.TrimSpace(override)
+	}
+	if strings.TrimSpace(r.Ref) != "" {
+		return strings.TrimSpace(r.Ref)
+	}
+	return r.Branch
 }
 
 // ModuleConfig provides documentation scaffolding per module.
@@ -41,50 +66,89 @@ type ModuleConfig struct {
 // WorkspaceConfig holds directories and defaults.
 type WorkspaceConfig struct {
 	DefaultRoot string `yaml:"defaultRoot" json:"defaultRoot"`
+	// LayersMode selects how init keeps the base layers linked to upstream:
+	// snapshot (default), remote or subtree.
+	LayersMode string `yaml:"layersMode" json:"layersMode"`
+	// GitMode is per-project (default: every app and /layers get their own
+	// repository) or monorepo (one repository at the workspace root).
+	GitMode string `yaml:"gitMode" json:"gitMode"`
+	// PackageWorkspaces (bun, npm or pnpm) makes init write a root package
+	// workspace over apps/* and layers/*; empty keeps apps linking layers by path.
+	PackageWorkspaces string `yaml:"packageWorkspaces" json:"packageWorkspaces"`
 }
 
-// PromptConfig defines interactive defaults.
-type PromptConfig struct {
-	DefaultLayerSelection []string `yaml:"defaultLayerSelection" json:"defaultLayerSelection"`
+// LayersModes lists the supported workspace.layersMode values.
+var LayersModes = []string{"snapshot", "remote", "subtree"}
+
+// GitModes lists the supported workspace.gitMode values.
+var GitModes = []string{"per-project", "monorepo"}
+
+// PackageManagers lists the supported workspace.packageWorkspaces values.
+var PackageManagers = []string{"bun", "npm", "pnpm"}
+
+// GitConfig holds settings shared by every repository.
+type GitConfig struct {
+	// Hosts overrides protocol and SSH details per host name, e.g. "github.com".
+	Hosts map[string]GitHostConfig `yaml:"hosts" json:"hosts"`
+	// Scaffold configures the git repositories created for new apps and layers.
+	Scaffold GitScaffoldConfig `yaml:"scaffold" json:"scaffold"`
 }
 
-// Load attempts to read config files from disk, defaulting to ~/.couchfusion/config.yaml.
-// It returns a boolean indicating whether the embedded default configuration was used.
-func Load(path string) (*Config, bool, error) {
-	resolved, err := resolvePath(path)
-	if err != nil {
-		return nil, false, err
-	}
+// GitScaffoldConfig controls the fresh git repository that replaces a starter's
+// history in scaffolded apps, created layers and snapshot /layers.
+type GitScaffoldConfig struct {
+	// InitialCommit commits the scaffolded files once they are written.
+	InitialCommit bool   `yaml:"initialCommit" json:"initialCommit"`
+	CommitMessage string `yaml:"commitMessage" json:"commitMessage"`
+	// AuthorName and AuthorEmail default to the user's git identity.
+	AuthorName  string `yaml:"authorName" json:"authorName"`
+	AuthorEmail string `yaml:"authorEmail" json:"authorEmail"`
+	// DefaultBranch names the initial branch; empty keeps git's init.defaultBranch.
+	DefaultBranch string `yaml:"defaultBranch" json:"defaultBranch"`
+	// Remote is added as origin with {{app}} replaced by the project name,
+	// e.g. git@github.com:our-org/{{app}}.git.
+	Remote string `yaml:"remote" json:"remote"`
+}
 
-	useFallback := false
-	data, err := os.ReadFile(resolved)
-	if err != nil {
-		if errors.Is(err, fs.ErrNotExist) && strings.TrimSpace(path) == "" {
-			if len(embeddedDefaultConfig) == 0 {
-				return nil, false, errors.New("embedded default configuration is empty")
-			}
-			data = embeddedDefaultConfig
-			useFallback = true
-		} else {
-			return nil, false, err
-		}
-	}
+// DefaultScaffoldCommitMessage is used when git.scaffold.commitMessage is empty.
+const DefaultScaffoldCommitMessage = "Initial commit from couchfusion"
 
-	cfg := &Config{}
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		// Attempt JSON as fallback
-		if jsonErr := json.Unmarshal(data, cfg); jsonErr != nil {
-			return nil, false, fmt.Errorf("failed to parse config as YAML (%v) or JSON (%v)", err, jsonErr)
-		}
+// ResolveCommitMessage returns the configured initial commit message or the default.
+func (g GitScaffoldConfig) ResolveCommitMessage() string {
+	if strings.TrimSpace(g.CommitMessage) == "" {
+		return DefaultScaffoldCommitMessage
 	}
+	return g.CommitMessage
+}
 
-	cfg.normalizeRepoKeys()
+// RemoteURL expands the remote template for project name, or returns an empty
+// string when no remote is configured.
+func (g GitScaffoldConfig) RemoteURL(name string) string {
+	return strings.ReplaceAll(strings.TrimSpace(g.Remote), "{{app}}", name)
+}
 
-	if err := cfg.validate(); err != nil {
-		return nil, false, err
-	}
+// GitHostConfig overrides how repositories on one host are reached.
+type GitHostConfig struct {
+	// Protocol (ssh or https) takes precedence over the repo's own protocol.
+	Protocol string `yaml:"protocol" json:"protocol"`
+	// SSHUser, SSHHost and SSHPort customize rewritten SSH URLs, e.g. GitHub's
+	// ssh.github.com on port 443.
+	SSHUser string `yaml:"sshUser" json:"sshUser"`
+	SSHHost string `yaml:"sshHost" json:"sshHost"`
+	SSHPort int    `yaml:"sshPort" json:"sshPort"`
+}
+
+// PromptConfig defines interactive defaults.
+type PromptConfig struct {
+	DefaultLayerSelection []string `yaml:"defaultLayerSelection" json:"defaultLayerSelection"`
+}
 
-	return cfg, useFallback, nil
+// Load merges the configuration layers with path replacing the user file
+// ~/.couchfusion/config.yaml when set; see LoadLayers. It returns a boolean
+// indicating whether no config file was found and the embedded default
+// configuration was used.
+func Load(path string) (*Config, bool, error) {
+	return LoadLayers(Options{Path: path})
 }
 
 func resolvePath(input string) (string, error) {
@@ -110,39 +174,227 @@ func expandHome(path string) (string, error) {
 	return path, nil
 }
 
-func (c *Config) validate() error {
+// validate lists every rule the configuration breaks, with the dotted key each
+// one concerns.
+func (c *Config) validate() []Problem {
+	var problems []Problem
+	add := func(key, format string, args ...any) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
 	if len(c.Repos) == 0 {
-		return errors.New("config missing repos definitions")
+		add("repos", "config missing repos definitions")
 	}
 
 	required := []string{"init", "new", "create_layer"}
 	for _, key := range required {
 		repo, ok := c.Repos[key]
 		if !ok {
-			return fmt.Errorf("config missing repo configuration for '%s'", key)
+			if len(c.Repos) > 0 {
+				add("repos", "config missing repo configuration for '%s'", key)
+			}
+			continue
 		}
 		if strings.TrimSpace(repo.URL) == "" {
-			return fmt.Errorf("repo '%s' missing url", key)
+			add("repos."+key+".url", "repo '%s' missing url", key)
+		}
+		if strings.TrimSpace(repo.Branch) == "" && strings.TrimSpace(repo.Ref) == "" {
+			add("repos."+key+".branch", "repo '%s' missing branch or ref", key)
 		}
-		if strings.TrimSpace(repo.Branch) == "" {
-			return fmt.Errorf("repo '%s' missing branch", key)
+	}
+	for _, key := range sortedKeys(c.Repos) {
+		repo := c.Repos[key]
+		if protocol := repo.Protocol; protocol != "" && protocol != "ssh" && protocol != "https" {
+			add("repos."+key+".protocol", "repo '%s' protocol must be ssh or https", key)
 		}
-		if repo.Protocol != "" && repo.Protocol != "ssh" && repo.Protocol != "https" {
-			return fmt.Errorf("repo '%s' protocol must be ssh or https", key)
+		if err := checkRepoURL(repo.URL); err != nil {
+			add("repos."+key+".url", "repo '%s' url %v", key, err)
 		}
 	}
 
+	extendedBy := map[string]string{}
+	for _, name := range sortedKeys(c.Modules) {
+		if !moduleNamePattern.MatchString(name) {
+			add("modules."+name, "module name '%s' must be lowercase letters, digits and dashes", name)
+		}
+		extends := c.ResolveExtends(name)
+		if other, ok := extendedBy[extends]; ok {
+			add("modules."+name+".extends", "modules '%s' and '%s' both extend %s", other, name, extends)
+			continue
+		}
+		extendedBy[extends] = name
+	}
+	for _, name := range c.Prompts.DefaultLayerSelection {
+		if _, ok := c.Modules[name]; !ok {
+			add("prompts.defaultLayerSelection", "prompts.defaultLayerSelection lists unknown module '%s'%s", name, suggest(name, sortedKeys(c.Modules)))
+		}
+	}
+
+	for _, host := range sortedKeys(c.Git.Hosts) {
+		override := c.Git.Hosts[host]
+		if override.Protocol != "" && override.Protocol != "ssh" && override.Protocol != "https" {
+			add("git.hosts."+host+".protocol", "git.hosts.%s protocol must be ssh or https", host)
+		}
+		if override.SSHPort < 0 || override.SSHPort > 65535 {
+			add("git.hosts."+host+".sshPort", "git.hosts.%s sshPort must be between 1 and 65535", host)
+		}
+	}
+
+	if remote := c.Git.Scaffold.RemoteURL("app"); remote != "" {
+		if err := checkRepoURL(remote); err != nil {
+			add("git.scaffold.remote", "git.scaffold.remote %v", err)
+		}
+	}
+
+	if (c.Git.Scaffold.AuthorName == "") != (c.Git.Scaffold.AuthorEmail == "") {
+		add("git.scaffold", "git.scaffold authorName and authorEmail must be set together")
+	}
+
+	if mode := c.Workspace.LayersMode; mode != "" && !isLayersMode(mode) {
+		add("workspace.layersMode", "workspace.layersMode must be one of %s", strings.Join(LayersModes, ", "))
+	}
+
+	if mode := c.Workspace.GitMode; mode != "" && !contains(GitModes, mode) {
+		add("workspace.gitMode", "workspace.gitMode must be one of %s", strings.Join(GitModes, ", "))
+	}
+
+	if manager := c.Workspace.PackageWorkspaces; manager != "" && !contains(PackageManagers, manager) {
+		add("workspace.packageWorkspaces", "workspace.packageWorkspaces must be one of %s", strings.Join(PackageManagers, ", "))
+	}
+
+	return problems
+}
+
+// moduleNamePattern matches module names, which name layer directories.
+var moduleNamePattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// checkRepoURL rejects repository URLs git cannot use: unknown schemes,
+// missing hosts and whitespace. scp-like remotes and local paths pass.
+func checkRepoURL(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if strings.ContainsAny(raw, " \t\n") {
+		return fmt.Errorf("%q contains whitespace", raw)
+	}
+	if !strings.Contains(raw, "://") {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid URL", raw)
+	}
+	switch u.Scheme {
+	case "file":
+		return nil
+	case "https", "http", "ssh", "git+ssh", "ssh+git", "git":
+	default:
+		return fmt.Errorf("%q uses unsupported scheme %s (expected https, ssh, git or file)", raw, u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", raw)
+	}
 	return nil
 }
 
-func (c *Config) normalizeRepoKeys() {
-	if _, ok := c.Repos["new"]; ok {
-		return
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	if legacy, ok := c.Repos["create_app"]; ok {
-		c.Repos["new"] = legacy
+func isLayersMode(mode string) bool {
+	return contains(LayersModes, mode)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveLayersMode returns the override when set, then workspace.layersMode,
+// defaulting to snapshot. It reports an error for unknown modes.
+func (c *Config) ResolveLayersMode(override string) (string, error) {
+	mode := strings.TrimSpace(override)
+	if mode == "" {
+		mode = c.Workspace.LayersMode
+	}
+	if mode == "" {
+		return "snapshot", nil
+	}
+	if !isLayersMode(mode) {
+		return "", fmt.Errorf("unknown layers mode '%s' (expected %s)", mode, strings.Join(LayersModes, ", "))
+	}
+	return mode, nil
+}
+
+// ResolveGitMode returns the override when set, then workspace.gitMode,
+// defaulting to per-project. It reports an error for unknown modes.
+func (c *Config) ResolveGitMode(override string) (string, error) {
+	mode := strings.TrimSpace(override)
+	if mode == "" {
+		mode = c.Workspace.GitMode
+	}
+	if mode == "" {
+		return "per-project", nil
+	}
+	if !contains(GitModes, mode) {
+		return "", fmt.Errorf("unknown git mode '%s' (expected %s)", mode, strings.Join(GitModes, ", "))
+	}
+	return mode, nil
+}
+
+// ResolvePackageWorkspaces returns the override when set, then
+// workspace.packageWorkspaces. "none" disables workspaces; the empty result means
+// disabled.
+func (c *Config) ResolvePackageWorkspaces(override string) (string, error) {
+	manager := strings.TrimSpace(override)
+	if manager == "" {
+		manager = c.Workspace.PackageWorkspaces
+	}
+	if manager == "" || manager == "none" {
+		return "", nil
+	}
+	if !contains(PackageManagers, manager) {
+		return "", fmt.Errorf("unknown package manager '%s' (expected %s or none)", manager, strings.Join(PackageManagers, ", "))
+	}
+	return manager, nil
+}
+
+// rewriteRepoURLs converts every repo URL to the SSH or HTTPS form selected by
+// its host override or its own protocol, and records the effective protocol.
+func (c *Config) rewriteRepoURLs() {
+	for key, repo := range c.Repos {
+		c.Repos[key] = c.ResolveRepo(repo)
+	}
+}
+
+// ResolveRepo applies git.hosts overrides and protocol rewriting to repo. It is
+// also used for repositories that do not come from the repos section. Without
+// a protocol the URL is kept and its own protocol is recorded, so authPrompt
+// works for https URLs.
+func (c *Config) ResolveRepo(repo RepoConfig) RepoConfig {
+	protocol := repo.Protocol
+	override, ok := c.Git.Hosts[gitutil.URLHost(repo.URL)]
+	if ok && override.Protocol != "" {
+		protocol = override.Protocol
+	}
+	if protocol == "" {
+		repo.Protocol = gitutil.URLProtocol(repo.URL)
+		return repo
 	}
+	repo.URL = gitutil.RewriteURL(repo.URL, protocol, gitutil.SSHOptions{
+		User: override.SSHUser,
+		Host: override.SSHHost,
+		Port: override.SSHPort,
+	})
+	repo.Protocol = protocol
+	return repo
 }
 
 // ResolveExtends returns the extends string for a module, defaulting to @layers/<name>.
@@ -0,0 +1,29 @@
+package config
+
+import "testing"
+
+func TestResolveRepo(t *testing.T) {
+	cfg := &Config{Git: GitConfig{Hosts: map[string]GitHostConfig{
+		"gitlab.com": {Protocol: "ssh"},
+	}}}
+	tests := []struct {
+		name         string
+		repo         RepoConfig
+		wantURL      string
+		wantProtocol string
+	}{
+		{"https url without protocol", RepoConfig{URL: "https://github.com/org/repo.git"}, "https://github.com/org/repo.git", "https"},
+		{"ssh url without protocol", RepoConfig{URL: "git@github.com:org/repo.git"}, "git@github.com:org/repo.git", "ssh"},
+		{"local path", RepoConfig{URL: "/srv/starters/app"}, "/srv/starters/app", ""},
+		{"repo protocol", RepoConfig{URL: "git@github.com:org/repo.git", Protocol: "https"}, "https://github.com/org/repo.git", "https"},
+		{"host override", RepoConfig{URL: "https://gitlab.com/org/repo.git", Protocol: "https"}, "git@gitlab.com:org/repo.git", "ssh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cfg.ResolveRepo(tt.repo)
+			if got.URL != tt.wantURL || got.Protocol != tt.wantProtocol {
+				t.Errorf("ResolveRepo() = %q (%q), want %q (%q)", got.URL, got.Protocol, tt.wantURL, tt.wantProtocol)
+			}
+		})
+	}
+}
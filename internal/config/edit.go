@@ -0,0 +1,342 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InitFile writes the embedded default configuration, comments included, to
+// path or the user file ~/.couchfusion/config.yaml when path is empty. An
+// existing file is only replaced with force. It returns the path written.
+func InitFile(path string, force bool) (string, error) {
+	target, err := resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(target); err == nil && !force {
+		return "", fmt.Errorf("%s already exists; use --force to replace it", target)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	return target, os.WriteFile(target, embeddedDefaultConfig, 0o644)
+}
+
+// Get returns the value at the dotted key: leaf values on one line, sections
+// as YAML.
+func (c *Config) Get(key string) (string, error) {
+	path, _, err := resolveKey(c.tree, key, true)
+	if err != nil {
+		return "", err
+	}
+	value := c.lookup(strings.Join(path, "."))
+	if value == nil {
+		return "", fmt.Errorf("%s is not set", strings.Join(path, "."))
+	}
+	if section, ok := value.(map[string]any); ok {
+		data, err := yaml.Marshal(section)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(string(data), "\n"), nil
+	}
+	return formatValue(value), nil
+}
+
+// Edit changes one configuration file in place, keeping its comments and
+// layout. Edits are validated with every layer and refused when they add a
+// problem.
+type Edit struct {
+	Options
+	// Workspace edits the nearest .couchfusion.yaml, created in Dir when there
+	// is none, instead of the user file.
+	Workspace bool
+	// DryRun validates the edit without writing it.
+	DryRun bool
+}
+
+// Set assigns value, converted to the type of the field, to the dotted key.
+// It returns the path of the edited file.
+func (e Edit) Set(key, value string) (string, error) {
+	layers, err := loadLayers(e.Options)
+	if err != nil {
+		return "", err
+	}
+	path, typ, err := resolveKey(layers.tree, key, false)
+	if err != nil {
+		return "", err
+	}
+	converted, err := convertValue(typ, value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.Join(path, "."), err)
+	}
+	return e.apply(func(root *yaml.Node) error {
+		return setNode(root, path, converted)
+	})
+}
+
+// AddModule defines a module that is not configured yet. It returns the path
+// of the edited file.
+func (e Edit) AddModule(name string, module ModuleConfig) (string, error) {
+	layers, err := loadLayers(e.Options)
+	if err != nil {
+		return "", err
+	}
+	if origin := layers.moduleOrigin(name); origin != "" {
+		return "", fmt.Errorf("module '%s' is already configured by %s", name, origin)
+	}
+	return e.apply(func(root *yaml.Node) error {
+		entry := map[string]any{"description": module.Description, "extends": module.Extends}
+		return setNode(root, []string{"modules", name}, entry)
+	})
+}
+
+// RemoveModule deletes a module from the edited file, and sets it to null
+// there when a lower layer still defines it. A module in
+// prompts.defaultLayerSelection is dropped from the list too. It returns the
+// path of the edited file.
+func (e Edit) RemoveModule(name string) (string, error) {
+	layers, err := loadLayers(e.Options)
+	if err != nil {
+		return "", err
+	}
+	if layers.moduleOrigin(name) == "" {
+		return "", fmt.Errorf("module '%s' is not configured", name)
+	}
+
+	target, err := e.target()
+	if err != nil {
+		return "", err
+	}
+	below := e.Options
+	below.contents = map[string][]byte{target: nil}
+	if e.Workspace {
+		below.workspaceFile = target
+	}
+	lower, err := loadLayers(below)
+	if err != nil {
+		return "", err
+	}
+	shadow := lower.moduleOrigin(name) != ""
+
+	// Drop the module from the default selection, which may only list
+	// configured modules.
+	var selection []any
+	selected := false
+	prompts, _ := layers.tree["prompts"].(map[string]any)
+	current, _ := prompts["defaultLayerSelection"].([]any)
+	for _, item := range current {
+		if item == name {
+			selected = true
+			continue
+		}
+		selection = append(selection, item)
+	}
+
+	return e.apply(func(root *yaml.Node) error {
+		if selected {
+			if err := setNode(root, []string{"prompts", "defaultLayerSelection"}, append([]any{}, selection...)); err != nil {
+				return err
+			}
+		}
+		if shadow {
+			return setNode(root, []string{"modules", name}, nil)
+		}
+		if modules := mappingValue(root, "modules"); modules != nil {
+			deleteEntry(modules, name)
+		}
+		return nil
+	})
+}
+
+// moduleOrigin returns the origin of the first value of module name, or the
+// empty string when no layer defines it.
+func (l *layeredConfig) moduleOrigin(name string) string {
+	modules, _ := l.tree["modules"].(map[string]any)
+	if _, ok := modules[name]; !ok {
+		return ""
+	}
+	prefix := "modules." + name
+	for _, key := range sortedKeys(l.origins) {
+		if key == prefix || strings.HasPrefix(key, prefix+".") {
+			return l.origins[key]
+		}
+	}
+	return "an unknown source"
+}
+
+// target returns the path of the file the edit changes.
+func (e Edit) target() (string, error) {
+	if !e.Workspace {
+		return resolvePath(e.Path)
+	}
+	path, ok, err := findWorkspaceFile(e.Dir)
+	if err != nil || ok {
+		return path, err
+	}
+	dir := e.Dir
+	if strings.TrimSpace(dir) == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return "", fmt.Errorf("unable to determine working directory: %w", err)
+		}
+	}
+	return filepath.Join(dir, WorkspaceFileName), nil
+}
+
+// apply runs edit on the root mapping of the target file, validates the
+// result and writes it unless DryRun is set.
+func (e Edit) apply(edit func(root *yaml.Node) error) (string, error) {
+	target, err := e.target()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(target)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("%s: %w", target, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("%s: the document is not a mapping", target)
+	}
+	if err := edit(root); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	edited := spaceSections(buf.Bytes())
+
+	before, err := Validate(e.withFile(target, data))
+	if err != nil {
+		return "", err
+	}
+	after, err := Validate(e.withFile(target, edited))
+	if err != nil {
+		return "", err
+	}
+	if added := newProblems(before, after); len(added) > 0 {
+		lines := make([]string, 0, len(added))
+		for _, problem := range added {
+			lines = append(lines, problem.String())
+		}
+		return "", fmt.Errorf("the change would make the configuration invalid:\n  %s", strings.Join(lines, "\n  "))
+	}
+
+	if e.DryRun {
+		return target, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	return target, os.WriteFile(target, edited, 0o644)
+}
+
+// spaceSections puts back the blank line before each top-level section that
+// the YAML encoder drops.
+func spaceSections(data []byte) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	var out strings.Builder
+	for i, line := range lines {
+		if i > 0 && line != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") {
+			if prev := lines[i-1]; strings.HasPrefix(prev, " ") || strings.HasPrefix(prev, "-") {
+				out.WriteString("\n")
+			}
+		}
+		out.WriteString(line)
+	}
+	return []byte(out.String())
+}
+
+// withFile returns the options of the edit with data as the content of the
+// target file.
+func (e Edit) withFile(target string, data []byte) Options {
+	opts := e.Options
+	opts.contents = map[string][]byte{target: data}
+	if e.Workspace {
+		opts.workspaceFile = target
+	}
+	return opts
+}
+
+// newProblems returns the problems of after whose message is not among
+// before; line numbers move with the edit, messages do not.
+func newProblems(before, after []Problem) []Problem {
+	seen := map[string]bool{}
+	for _, problem := range before {
+		seen[problem.Message] = true
+	}
+	var added []Problem
+	for _, problem := range after {
+		if !seen[problem.Message] {
+			added = append(added, problem)
+		}
+	}
+	return added
+}
+
+// setNode sets the value at path below mapping node m, creating sections as
+// needed. An existing value keeps its comments.
+func setNode(m *yaml.Node, path []string, value any) error {
+	for _, segment := range path[:len(path)-1] {
+		next := mappingValue(m, segment)
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: segment}, next)
+		} else if next.Kind != yaml.MappingNode {
+			*next = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", HeadComment: next.HeadComment, LineComment: next.LineComment}
+		}
+		m = next
+	}
+
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+	if existing := mappingValue(m, last); existing != nil {
+		node.HeadComment, node.LineComment, node.FootComment = existing.HeadComment, existing.LineComment, existing.FootComment
+		*existing = node
+		return nil
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last}, &node)
+	return nil
+}
+
+// mappingValue returns the value node of key in mapping node m.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	_, value := mappingEntry(m, key)
+	return value
+}
+
+// deleteEntry removes key and its value from mapping node m.
+func deleteEntry(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
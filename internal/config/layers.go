@@ -0,0 +1,759 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// WorkspaceFileName is the checked-in config file of a workspace, looked up in
+// the current directory and its parents.
+const WorkspaceFileName = ".couchfusion.yaml"
+
+// EnvPrefix starts the environment variables that set config values, e.g.
+// COUCHFUSION_REPOS__NEW__BRANCH=dev for repos.new.branch. Segments are
+// separated by a double underscore and matched case-insensitively.
+const EnvPrefix = "COUCHFUSION_"
+
+// Source kinds in precedence order; later sources override earlier ones.
+const (
+	SourceDefault   = "default"
+	SourceUser      = "user"
+	SourceProfile   = "profile"
+	SourceWorkspace = "workspace"
+	SourceEnv       = "env"
+	SourceFlag      = "flag"
+)
+
+// Source is one configuration layer that contributed to a Config.
+type Source struct {
+	Kind string
+	// Path is the file of user, profile and workspace sources.
+	Path string
+	// Name is the name of a profile source.
+	Name string
+}
+
+func (s Source) String() string {
+	kind := s.Kind
+	if s.Name != "" {
+		kind += " " + s.Name
+	}
+	if s.Path == "" {
+		return kind
+	}
+	return fmt.Sprintf("%s (%s)", kind, s.Path)
+}
+
+// Options selects the layers LoadLayers merges.
+type Options struct {
+	// Path replaces the user file ~/.couchfusion/config.yaml; it must exist.
+	Path string
+	// Dir is where the search for WorkspaceFileName starts; the current
+	// directory when empty.
+	Dir string
+	// Overrides are key=value pairs from the command line (--set), applied
+	// last.
+	Overrides []string
+	// Profile selects a named profile (--profile). When empty,
+	// COUCHFUSION_PROFILE and then RecordedProfile apply.
+	Profile string
+	// RecordedProfile is the profile recorded by the current workspace, in
+	// the file RecordedIn.
+	RecordedProfile, RecordedIn string
+
+	// workspaceFile replaces the search for WorkspaceFileName and contents
+	// replaces the content of files by path; both let edits be validated
+	// before they are written.
+	workspaceFile string
+	contents      map[string][]byte
+}
+
+// Problem is a configuration error, located in the file that set the value
+// concerned when possible.
+type Problem struct {
+	// Source is the file, or the origin of the value such as an environment
+	// variable; empty when no source set it.
+	Source       string
+	Line, Column int
+	Key          string
+	Message      string
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.Source == "":
+		return p.Message
+	case p.Line > 0 && p.Column > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", p.Source, p.Line, p.Column, p.Message)
+	case p.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", p.Source, p.Line, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.Source, p.Message)
+}
+
+// layeredConfig is the deep merge of every source, keeping which source set
+// each leaf value (a scalar or a list).
+type layeredConfig struct {
+	tree    map[string]any
+	origins map[string]string
+	sources []Source
+	// files holds the content of file sources by Source.String, to locate
+	// problems.
+	files map[string][]byte
+	// prefixes holds the key path of sources that are a section of their
+	// file, like a profile defined in the user file.
+	prefixes map[string]string
+	problems []Problem
+
+	// profiles are the profiles defined in the user file; profile is the
+	// active one and profileOrigin what selected it.
+	profiles               map[string]any
+	profile, profileOrigin string
+}
+
+// LoadLayers merges the embedded default, the user file, the workspace file,
+// COUCHFUSION_* environment variables and command line overrides, in that
+// order. Maps are merged key by key; scalars and lists are replaced, and a
+// null value removes the key from the lower layers. The boolean reports
+// whether no config file was found, so only the embedded default and
+// overrides apply.
+func LoadLayers(opts Options) (*Config, bool, error) {
+	layers, err := loadLayers(opts)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(layers.problems) > 0 {
+		return nil, false, errors.New(layers.problems[0].String())
+	}
+
+	cfg, err := layers.decode()
+	if err != nil {
+		return nil, false, err
+	}
+	if problems := cfg.validate(); len(problems) > 0 {
+		return nil, false, errors.New(layers.locate(problems[0]).String())
+	}
+	cfg.rewriteRepoURLs()
+
+	usedDefault := true
+	for _, source := range layers.sources {
+		if source.Kind == SourceUser || source.Kind == SourceProfile || source.Kind == SourceWorkspace {
+			usedDefault = false
+		}
+	}
+	return cfg, usedDefault, nil
+}
+
+// Validate loads every layer like LoadLayers and returns all problems found
+// instead of stopping at the first one. The error is set only when a file
+// cannot be read.
+func Validate(opts Options) ([]Problem, error) {
+	layers, err := loadLayers(opts)
+	if err != nil {
+		return nil, err
+	}
+	problems := layers.problems
+	cfg, err := layers.decode()
+	var typeErr *yaml.TypeError
+	if err != nil && (!errors.As(err, &typeErr) || len(problems) == 0) {
+		return append(problems, Problem{Message: err.Error()}), nil
+	}
+	// Type errors were reported per file; the values that did decode are
+	// still validated.
+	for _, problem := range cfg.validate() {
+		problems = append(problems, layers.locate(problem))
+	}
+	return problems, nil
+}
+
+// decode turns the merged tree into a Config. On a *yaml.TypeError the
+// values that decoded are returned with the error.
+func (l *layeredConfig) decode() (*Config, error) {
+	cfg := &Config{}
+	data, err := yaml.Marshal(l.tree)
+	if err != nil {
+		return nil, err
+	}
+	cfg.tree, cfg.origins, cfg.sources = l.tree, l.origins, l.sources
+	cfg.profile, cfg.profileOrigin = l.profile, l.profileOrigin
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return cfg, fmt.Errorf("invalid merged configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+func loadLayers(opts Options) (*layeredConfig, error) {
+	layers := &layeredConfig{tree: map[string]any{}, origins: map[string]string{}, files: map[string][]byte{}, prefixes: map[string]string{}}
+
+	if len(embeddedDefaultConfig) == 0 {
+		return nil, errors.New("embedded default configuration is empty")
+	}
+	layers.mergeData(Source{Kind: SourceDefault}, embeddedDefaultConfig)
+
+	userPath, err := resolvePath(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := layers.mergeFile(opts, Source{Kind: SourceUser, Path: userPath}, strings.TrimSpace(opts.Path) != ""); err != nil {
+		return nil, err
+	}
+	if err := layers.mergeProfile(opts, userPath); err != nil {
+		return nil, err
+	}
+
+	workspacePath, ok := opts.workspaceFile, opts.workspaceFile != ""
+	if !ok {
+		if workspacePath, ok, err = findWorkspaceFile(opts.Dir); err != nil {
+			return nil, err
+		}
+	}
+	if ok {
+		if err := layers.mergeFile(opts, Source{Kind: SourceWorkspace, Path: workspacePath}, true); err != nil {
+			return nil, err
+		}
+	}
+
+	layers.mergeEnv(os.Environ())
+	for _, override := range opts.Overrides {
+		key, value, ok := strings.Cut(override, "=")
+		origin := fmt.Sprintf("%s --set %s", SourceFlag, strings.TrimSpace(key))
+		if !ok {
+			layers.problems = append(layers.problems, Problem{Source: SourceFlag + " --set", Message: fmt.Sprintf("invalid --set %q: expected key=value", override)})
+			continue
+		}
+		layers.set(strings.TrimSpace(key), value, origin)
+	}
+	if len(opts.Overrides) > 0 {
+		layers.sources = append(layers.sources, Source{Kind: SourceFlag})
+	}
+	return layers, nil
+}
+
+// findWorkspaceFile looks for WorkspaceFileName in dir and its parents.
+func findWorkspaceFile(dir string) (string, bool, error) {
+	if strings.TrimSpace(dir) == "" {
+		var err error
+		if dir, err = os.Getwd(); err != nil {
+			return "", false, fmt.Errorf("unable to determine working directory: %w", err)
+		}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false, err
+	}
+	for {
+		path := filepath.Join(dir, WorkspaceFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false, nil
+		}
+		dir = parent
+	}
+}
+
+// mergeFile merges the YAML or JSON file of source; a missing file is an error
+// only when required.
+func (l *layeredConfig) mergeFile(opts Options, source Source, required bool) error {
+	data, ok := opts.contents[source.Path]
+	if !ok {
+		var err error
+		if data, err = os.ReadFile(source.Path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) && !required {
+				return nil
+			}
+			return err
+		}
+	}
+	l.mergeData(source, data)
+	return nil
+}
+
+// mergeData merges the content of a file source. A file that does not parse is
+// reported and skipped; unknown keys and values of the wrong type are reported
+// and merged.
+func (l *layeredConfig) mergeData(source Source, data []byte) {
+	file := source.Path
+	if file == "" {
+		file = source.Kind
+	}
+	tree, problems := parseFile(file, data)
+	l.problems = append(l.problems, problems...)
+	if tree == nil {
+		return
+	}
+	if profiles, ok := tree["profiles"]; ok {
+		delete(tree, "profiles")
+		if source.Kind == SourceUser {
+			l.profiles, _ = profiles.(map[string]any)
+		} else {
+			problem := Problem{Source: file, Message: "profiles can only be defined in the user file"}
+			var root yaml.Node
+			if yaml.Unmarshal(data, &root) == nil {
+				if node := findKeyNode(&root, []string{"profiles"}); node != nil {
+					problem.Line, problem.Column = node.Line, node.Column
+				}
+			}
+			l.problems = append(l.problems, problem)
+		}
+	}
+	l.mergeSource(source, tree, data)
+}
+
+// mergeSource merges the tree of source, whose file content is data.
+func (l *layeredConfig) mergeSource(source Source, tree map[string]any, data []byte) {
+	// Rename the legacy create_app repo per file; the embedded default
+	// already defines new.
+	if repos, ok := tree["repos"].(map[string]any); ok {
+		if legacy, ok := repos["create_app"]; ok {
+			if _, ok := repos["new"]; !ok {
+				repos["new"] = legacy
+			}
+			delete(repos, "create_app")
+		}
+	}
+	l.sources = append(l.sources, source)
+	l.files[source.String()] = data
+	mergeTree(l.tree, tree, "", source.String(), l.origins)
+}
+
+var yamlErrorPattern = regexp.MustCompile(`^(?:yaml: )?line (\d+)(?:, column (\d+))?: (.*)$`)
+
+// yamlProblem locates a YAML parse error of file.
+func yamlProblem(file string, err error) Problem {
+	problem := Problem{Source: file, Message: err.Error()}
+	if match := yamlErrorPattern.FindStringSubmatch(err.Error()); match != nil {
+		problem.Line, _ = strconv.Atoi(match[1])
+		problem.Column, _ = strconv.Atoi(match[2])
+		problem.Message = match[3]
+	}
+	return problem
+}
+
+// locate fills in the source of problem from the origin of its key, the
+// nearest value below it, or the nearest section above it.
+func (l *layeredConfig) locate(problem Problem) Problem {
+	origin, at := "", problem.Key
+	for at != "" && origin == "" {
+		if origin = l.origins[at]; origin != "" {
+			break
+		}
+		for _, key := range sortedKeys(l.origins) {
+			if strings.HasPrefix(key, at+".") {
+				origin = l.origins[key]
+				break
+			}
+		}
+		if origin == "" {
+			at = at[:max(strings.LastIndex(at, "."), 0)]
+		}
+	}
+	if origin == "" {
+		return problem
+	}
+
+	problem.Source = origin
+	for _, source := range l.sources {
+		if source.String() != origin || source.Path == "" {
+			continue
+		}
+		problem.Source = source.Path
+		var root yaml.Node
+		if err := yaml.Unmarshal(l.files[origin], &root); err == nil {
+			path := strings.Split(at, ".")
+			if prefix := l.prefixes[origin]; prefix != "" {
+				path = append(strings.Split(prefix, "."), path...)
+			}
+			if node := findKeyNode(&root, path); node != nil {
+				problem.Line, problem.Column = node.Line, node.Column
+			}
+		}
+	}
+	return problem
+}
+
+// findKeyNode returns the key node of the deepest segment of path present in
+// the YAML document root.
+func findKeyNode(root *yaml.Node, path []string) *yaml.Node {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	var found *yaml.Node
+	for len(path) > 0 && node.Kind == yaml.MappingNode {
+		// Map keys may contain dots; the longest matching key wins.
+		n := len(path)
+		key, value := mappingEntry(node, strings.Join(path, "."))
+		for key == nil && n > 1 {
+			n--
+			key, value = mappingEntry(node, strings.Join(path[:n], "."))
+		}
+		if key == nil {
+			break
+		}
+		found, node, path = key, value, path[n:]
+	}
+	return found
+}
+
+// mappingEntry returns the key and value nodes of key in mapping node m.
+func mappingEntry(m *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i], m.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// mergeEnv applies COUCHFUSION_* variables whose name has at least one double
+// underscore; other COUCHFUSION_* variables configure the CLI itself.
+func (l *layeredConfig) mergeEnv(environ []string) {
+	sort.Strings(environ)
+	applied := false
+	for _, entry := range environ {
+		name, value, _ := strings.Cut(entry, "=")
+		rest, ok := strings.CutPrefix(name, EnvPrefix)
+		if !ok || !strings.Contains(rest, "__") {
+			continue
+		}
+		key := strings.ToLower(strings.ReplaceAll(rest, "__", "."))
+		l.set(key, value, SourceEnv+" "+name)
+		applied = true
+	}
+	if applied {
+		l.sources = append(l.sources, Source{Kind: SourceEnv})
+	}
+}
+
+// set assigns value, converted to the type of the field at the dotted key, and
+// records origin for it. Unknown keys and invalid values are reported as
+// problems of origin.
+func (l *layeredConfig) set(key, value, origin string) {
+	path, typ, err := resolveKey(l.tree, key, false)
+	if err == nil {
+		var converted any
+		if converted, err = convertValue(typ, value); err == nil {
+			l.setPath(path, converted, origin)
+			return
+		}
+		err = fmt.Errorf("%s: %w", strings.Join(path, "."), err)
+	}
+	l.problems = append(l.problems, Problem{Source: origin, Key: key, Message: err.Error()})
+}
+
+// setPath assigns value at path, creating sections as needed.
+func (l *layeredConfig) setPath(path []string, converted any, origin string) {
+	node := l.tree
+	for _, segment := range path[:len(path)-1] {
+		child, ok := node[segment].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			node[segment] = child
+		}
+		node = child
+	}
+	last := path[len(path)-1]
+	node[last] = converted
+	setOrigins(strings.Join(path, "."), converted, origin, l.origins)
+}
+
+// mergeTree deep-merges src into dst and records origin for every leaf it sets.
+// A null value in src removes the key.
+func mergeTree(dst, src map[string]any, prefix, origin string, origins map[string]string) {
+	for key, value := range src {
+		path := prefix + key
+		if value == nil {
+			delete(dst, key)
+			setOrigins(path, nil, origin, origins)
+			continue
+		}
+		if srcMap, ok := value.(map[string]any); ok {
+			if dstMap, ok := dst[key].(map[string]any); ok {
+				mergeTree(dstMap, srcMap, path+".", origin, origins)
+				continue
+			}
+		}
+		dst[key] = value
+		setOrigins(path, value, origin, origins)
+	}
+}
+
+// setOrigins records origin for the leaves of value at path, dropping the
+// origins of leaves it replaced. A nil value records where the key was
+// removed.
+func setOrigins(path string, value any, origin string, origins map[string]string) {
+	for key := range origins {
+		if key == path || strings.HasPrefix(key, path+".") {
+			delete(origins, key)
+		}
+	}
+	if m, ok := value.(map[string]any); ok && len(m) > 0 {
+		for key, child := range m {
+			setOrigins(path+"."+key, child, origin, origins)
+		}
+		return
+	}
+	origins[path] = origin
+}
+
+// resolveKey maps a dotted key to the canonical path of a Config field and its
+// type. Field names are matched case-insensitively against their yaml names;
+// map keys are matched against the keys present in tree. Only
+// leaf keys resolve unless allowSection is set.
+func resolveKey(tree map[string]any, key string, allowSection bool) ([]string, reflect.Type, error) {
+	if strings.TrimSpace(key) == "" {
+		return nil, nil, errors.New("empty key")
+	}
+	segments := strings.Split(key, ".")
+	typ := reflect.TypeOf(Config{})
+	var node any = tree
+	path := make([]string, 0, len(segments))
+	for i := 0; i < len(segments); i++ {
+		segment := segments[i]
+		switch typ.Kind() {
+		case reflect.Struct:
+			field, ok := yamlField(typ, segment)
+			if !ok {
+				names := []string{}
+				for _, field := range yamlFields(typ) {
+					names = append(names, field.name)
+				}
+				return nil, nil, fmt.Errorf("unknown key %s%s", strings.Join(append(path, segment), "."), suggest(segment, names))
+			}
+			segment, typ = field.name, field.typ
+		case reflect.Map:
+			// Entries of flat sections take every segment up to the field,
+			// so host names like github.com keep their dots.
+			if rest := strings.Join(segments[i:], "."); allowSection && hasKey(node, rest) {
+				segment, i = rest, len(segments)-1
+			} else if typ.Elem().Kind() == reflect.Struct && len(segments)-i > 2 {
+				segment = strings.Join(segments[i:len(segments)-1], ".")
+				i = len(segments) - 2
+			}
+			if m, ok := node.(map[string]any); ok {
+				for existing := range m {
+					if strings.EqualFold(existing, segment) {
+						segment = existing
+						break
+					}
+				}
+			}
+			typ = typ.Elem()
+		default:
+			return nil, nil, fmt.Errorf("%s is not a section", strings.Join(path, "."))
+		}
+		path = append(path, segment)
+		if m, ok := node.(map[string]any); ok {
+			node = m[segment]
+		} else {
+			node = nil
+		}
+		if i == len(segments)-1 && !allowSection && (typ.Kind() == reflect.Struct || typ.Kind() == reflect.Map) {
+			return nil, nil, fmt.Errorf("%s is a section; set one of its keys", strings.Join(path, "."))
+		}
+	}
+	return path, typ, nil
+}
+
+type fieldInfo struct {
+	name string
+	typ  reflect.Type
+}
+
+// yamlField finds the field of struct type typ whose yaml name matches name.
+func yamlField(typ reflect.Type, name string) (fieldInfo, bool) {
+	for _, field := range yamlFields(typ) {
+		if strings.EqualFold(field.name, name) {
+			return field, true
+		}
+	}
+	return fieldInfo{}, false
+}
+
+// yamlFields lists the exported fields of struct type typ by yaml name.
+func yamlFields(typ reflect.Type) []fieldInfo {
+	fields := []fieldInfo{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, fieldInfo{name: name, typ: field.Type})
+	}
+	return fields
+}
+
+// convertValue parses a command line or environment value for a field of typ.
+// Lists take comma-separated values or a YAML flow sequence.
+func convertValue(typ reflect.Type, value string) (any, error) {
+	value = strings.TrimSpace(value)
+	switch typ.Kind() {
+	case reflect.String:
+		return value, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected true or false, got %q", value)
+		}
+		return b, nil
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number, got %q", value)
+		}
+		return n, nil
+	case reflect.Slice:
+		items := []any{}
+		if strings.HasPrefix(value, "[") {
+			var list []string
+			if err := yaml.Unmarshal([]byte(value), &list); err != nil {
+				return nil, fmt.Errorf("invalid list %q: %w", value, err)
+			}
+			for _, item := range list {
+				items = append(items, item)
+			}
+			return items, nil
+		}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unsupported value type %s", typ)
+}
+
+// Sources lists the layers that contributed to the configuration, in the
+// order they were applied.
+func (c *Config) Sources() []Source {
+	return append([]Source{}, c.sources...)
+}
+
+// Origin describes the source that set the value at the dotted key.
+func (c *Config) Origin(key string) string {
+	return c.origins[key]
+}
+
+// Setting is a configured leaf value and the source that set it.
+type Setting struct {
+	Key    string
+	Value  any
+	Origin string
+}
+
+// Settings lists every value set by a source, sorted by key. Values are as
+// configured, before repo URLs are rewritten for their protocol; keys removed
+// with null have a nil value.
+func (c *Config) Settings() []Setting {
+	keys := make([]string, 0, len(c.origins))
+	for key := range c.origins {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	settings := make([]Setting, 0, len(keys))
+	for _, key := range keys {
+		settings = append(settings, Setting{Key: key, Value: c.lookup(key), Origin: c.origins[key]})
+	}
+	return settings
+}
+
+// lookup returns the configured value at the dotted key. Map keys may
+// contain dots themselves, so the longest matching key wins at each level.
+func (c *Config) lookup(key string) any {
+	var node any = c.tree
+	segments := strings.Split(key, ".")
+	for len(segments) > 0 {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		n := len(segments)
+		for n > 1 && !hasKey(m, strings.Join(segments[:n], ".")) {
+			n--
+		}
+		node = m[strings.Join(segments[:n], ".")]
+		segments = segments[n:]
+	}
+	return node
+}
+
+// hasKey reports whether node is a map with key.
+func hasKey(node any, key string) bool {
+	m, ok := node.(map[string]any)
+	if !ok {
+		return false
+	}
+	_, ok = m[key]
+	return ok
+}
+
+// Write prints the merged configuration as YAML. With origins every value is
+// listed on its own line with the source that set it.
+func (c *Config) Write(w io.Writer, origins bool) error {
+	if !origins {
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(c.tree); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	sources := make([]string, 0, len(c.sources))
+	for _, source := range c.sources {
+		sources = append(sources, source.String())
+	}
+	fmt.Fprintf(w, "Sources, lowest precedence first: %s\n", strings.Join(sources, ", "))
+	if c.profile != "" {
+		fmt.Fprintf(w, "Profile %s, selected by %s\n", c.profile, c.profileOrigin)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, setting := range c.Settings() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", setting.Key, formatValue(setting.Value), setting.Origin)
+	}
+	return tw.Flush()
+}
+
+// formatValue renders a leaf value on one line, lists as YAML flow sequences.
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		if v == "" {
+			return `""`
+		}
+		return v
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, formatValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]any:
+		return "{}"
+	}
+	return fmt.Sprint(value)
+}
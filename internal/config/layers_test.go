@@ -0,0 +1,188 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeTree(t *testing.T) {
+	tests := []struct {
+		name        string
+		dst, src    map[string]any
+		want        map[string]any
+		wantOrigins map[string]string
+	}{
+		{
+			name:        "maps merge key by key",
+			dst:         map[string]any{"repos": map[string]any{"new": map[string]any{"url": "a", "branch": "main"}}},
+			src:         map[string]any{"repos": map[string]any{"new": map[string]any{"branch": "dev"}}},
+			want:        map[string]any{"repos": map[string]any{"new": map[string]any{"url": "a", "branch": "dev"}}},
+			wantOrigins: map[string]string{"repos.new.url": "default", "repos.new.branch": "user"},
+		},
+		{
+			name:        "lists replace",
+			dst:         map[string]any{"prompts": map[string]any{"defaultLayerSelection": []any{"auth", "content"}}},
+			src:         map[string]any{"prompts": map[string]any{"defaultLayerSelection": []any{"orders"}}},
+			want:        map[string]any{"prompts": map[string]any{"defaultLayerSelection": []any{"orders"}}},
+			wantOrigins: map[string]string{"prompts.defaultLayerSelection": "user"},
+		},
+		{
+			name:        "null removes the key",
+			dst:         map[string]any{"modules": map[string]any{"auth": map[string]any{"extends": "@layers/auth"}, "orders": map[string]any{"extends": "@layers/orders"}}},
+			src:         map[string]any{"modules": map[string]any{"orders": nil}},
+			want:        map[string]any{"modules": map[string]any{"auth": map[string]any{"extends": "@layers/auth"}}},
+			wantOrigins: map[string]string{"modules.auth.extends": "default", "modules.orders": "user"},
+		},
+		{
+			name:        "map replaces a scalar",
+			dst:         map[string]any{"git": "none"},
+			src:         map[string]any{"git": map[string]any{"hosts": map[string]any{"github.com": map[string]any{"protocol": "ssh"}}}},
+			want:        map[string]any{"git": map[string]any{"hosts": map[string]any{"github.com": map[string]any{"protocol": "ssh"}}}},
+			wantOrigins: map[string]string{"git.hosts.github.com.protocol": "user"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origins := map[string]string{}
+			mergeTree(map[string]any{}, tt.dst, "", "default", origins)
+			dst := tt.dst
+			mergeTree(dst, tt.src, "", "user", origins)
+			if !reflect.DeepEqual(dst, tt.want) {
+				t.Errorf("merged tree = %v, want %v", dst, tt.want)
+			}
+			if !reflect.DeepEqual(origins, tt.wantOrigins) {
+				t.Errorf("origins = %v, want %v", origins, tt.wantOrigins)
+			}
+		})
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        string
+		key        string
+		want       any
+		wantOrigin string
+		wantErr    string
+	}{
+		{"string field", "COUCHFUSION_REPOS__NEW__BRANCH=dev", "repos.new.branch", "dev", "env COUCHFUSION_REPOS__NEW__BRANCH", ""},
+		{"case-insensitive field", "COUCHFUSION_REPOS__NEW__AUTHPROMPT=true", "repos.new.authPrompt", true, "env COUCHFUSION_REPOS__NEW__AUTHPROMPT", ""},
+		{"nested section", "COUCHFUSION_GIT__SCAFFOLD__INITIALCOMMIT=false", "git.scaffold.initialCommit", false, "env COUCHFUSION_GIT__SCAFFOLD__INITIALCOMMIT", ""},
+		{"comma list", "COUCHFUSION_PROMPTS__DEFAULTLAYERSELECTION=auth,orders", "prompts.defaultLayerSelection", []any{"auth", "orders"}, "env COUCHFUSION_PROMPTS__DEFAULTLAYERSELECTION", ""},
+		{"new map key", "COUCHFUSION_MODULES__BILLING__EXTENDS=@layers/billing", "modules.billing.extends", "@layers/billing", "env COUCHFUSION_MODULES__BILLING__EXTENDS", ""},
+		{"no double underscore", "COUCHFUSION_NO_TUI=1", "", nil, "", ""},
+		{"unknown key", "COUCHFUSION_REPOS__NEW__BRANHC=dev", "", nil, "", "unknown"},
+		{"invalid bool", "COUCHFUSION_REPOS__NEW__AUTHPROMPT=maybe", "", nil, "", "repos.new.authPrompt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layers := &layeredConfig{tree: map[string]any{}, origins: map[string]string{}, files: map[string][]byte{}, prefixes: map[string]string{}}
+			layers.mergeData(Source{Kind: SourceDefault}, embeddedDefaultConfig)
+			before := len(layers.origins)
+			layers.mergeEnv([]string{tt.env})
+
+			if tt.wantErr != "" {
+				if len(layers.problems) == 0 || !strings.Contains(layers.problems[0].String(), tt.wantErr) {
+					t.Fatalf("problems = %v, want one containing %q", layers.problems, tt.wantErr)
+				}
+				return
+			}
+			if len(layers.problems) > 0 {
+				t.Fatalf("unexpected problems: %v", layers.problems)
+			}
+			if tt.key == "" {
+				if len(layers.origins) != before || len(layers.sources) != 1 {
+					t.Fatalf("%s was applied as a config value", tt.env)
+				}
+				return
+			}
+			cfg, err := layers.decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.lookup(tt.key); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.key, got, tt.want)
+			}
+			if got := cfg.Origin(tt.key); got != tt.wantOrigin {
+				t.Errorf("Origin(%s) = %q, want %q", tt.key, got, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	userFile := filepath.Join(dir, "config.yaml")
+	writeFile(t, userFile, `repos:
+  new:
+    url: git@github.com:our-org/starter.git
+    branch: user
+modules:
+  orders: null
+`)
+	workspace := filepath.Join(dir, "ws")
+	writeFile(t, filepath.Join(workspace, WorkspaceFileName), `repos:
+  new:
+    branch: team
+modules:
+  billing:
+    extends: "@layers/billing"
+`)
+	t.Setenv("COUCHFUSION_REPOS__NEW__BRANCH", "envbranch")
+
+	cfg, usedDefault, err := LoadLayers(Options{
+		Path:      userFile,
+		Dir:       filepath.Join(workspace, "apps"),
+		Overrides: []string{"prompts.defaultLayerSelection=auth,billing"},
+	})
+	if err != nil {
+		t.Fatalf("LoadLayers() error = %v", err)
+	}
+	if usedDefault {
+		t.Error("LoadLayers() reported only the embedded default")
+	}
+
+	repo := cfg.Repos["new"]
+	if repo.URL != "git@github.com:our-org/starter.git" || repo.Branch != "envbranch" || repo.Protocol != "ssh" {
+		t.Errorf("repos.new = %+v", repo)
+	}
+	if init := cfg.Repos["init"]; init.Protocol != "https" {
+		t.Errorf("repos.init.protocol = %q, want https from the URL", init.Protocol)
+	}
+	if _, ok := cfg.Modules["orders"]; ok {
+		t.Error("modules.orders was not removed by null")
+	}
+	if cfg.Modules["billing"].Extends != "@layers/billing" || cfg.Modules["auth"].Extends != "@layers/auth" {
+		t.Errorf("modules = %v", cfg.Modules)
+	}
+	if want := []string{"auth", "billing"}; !reflect.DeepEqual(cfg.Prompts.DefaultLayerSelection, want) {
+		t.Errorf("prompts.defaultLayerSelection = %v, want %v", cfg.Prompts.DefaultLayerSelection, want)
+	}
+
+	origins := map[string]string{
+		"repos.new.url":                 "user (" + userFile + ")",
+		"repos.new.branch":              "env COUCHFUSION_REPOS__NEW__BRANCH",
+		"modules.billing.extends":       "workspace (" + filepath.Join(workspace, WorkspaceFileName) + ")",
+		"modules.auth.extends":          "default",
+		"prompts.defaultLayerSelection": "flag --set prompts.defaultLayerSelection",
+	}
+	for key, want := range origins {
+		if got := cfg.Origin(key); got != want {
+			t.Errorf("Origin(%s) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
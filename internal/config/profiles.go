@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProfileEnv selects a profile when --profile is not given.
+const ProfileEnv = "COUCHFUSION_PROFILE"
+
+// ProfilesDirName is the directory next to the user file that holds one
+// <name>.yaml file per profile.
+const ProfilesDirName = "profiles"
+
+// Profile is a named set of config values for one client or organization,
+// merged over the user file.
+type Profile struct {
+	Name string
+	// Sources lists where the profile is defined: the user file, its
+	// profile file, or both.
+	Sources []string
+	Active  bool
+}
+
+// selectProfile returns the active profile name and what selected it.
+func selectProfile(opts Options) (string, string) {
+	if name := strings.TrimSpace(opts.Profile); name != "" {
+		return name, SourceFlag + " --profile"
+	}
+	if name := strings.TrimSpace(os.Getenv(ProfileEnv)); name != "" {
+		return name, SourceEnv + " " + ProfileEnv
+	}
+	if name := strings.TrimSpace(opts.RecordedProfile); name != "" {
+		return name, fmt.Sprintf("%s (%s)", SourceWorkspace, opts.RecordedIn)
+	}
+	return "", ""
+}
+
+// profileFile returns the profile file of name next to the user file.
+func profileFile(userPath, name string) string {
+	return filepath.Join(filepath.Dir(userPath), ProfilesDirName, name+".yaml")
+}
+
+// mergeProfile merges the active profile over the user file: its entry under
+// profiles in the user file, then its profile file. A profile defined in
+// neither is a problem.
+func (l *layeredConfig) mergeProfile(opts Options, userPath string) error {
+	name, origin := selectProfile(opts)
+	if name == "" {
+		return nil
+	}
+	l.profile, l.profileOrigin = name, origin
+	if !moduleNamePattern.MatchString(name) {
+		l.problems = append(l.problems, Problem{Source: origin, Message: fmt.Sprintf("profile name '%s' must be lowercase letters, digits and dashes", name)})
+		return nil
+	}
+
+	found := false
+	if entry, ok := l.profiles[name]; ok {
+		found = true
+		source := Source{Kind: SourceProfile, Path: userPath, Name: name}
+		tree, _ := entry.(map[string]any)
+		if tree == nil {
+			tree = map[string]any{}
+		}
+		l.prefixes[source.String()] = "profiles." + name
+		l.mergeSource(source, tree, l.files[Source{Kind: SourceUser, Path: userPath}.String()])
+	}
+
+	path := profileFile(userPath, name)
+	data, ok := opts.contents[path]
+	if !ok {
+		var err error
+		if data, err = os.ReadFile(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		ok = err == nil
+	}
+	if ok {
+		found = true
+		l.mergeData(Source{Kind: SourceProfile, Path: path, Name: name}, data)
+	}
+
+	if !found {
+		l.problems = append(l.problems, Problem{
+			Source:  origin,
+			Message: fmt.Sprintf("profile '%s' is not defined under profiles in %s or in %s", name, userPath, path),
+		})
+	}
+	return nil
+}
+
+// ListProfiles returns the profiles defined in the user file and the
+// profiles directory, sorted by name, marking the one opts selects.
+func ListProfiles(opts Options) ([]Profile, error) {
+	layers, err := loadLayers(opts)
+	if err != nil {
+		return nil, err
+	}
+	userPath, err := resolvePath(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string][]string{}
+	for name := range layers.profiles {
+		sources[name] = append(sources[name], userPath)
+	}
+	dir := filepath.Join(filepath.Dir(userPath), ProfilesDirName)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".yaml")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		sources[name] = append(sources[name], filepath.Join(dir, entry.Name()))
+	}
+
+	profiles := make([]Profile, 0, len(sources))
+	for name, files := range sources {
+		profiles = append(profiles, Profile{Name: name, Sources: files, Active: name == layers.profile})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+// Profile returns the active profile, or the empty string when none is
+// selected.
+func (c *Config) Profile() string {
+	return c.profile
+}
+
+// ProfileOrigin describes what selected the active profile: --profile,
+// COUCHFUSION_PROFILE or the workspace.
+func (c *Config) ProfileOrigin() string {
+	return c.profileOrigin
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// schemaDescriptions documents config keys in the JSON Schema. Map entries
+// are written as "*", e.g. repos.*.url.
+var schemaDescriptions = map[string]string{
+	"repos":                         "Starter repositories cloned by init (base layers), new (apps) and create_layer.",
+	"repos.*.url":                   "Git URL (https or ssh), local directory, file:// URL or .tar.gz/.zip archive.",
+	"repos.*.branch":                "Branch to clone.",
+	"repos.*.ref":                   "Tag or commit SHA; takes precedence over branch.",
+	"repos.*.protocol":              "Rewrites url to ssh or https.",
+	"repos.*.authPrompt":            "Prompt for HTTPS credentials when cloning.",
+	"repos.*.credentialStore":       "Use and update the system git credential store for authPrompt.",
+	"modules":                       "Modules offered by new, by name.",
+	"modules.*.description":         "Shown in the module picker.",
+	"modules.*.extends":             "Layer added to the app's nuxt.config.ts extends; defaults to @layers/<name>.",
+	"workspace.defaultRoot":         "Workspace root used when running outside it.",
+	"workspace.layersMode":          "How init keeps the base layers linked to upstream.",
+	"workspace.gitMode":             "One repository per app and /layers, or one at the workspace root.",
+	"workspace.packageWorkspaces":   "Package manager whose root workspace init writes.",
+	"prompts.defaultLayerSelection": "Modules preselected by the module picker of new.",
+	"git.hosts":                     "Protocol and SSH overrides per host name, e.g. github.com.",
+	"git.hosts.*.protocol":          "Takes precedence over the repo's own protocol.",
+	"git.hosts.*.sshPort":           "Port of rewritten SSH URLs.",
+	"git.scaffold":                  "Git repository created for new apps, created layers and snapshot /layers.",
+	"git.scaffold.initialCommit":    "Commit the scaffolded files.",
+	"git.scaffold.commitMessage":    "Message of the initial commit.",
+	"git.scaffold.defaultBranch":    "Initial branch; empty keeps git's init.defaultBranch.",
+	"git.scaffold.remote":           "Remote added as origin; {{app}} is replaced by the project name.",
+	"git.scaffold.authorName":       "Author of the initial commit; set together with authorEmail.",
+	"git.scaffold.authorEmail":      "Author email of the initial commit; set together with authorName.",
+}
+
+// schemaEnums lists the allowed values of keys, mirroring validate.
+var schemaEnums = map[string][]string{
+	"repos.*.protocol":            {"ssh", "https"},
+	"git.hosts.*.protocol":        {"ssh", "https"},
+	"workspace.layersMode":        LayersModes,
+	"workspace.gitMode":           GitModes,
+	"workspace.packageWorkspaces": PackageManagers,
+}
+
+// Schema returns a JSON Schema (draft 2020-12) of the config file, so editors
+// can complete and check it. Profiles and profile files share the settings
+// definition.
+func Schema() map[string]any {
+	settings := schemaFor(reflect.TypeOf(Config{}), "")
+	properties := map[string]any{
+		"profiles": map[string]any{
+			"type":                 "object",
+			"description":          "Named profiles merged over this file when selected with --profile, COUCHFUSION_PROFILE or the workspace; user file only.",
+			"propertyNames":        map[string]any{"pattern": moduleNamePattern.String()},
+			"additionalProperties": map[string]any{"$ref": "#/$defs/settings"},
+		},
+	}
+	for name, property := range settings["properties"].(map[string]any) {
+		properties[name] = property
+	}
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "couchfusion configuration",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+		"$defs":                map[string]any{"settings": settings},
+	}
+}
+
+// WriteSchema writes Schema as indented JSON.
+func WriteSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Schema())
+}
+
+func schemaFor(typ reflect.Type, key string) map[string]any {
+	schema := map[string]any{}
+	switch typ.Kind() {
+	case reflect.Struct:
+		properties := map[string]any{}
+		for _, field := range yamlFields(typ) {
+			properties[field.name] = schemaFor(field.typ, joinKey(key, field.name))
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+	case reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = nullable(schemaFor(typ.Elem(), joinKey(key, "*")))
+		if key == "modules" {
+			schema["propertyNames"] = map[string]any{"pattern": moduleNamePattern.String()}
+		}
+	case reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = schemaFor(typ.Elem(), joinKey(key, "*"))
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int:
+		schema["type"] = "integer"
+	default:
+		schema["type"] = "string"
+	}
+
+	if description, ok := schemaDescriptions[key]; ok {
+		schema["description"] = description
+	}
+	if values, ok := schemaEnums[key]; ok {
+		schema["enum"] = values
+	}
+	if strings.HasSuffix(key, ".sshPort") {
+		schema["minimum"], schema["maximum"] = 0, 65535
+	}
+	return schema
+}
+
+// nullable allows null for map entries, which removes them from lower layers.
+func nullable(schema map[string]any) map[string]any {
+	return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+}
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseFile decodes the YAML or JSON content of a config file and checks it
+// against the Config fields. Problems are reported with the line and column of
+// the offending key or value; a file that does not parse yields a nil tree.
+func parseFile(file string, data []byte) (map[string]any, []Problem) {
+	var doc yaml.Node
+	yamlErr := yaml.Unmarshal(data, &doc)
+	if yamlErr != nil {
+		tree := map[string]any{}
+		if err := json.Unmarshal(data, &tree); err == nil {
+			// JSON that YAML rejects, e.g. indented with tabs; the
+			// positions are lost.
+			if err := doc.Encode(tree); err != nil {
+				return nil, []Problem{{Source: file, Message: err.Error()}}
+			}
+			return tree, checkFile(file, &doc)
+		} else if looksLikeJSON(file, data) {
+			return nil, []Problem{jsonProblem(file, data, err)}
+		}
+		return nil, []Problem{yamlProblem(file, yamlErr)}
+	}
+
+	tree := map[string]any{}
+	if doc.Kind == 0 {
+		return tree, nil
+	}
+	problems := checkFile(file, &doc)
+	if err := doc.Decode(&tree); err != nil {
+		// The top level is not a mapping, which checkFile reported.
+		return nil, problems
+	}
+	return tree, problems
+}
+
+// looksLikeJSON reports whether a file that YAML rejects was meant to be JSON,
+// so its JSON error is the helpful one.
+func looksLikeJSON(file string, data []byte) bool {
+	return strings.EqualFold(filepath.Ext(file), ".json") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// jsonProblem locates a JSON syntax or type error of file.
+func jsonProblem(file string, data []byte, err error) Problem {
+	problem := Problem{Source: file, Message: err.Error()}
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return problem
+	}
+	before := data[:min(int(offset), len(data))]
+	problem.Line = bytes.Count(before, []byte("\n")) + 1
+	problem.Column = len(before) - bytes.LastIndexByte(before, '\n')
+	return problem
+}
+
+// checkFile walks a parsed config file against the Config type.
+func checkFile(file string, doc *yaml.Node) []Problem {
+	c := &fileChecker{file: file}
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		c.check(doc.Content[0], reflect.TypeOf(Config{}), "")
+	}
+	return c.problems
+}
+
+type fileChecker struct {
+	file     string
+	problems []Problem
+}
+
+func (c *fileChecker) report(node *yaml.Node, key, format string, args ...any) {
+	c.problems = append(c.problems, Problem{
+		Source:  c.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// check reports keys unknown to typ and values that do not decode into it.
+// Null values are allowed anywhere; they remove the key from lower layers.
+func (c *fileChecker) check(node *yaml.Node, typ reflect.Type, key string) {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if !c.expect(node, yaml.MappingNode, key, "a section") {
+			return
+		}
+		fields := yamlFields(typ)
+		names := make([]string, 0, len(fields))
+		for _, field := range fields {
+			names = append(names, field.name)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name := node.Content[i].Value
+			path := joinKey(key, name)
+			if key == "" && name == "profiles" {
+				c.checkProfiles(node.Content[i+1])
+				continue
+			}
+			field, ok := fieldNamed(fields, name)
+			if !ok {
+				c.report(node.Content[i], path, "unknown key %s%s", path, suggest(name, names))
+				continue
+			}
+			c.check(node.Content[i+1], field.typ, path)
+		}
+	case reflect.Map:
+		if !c.expect(node, yaml.MappingNode, key, "a section") {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			c.check(node.Content[i+1], typ.Elem(), joinKey(key, node.Content[i].Value))
+		}
+	case reflect.Slice:
+		if !c.expect(node, yaml.SequenceNode, key, "a list") {
+			return
+		}
+		for _, item := range node.Content {
+			c.check(item, typ.Elem(), key)
+		}
+	default:
+		if !c.expect(node, yaml.ScalarNode, key, describeType(typ)) {
+			return
+		}
+		if err := node.Decode(reflect.New(typ).Interface()); err != nil {
+			c.report(node, key, "%s: expected %s, got %q", key, describeType(typ), node.Value)
+		}
+	}
+}
+
+// checkProfiles checks each profile of the top-level profiles section as a
+// config of its own.
+func (c *fileChecker) checkProfiles(node *yaml.Node) {
+	if !c.expect(node, yaml.MappingNode, "profiles", "a section") {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name := node.Content[i].Value
+		key := joinKey("profiles", name)
+		if !moduleNamePattern.MatchString(name) {
+			c.report(node.Content[i], key, "profile name '%s' must be lowercase letters, digits and dashes", name)
+		}
+		c.check(node.Content[i+1], reflect.TypeOf(Config{}), key)
+	}
+}
+
+// expect reports a node that is not of kind.
+func (c *fileChecker) expect(node *yaml.Node, kind yaml.Kind, key, want string) bool {
+	if node.Kind == kind {
+		return true
+	}
+	got := "a value"
+	switch node.Kind {
+	case yaml.MappingNode:
+		got = "a section"
+	case yaml.SequenceNode:
+		got = "a list"
+	}
+	if key == "" {
+		c.report(node, key, "expected %s at the top level, got %s", want, got)
+	} else {
+		c.report(node, key, "%s: expected %s, got %s", key, want, got)
+	}
+	return false
+}
+
+// fieldNamed finds the field whose yaml name is exactly name, as the decoder
+// does.
+func fieldNamed(fields []fieldInfo, name string) (fieldInfo, bool) {
+	for _, field := range fields {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return fieldInfo{}, false
+}
+
+func describeType(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int:
+		return "a number"
+	case reflect.Slice:
+		return "a list"
+	case reflect.Struct, reflect.Map:
+		return "a section"
+	}
+	return "a string"
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// suggest returns a "did you mean" hint naming the candidate closest to name,
+// or the empty string when none is close.
+func suggest(name string, candidates []string) string {
+	best, bestDistance := "", 0
+	for _, candidate := range candidates {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if distance > max(2, len(candidate)/3) {
+			continue
+		}
+		if best == "" || distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf("; did you mean %s?", best)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	row := make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			prev, row[j] = row[j], min(row[j]+1, row[j-1]+1, prev+cost)
+		}
+	}
+	return row[len(rb)]
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "url", 3},
+		{"branch", "branch", 0},
+		{"brnch", "branch", 1},
+		{"branhc", "branch", 2},
+		{"kitten", "sitting", 3},
+		{"naïve", "naive", 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"url", "branch", "ref", "protocol", "authPrompt", "credentialStore"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"brnch", "; did you mean branch?"},
+		{"authprompt", "; did you mean authPrompt?"},
+		{"protcol", "; did you mean protocol?"},
+		{"urls", "; did you mean url?"},
+		{"credentialsStore", "; did you mean credentialStore?"},
+		{"mirror", ""},
+		{"x", ""},
+	}
+	for _, tt := range tests {
+		if got := suggest(tt.name, candidates); got != tt.want {
+			t.Errorf("suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		data     string
+		wantTree bool
+		want     []Problem
+	}{
+		{
+			name:     "valid file",
+			file:     "config.yaml",
+			data:     "repos:\n  new:\n    branch: dev\n    authPrompt: true\nmodules:\n  orders: null\n",
+			wantTree: true,
+		},
+		{
+			name:     "empty file",
+			file:     "config.yaml",
+			data:     "",
+			wantTree: true,
+		},
+		{
+			name:     "unknown key with suggestion",
+			file:     "config.yaml",
+			data:     "repos:\n  new:\n    brnch: dev\n",
+			wantTree: true,
+			want:     []Problem{{Source: "config.yaml", Line: 3, Column: 5, Key: "repos.new.brnch", Message: "unknown key repos.new.brnch; did you mean branch?"}},
+		},
+		{
+			name:     "unknown section",
+			file:     "config.yaml",
+			data:     "worksapce:\n  gitMode: monorepo\n",
+			wantTree: true,
+			want:     []Problem{{Source: "config.yaml", Line: 1, Column: 1, Key: "worksapce", Message: "unknown key worksapce; did you mean workspace?"}},
+		},
+		{
+			name:     "wrong scalar type",
+			file:     "config.yaml",
+			data:     "repos:\n  new:\n    authPrompt: sometimes\n",
+			wantTree: true,
+			want:     []Problem{{Source: "config.yaml", Line: 3, Column: 17, Key: "repos.new.authPrompt", Message: `repos.new.authPrompt: expected true or false, got "sometimes"`}},
+		},
+		{
+			name:     "list where a section belongs",
+			file:     "config.yaml",
+			data:     "modules:\n  - auth\n",
+			wantTree: true,
+			want:     []Problem{{Source: "config.yaml", Line: 2, Column: 3, Key: "modules", Message: "modules: expected a section, got a list"}},
+		},
+		{
+			name:     "section where a list belongs",
+			file:     "config.yaml",
+			data:     "prompts:\n  defaultLayerSelection:\n    auth: true\n",
+			wantTree: true,
+			want:     []Problem{{Source: "config.yaml", Line: 3, Column: 5, Key: "prompts.defaultLayerSelection", Message: "prompts.defaultLayerSelection: expected a list, got a section"}},
+		},
+		{
+			name: "top level is not a mapping",
+			file: "config.yaml",
+			data: "- repos\n",
+			want: []Problem{{Source: "config.yaml", Line: 1, Column: 1, Message: "expected a section at the top level, got a list"}},
+		},
+		{
+			name:     "profile name and keys",
+			file:     "config.yaml",
+			data:     "profiles:\n  Work:\n    repos:\n      new:\n        url: x\n        branhc: dev\n",
+			wantTree: true,
+			want: []Problem{
+				{Source: "config.yaml", Line: 2, Column: 3, Key: "profiles.Work", Message: "profile name 'Work' must be lowercase letters, digits and dashes"},
+				{Source: "config.yaml", Line: 6, Column: 9, Key: "profiles.Work.repos.new.branhc", Message: "unknown key profiles.Work.repos.new.branhc; did you mean branch?"},
+			},
+		},
+		{
+			name: "yaml syntax error",
+			file: "config.yaml",
+			data: "repos:\n  new:\n    url: [a\n",
+			want: []Problem{{Source: "config.yaml", Line: 2, Message: "did not find expected ',' or ']'"}},
+		},
+		{
+			name:     "json file",
+			file:     "config.json",
+			data:     "{\n\t\"repos\": {\"new\": {\"brnch\": \"dev\"}}\n}\n",
+			wantTree: true,
+			want:     []Problem{{Source: "config.json", Line: 2, Column: 20, Key: "repos.new.brnch", Message: "unknown key repos.new.brnch; did you mean branch?"}},
+		},
+		{
+			name: "json syntax error",
+			file: "config.json",
+			data: "{\n\t\"repos\": {\"new\": {\"url\": \"x\"}}\n",
+			want: []Problem{{Source: "config.json", Line: 3, Column: 1, Message: "unexpected end of JSON input"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, problems := parseFile(tt.file, []byte(tt.data))
+			if (tree != nil) != tt.wantTree {
+				t.Errorf("parseFile() tree = %v, want tree: %v", tree, tt.wantTree)
+			}
+			if !reflect.DeepEqual(problems, tt.want) {
+				t.Errorf("parseFile() problems =\n%#v\nwant\n%#v", problems, tt.want)
+			}
+		})
+	}
+}
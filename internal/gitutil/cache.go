@@ -0,0 +1,200 @@
+package gitutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheEntry describes a bare mirror stored in the repository cache.
+type CacheEntry struct {
+	Key       string
+	Path      string
+	URL       string
+	UpdatedAt time.Time
+	Size      int64
+}
+
+// DefaultCacheDir returns the cache location under ~/.couchfusion/cache.
+func DefaultCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".couchfusion", "cache"), nil
+}
+
+// CacheKey returns the directory name used for the mirror of repoURL.
+func CacheKey(repoURL string) string {
+	normalized := strings.TrimSuffix(strings.TrimSpace(repoURL), "/")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// UpdateCache creates or refreshes the mirror for repoURL. WithCache must be supplied.
+func UpdateCache(ctx context.Context, repoURL, protocol string, authPrompt bool, opts ...CloneOption) error {
+	cfg := buildCloneConfig(opts)
+	if cfg.cacheDir == "" {
+		return errors.New("cache directory not configured")
+	}
+	if cfg.offline {
+		return errors.New("cannot update the cache in offline mode")
+	}
+
+	mirror := filepath.Join(cfg.cacheDir, CacheKey(repoURL))
+	if isMirror(mirror) {
+		cfg.logf("Refreshing cached mirror of %s", repoURL)
+		return fetchMirror(ctx, cfg, mirror, repoURL, protocol, authPrompt)
+	}
+	cfg.logf("Creating cached mirror of %s", repoURL)
+	return createMirror(ctx, cfg, mirror, repoURL, protocol, authPrompt)
+}
+
+// ListCache returns the mirrors stored under dir, sorted by URL.
+func ListCache(ctx context.Context, dir string) ([]CacheEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache directory %s: %w", dir, err)
+	}
+
+	result := []CacheEntry{}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() || !isMirror(path) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, CacheEntry{
+			Key:       entry.Name(),
+			Path:      path,
+			URL:       mirrorOrigin(ctx, path),
+			UpdatedAt: info.ModTime(),
+			Size:      dirSize(path),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].URL < result[j].URL })
+	return result, nil
+}
+
+// RemoveCacheEntry deletes a mirror from disk.
+func RemoveCacheEntry(entry CacheEntry) error {
+	if err := os.RemoveAll(entry.Path); err != nil {
+		return fmt.Errorf("failed to remove cached mirror %s: %w", entry.Path, err)
+	}
+	return nil
+}
+
+// prepareMirror returns a local mirror path to clone from, refreshing it when online.
+func prepareMirror(ctx context.Context, cfg cloneConfig, repoURL, protocol string, authPrompt bool) (string, error) {
+	mirror := filepath.Join(cfg.cacheDir, CacheKey(repoURL))
+	exists := isMirror(mirror)
+
+	if cfg.offline {
+		if !exists {
+			return "", fmt.Errorf("offline mode: no cached copy of %s (run `couchfusion cache update` while online)", repoURL)
+		}
+		cfg.logf("Offline mode: cloning from cached mirror %s", mirror)
+		return mirror, nil
+	}
+
+	if exists {
+		cfg.logf("Refreshing cached mirror %s", mirror)
+		if err := fetchMirror(ctx, cfg, mirror, repoURL, protocol, authPrompt); err != nil {
+			cfg.logf("Mirror refresh failed (%v); using cached copy", err)
+		}
+		return mirror, nil
+	}
+
+	cfg.logf("Creating cached mirror %s", mirror)
+	if err := createMirror(ctx, cfg, mirror, repoURL, protocol, authPrompt); err != nil {
+		return "", err
+	}
+	return mirror, nil
+}
+
+func createMirror(ctx context.Context, cfg cloneConfig, mirror, repoURL, protocol string, authPrompt bool) error {
+	if err := os.MkdirAll(filepath.Dir(mirror), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	args := append([]string{"clone", "--mirror"}, cfg.progressArgs()...)
+	args = append(args, repoURL, mirror)
+	err := runRemote(ctx, cfg, repoURL, protocol, authPrompt, func() *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Stdout = cfg.stdout
+		cmd.Stderr = cfg.stderr
+		return cmd
+	})
+	if err != nil {
+		_ = os.RemoveAll(mirror)
+		return fmt.Errorf("git clone --mirror failed: %w", err)
+	}
+	return touch(mirror)
+}
+
+func fetchMirror(ctx context.Context, cfg cloneConfig, mirror, repoURL, protocol string, authPrompt bool) error {
+	args := append([]string{"--git-dir", mirror, "fetch", "--prune"}, cfg.progressArgs()...)
+	args = append(args, "origin")
+	err := runRemote(ctx, cfg, repoURL, protocol, authPrompt, func() *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Stdout = cfg.stdout
+		cmd.Stderr = cfg.stderr
+		return cmd
+	})
+	if err != nil {
+		return fmt.Errorf("git fetch failed: %w", err)
+	}
+	return touch(mirror)
+}
+
+func mirrorOrigin(ctx context.Context, mirror string) string {
+	out, err := exec.CommandContext(ctx, "git", "--git-dir", mirror, "config", "--get", "remote.origin.url").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func isMirror(path string) bool {
+	if _, err := os.Stat(filepath.Join(path, "HEAD")); err != nil {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(path, "objects"))
+	return err == nil && info.IsDir()
+}
+
+// touch records the last successful refresh in the mirror's modification time.
+func touch(path string) error {
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+func dirSize(path string) int64 {
+	var total int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
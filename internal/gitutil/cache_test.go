@@ -0,0 +1,116 @@
+package gitutil
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheKey(t *testing.T) {
+	base := CacheKey("https://github.com/org/repo.git")
+	if len(base) != 16 {
+		t.Fatalf("CacheKey() = %q, want 16 hex digits", base)
+	}
+	tests := []struct {
+		url  string
+		same bool
+	}{
+		{"https://github.com/org/repo.git", true},
+		{"https://github.com/org/repo.git/", true},
+		{"  https://github.com/org/repo.git\n", true},
+		{"git@github.com:org/repo.git", false},
+		{"https://github.com/org/other.git", false},
+	}
+	for _, tt := range tests {
+		if got := CacheKey(tt.url); (got == base) != tt.same {
+			t.Errorf("CacheKey(%q) = %q, same as base: %v, want %v", tt.url, got, got == base, tt.same)
+		}
+	}
+}
+
+func TestUseCache(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []CloneOption
+		want bool
+	}{
+		{"no cache", nil, false},
+		{"cache", []CloneOption{WithCache("/cache")}, true},
+		{"offline cache", []CloneOption{WithCache("/cache"), WithOffline(true)}, true},
+		{"read-only cache", []CloneOption{WithCache("/cache"), WithCacheReadOnly(true)}, false},
+		{"read-only cache offline", []CloneOption{WithCache("/cache"), WithCacheReadOnly(true), WithOffline(true)}, true},
+		{"offline without cache", []CloneOption{WithOffline(true)}, false},
+	}
+	for _, tt := range tests {
+		if got := buildCloneConfig(tt.opts).useCache(); got != tt.want {
+			t.Errorf("%s: useCache() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMirrorCache(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo, commit := gitRepo(t)
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+	opts := []CloneOption{WithCache(cacheDir), WithOutput(io.Discard), WithLogger(nil)}
+
+	offline := buildCloneConfig(append(opts, WithOffline(true)))
+	if _, err := prepareMirror(ctx, offline, repo, "", false); err == nil || !strings.Contains(err.Error(), "no cached copy") {
+		t.Fatalf("prepareMirror(offline, empty cache) error = %v, want no cached copy", err)
+	}
+	if err := UpdateCache(ctx, repo, "", false, append(opts, WithOffline(true))...); err == nil {
+		t.Fatal("UpdateCache(offline) succeeded")
+	}
+
+	if err := UpdateCache(ctx, repo, "", false, opts...); err != nil {
+		t.Fatalf("UpdateCache() error = %v", err)
+	}
+	mirror, err := prepareMirror(ctx, offline, repo, "", false)
+	if err != nil || mirror != filepath.Join(cacheDir, CacheKey(repo)) {
+		t.Fatalf("prepareMirror(offline) = %q, %v", mirror, err)
+	}
+	target := filepath.Join(t.TempDir(), "clone")
+	if err := runClone(ctx, offline, nil, mirror, "main", target); err != nil {
+		t.Fatalf("runClone(mirror) error = %v", err)
+	}
+	if head := git(t, target, "rev-parse", "HEAD"); head != commit {
+		t.Errorf("clone from mirror HEAD = %s, want %s", head, commit)
+	}
+
+	// A refresh picks up new commits.
+	if err := os.WriteFile(filepath.Join(repo, "CHANGELOG.md"), []byte("next\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, repo, "add", "CHANGELOG.md")
+	git(t, repo, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "next")
+	if err := UpdateCache(ctx, repo, "", false, opts...); err != nil {
+		t.Fatalf("UpdateCache(refresh) error = %v", err)
+	}
+	if got, want := git(t, mirror, "rev-parse", "main"), git(t, repo, "rev-parse", "HEAD"); got != want {
+		t.Errorf("refreshed mirror main = %s, want %s", got, want)
+	}
+
+	entries, err := ListCache(ctx, cacheDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ListCache() = %v, %v; want one entry", entries, err)
+	}
+	if entry := entries[0]; entry.Key != CacheKey(repo) || entry.URL != repo || entry.Size == 0 {
+		t.Errorf("ListCache() entry = %+v", entry)
+	}
+	if err := RemoveCacheEntry(entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := ListCache(ctx, cacheDir); err != nil || len(entries) != 0 {
+		t.Errorf("ListCache() after removal = %v, %v", entries, err)
+	}
+	if entries, err := ListCache(ctx, filepath.Join(cacheDir, "missing")); err != nil || entries != nil {
+		t.Errorf("ListCache(missing) = %v, %v; want nothing", entries, err)
+	}
+}
@@ -0,0 +1,289 @@
+package gitutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// Credentials reach git through GIT_ASKPASS pointing at the couchfusion binary
+// itself, so they never appear in URLs, process arguments or remote configs.
+const (
+	askPassEnv         = "COUCHFUSION_ASKPASS"
+	askPassUsernameEnv = "COUCHFUSION_GIT_USERNAME"
+	askPassPasswordEnv = "COUCHFUSION_GIT_PASSWORD"
+)
+
+// maxAuthAttempts bounds how often a git command is retried after the remote
+// rejects the supplied credentials.
+const maxAuthAttempts = 3
+
+// HandleAskPass answers a git credential prompt when the process was started as
+// a GIT_ASKPASS helper and reports whether it did. main calls it before anything
+// else and exits when it returns true.
+func HandleAskPass() bool {
+	if os.Getenv(askPassEnv) != "1" {
+		return false
+	}
+	prompt := ""
+	if len(os.Args) > 1 {
+		prompt = os.Args[1]
+	}
+	if strings.HasPrefix(strings.ToLower(prompt), "username") {
+		fmt.Println(os.Getenv(askPassUsernameEnv))
+	} else {
+		fmt.Println(os.Getenv(askPassPasswordEnv))
+	}
+	return true
+}
+
+type credentials struct {
+	username string
+	password string
+	// fromStore marks credentials returned by `git credential fill`.
+	fromStore bool
+}
+
+// httpsAuth supplies credentials for one repository URL. Credentials are shared
+// per host for the lifetime of the process so a command prompts at most once.
+type httpsAuth struct {
+	repoURL  string
+	useStore bool
+	logf     func(string, ...any)
+}
+
+var (
+	credentialMu    sync.Mutex
+	credentialCache = map[string]credentials{}
+)
+
+// authFor returns the authenticator for repoURL, or nil when git should handle
+// authentication on its own (SSH, or HTTPS without authPrompt).
+func authFor(cfg cloneConfig, repoURL, protocol string, authPrompt bool) *httpsAuth {
+	if protocol != "https" || !authPrompt {
+		return nil
+	}
+	return &httpsAuth{repoURL: repoURL, useStore: cfg.credentialStore, logf: cfg.logf}
+}
+
+// run executes the command built by build, retrying with fresh credentials when
+// the remote rejects them. A nil receiver runs the command once without changes.
+func (a *httpsAuth) run(ctx context.Context, build func() *exec.Cmd) error {
+	if a == nil {
+		return build().Run()
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxAuthAttempts; attempt++ {
+		creds, credErr := a.credentials(ctx)
+		if credErr != nil {
+			return credErr
+		}
+
+		cmd := build()
+		cmd.Env = append(os.Environ(), a.env(creds)...)
+		var stderr bytes.Buffer
+		cmd.Stderr = teeWriter(cmd.Stderr, &stderr)
+
+		if err = cmd.Run(); err == nil {
+			if a.useStore && !creds.fromStore {
+				a.storeCredential(ctx, "approve", creds)
+			}
+			return nil
+		}
+		if !isAuthFailure(stderr.String()) {
+			return err
+		}
+
+		a.forget()
+		if creds.fromStore {
+			a.storeCredential(ctx, "reject", creds)
+		}
+		if attempt < maxAuthAttempts {
+			a.logf("Authentication failed for %s; please try again (attempt %d of %d)", a.repoURL, attempt+1, maxAuthAttempts)
+		}
+	}
+	return fmt.Errorf("authentication failed for %s after %d attempts: %w", a.repoURL, maxAuthAttempts, err)
+}
+
+func (a *httpsAuth) env(creds credentials) []string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	return []string{
+		"GIT_ASKPASS=" + exe,
+		"GIT_TERMINAL_PROMPT=0",
+		askPassEnv + "=1",
+		askPassUsernameEnv + "=" + creds.username,
+		askPassPasswordEnv + "=" + creds.password,
+	}
+}
+
+func (a *httpsAuth) credentials(ctx context.Context) (credentials, error) {
+	key := credentialKey(a.repoURL)
+
+	credentialMu.Lock()
+	defer credentialMu.Unlock()
+	if creds, ok := credentialCache[key]; ok {
+		return creds, nil
+	}
+
+	if a.useStore {
+		if creds, ok := a.fillFromStore(ctx); ok {
+			a.logf("Using stored git credentials for %s", key)
+			credentialCache[key] = creds
+			return creds, nil
+		}
+	}
+
+	creds, err := promptCredentials()
+	if err != nil {
+		return credentials{}, err
+	}
+	credentialCache[key] = creds
+	return creds, nil
+}
+
+func (a *httpsAuth) forget() {
+	credentialMu.Lock()
+	defer credentialMu.Unlock()
+	delete(credentialCache, credentialKey(a.repoURL))
+}
+
+// fillFromStore asks the configured git credential helpers for a username and
+// password without letting git prompt on the terminal.
+func (a *httpsAuth) fillFromStore(ctx context.Context) (credentials, bool) {
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(credentialDescription(a.repoURL, credentials{}))
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	out, err := cmd.Output()
+	if err != nil {
+		return credentials{}, false
+	}
+
+	creds := credentials{fromStore: true}
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "username":
+			creds.username = value
+		case "password":
+			creds.password = value
+		}
+	}
+	return creds, creds.username != "" && creds.password != ""
+}
+
+// storeCredential runs `git credential approve` or `reject` so helpers remember
+// working credentials and drop rejected ones.
+func (a *httpsAuth) storeCredential(ctx context.Context, action string, creds credentials) {
+	cmd := exec.CommandContext(ctx, "git", "credential", action)
+	cmd.Stdin = strings.NewReader(credentialDescription(a.repoURL, creds))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		a.logf("git credential %s failed: %v: %s", action, err, strings.TrimSpace(string(out)))
+	}
+}
+
+// credentialDescription renders the key=value input expected by `git credential`.
+func credentialDescription(repoURL string, creds credentials) string {
+	var b strings.Builder
+	if u, err := url.Parse(repoURL); err == nil && u.Host != "" {
+		fmt.Fprintf(&b, "protocol=%s\nhost=%s\n", u.Scheme, u.Host)
+		if path := strings.TrimPrefix(u.Path, "/"); path != "" {
+			fmt.Fprintf(&b, "path=%s\n", path)
+		}
+	} else {
+		fmt.Fprintf(&b, "url=%s\n", repoURL)
+	}
+	if creds.username != "" {
+		fmt.Fprintf(&b, "username=%s\n", creds.username)
+	}
+	if creds.password != "" {
+		fmt.Fprintf(&b, "password=%s\n", creds.password)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// credentialKey groups credentials by scheme and host.
+func credentialKey(repoURL string) string {
+	if u, err := url.Parse(repoURL); err == nil && u.Host != "" {
+		return u.Scheme + "://" + u.Host
+	}
+	return repoURL
+}
+
+func isAuthFailure(stderr string) bool {
+	lower := strings.ToLower(stderr)
+	for _, marker := range []string{
+		"authentication failed",
+		"could not read username",
+		"could not read password",
+		"invalid username or password",
+		"returned error: 401",
+		"returned error: 403",
+	} {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// stdinReader is shared by prompts so retries do not lose buffered input.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func promptCredentials() (credentials, error) {
+	reader := stdinReader
+
+	fmt.Print("Enter HTTPS username: ")
+	usernameRaw, err := reader.ReadString('\n')
+	if err != nil {
+		return credentials{}, fmt.Errorf("failed to read username: %w", err)
+	}
+	username := strings.TrimSpace(usernameRaw)
+
+	fmt.Print("Enter HTTPS password/token: ")
+	var password string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		bytePassword, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return credentials{}, fmt.Errorf("failed to read password: %w", err)
+		}
+		password = strings.TrimSpace(string(bytePassword))
+	} else {
+		passwordRaw, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return credentials{}, fmt.Errorf("failed to read password: %w", err)
+		}
+		password = strings.TrimSpace(passwordRaw)
+	}
+
+	if username == "" || password == "" {
+		return credentials{}, fmt.Errorf("credentials cannot be empty")
+	}
+	return credentials{username: username, password: password}, nil
+}
+
+// teeWriter copies command output into buf while still forwarding it to w.
+func teeWriter(w io.Writer, buf *bytes.Buffer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(w, buf)
+}
@@ -0,0 +1,81 @@
+package gitutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// UnifiedDiff renders the change from before to after as a unified diff with
+// a/path and b/path headers using `git diff --no-index`. A nil before or after
+// marks a created or deleted file. It returns "" when the contents are equal.
+func UnifiedDiff(ctx context.Context, path string, before, after []byte) (string, error) {
+	if before != nil && after != nil && bytes.Equal(before, after) {
+		return "", nil
+	}
+
+	dir, err := os.MkdirTemp("", "couchfusion-diff-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create diff directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Base(path)
+	sides := [2]string{os.DevNull, os.DevNull}
+	for i, content := range [][]byte{before, after} {
+		if content == nil {
+			continue
+		}
+		side := filepath.Join(dir, []string{"a", "b"}[i], name)
+		if err := os.MkdirAll(filepath.Dir(side), 0o700); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(side, content, 0o600); err != nil {
+			return "", err
+		}
+		sides[i] = side
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "diff", "--no-index", "--no-color", "--no-ext-diff", "--", sides[0], sides[1])
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// Exit status 1 means the files differ.
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return "", fmt.Errorf("git diff failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	// Replace git's headers, which name the temporary files, with path.
+	lines := strings.SplitAfter(stdout.String(), "\n")
+	var out strings.Builder
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff --git "), strings.HasPrefix(line, "index "),
+			strings.HasPrefix(line, "new file mode "), strings.HasPrefix(line, "deleted file mode "):
+			continue
+		case strings.HasPrefix(line, "--- "):
+			if before == nil {
+				out.WriteString("--- /dev/null\n")
+			} else {
+				out.WriteString("--- a/" + path + "\n")
+			}
+		case strings.HasPrefix(line, "+++ "):
+			if after == nil {
+				out.WriteString("+++ /dev/null\n")
+			} else {
+				out.WriteString("+++ b/" + path + "\n")
+			}
+		default:
+			out.WriteString(line)
+		}
+	}
+	return out.String(), nil
+}
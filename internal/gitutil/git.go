@@ -1,21 +1,31 @@
 package gitutil
 
 import (
-	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strings"
 
-	"golang.org/x/term"
+	"github.com/nuxt-apps/couchfusion/internal/source"
 )
 
 type cloneConfig struct {
-	stdout io.Writer
-	stderr io.Writer
-	logf   func(string, ...any)
+	stdout   io.Writer
+	stderr   io.Writer
+	logf     func(string, ...any)
+	cacheDir string
+	offline  bool
+	// cacheReadOnly keeps clones from creating or refreshing mirrors.
+	cacheReadOnly bool
+	// credentialStore lets HTTPS prompts consult `git credential` helpers first.
+	credentialStore bool
+	progress        func(Progress)
 }
 
 // CloneOption customizes git clone execution.
@@ -50,6 +60,38 @@ func WithLogger(logf func(string, ...any)) CloneOption {
 	}
 }
 
+// WithCache clones through bare mirrors stored under dir, creating or refreshing
+// them as needed.
+func WithCache(dir string) CloneOption {
+	return func(cfg *cloneConfig) {
+		cfg.cacheDir = dir
+	}
+}
+
+// WithCacheReadOnly leaves the cache untouched, as dry runs must: existing
+// mirrors are still served offline, while online clones and fetches bypass the
+// cache instead of creating or refreshing a mirror.
+func WithCacheReadOnly(readOnly bool) CloneOption {
+	return func(cfg *cloneConfig) {
+		cfg.cacheReadOnly = readOnly
+	}
+}
+
+// WithOffline forbids network access; clones must be served from the cache.
+func WithOffline(offline bool) CloneOption {
+	return func(cfg *cloneConfig) {
+		cfg.offline = offline
+	}
+}
+
+// WithCredentialStore reads HTTPS credentials from the system git credential
+// store before prompting, and saves prompted credentials that work.
+func WithCredentialStore(enabled bool) CloneOption {
+	return func(cfg *cloneConfig) {
+		cfg.credentialStore = enabled
+	}
+}
+
 func buildCloneConfig(opts []CloneOption) cloneConfig {
 	cfg := cloneConfig{
 		stdout: os.Stdout,
@@ -70,77 +112,170 @@ func buildCloneConfig(opts []CloneOption) cloneConfig {
 	if cfg.logf == nil {
 		cfg.logf = func(string, ...any) {}
 	}
+	if cfg.progress != nil {
+		cfg.stderr = newProgressWriter(cfg.stderr, cfg.progress)
+	}
 	return cfg
 }
 
-// Clone clones the provided repository into targetDir.
-func Clone(ctx context.Context, repoURL, branch, targetDir string, protocol string, authPrompt bool, opts ...CloneOption) error {
+// useCache reports whether remote repositories are served through the mirror
+// cache. A read-only cache is only used offline, where mirrors are never
+// written.
+func (cfg cloneConfig) useCache() bool {
+	return cfg.cacheDir != "" && (cfg.offline || !cfg.cacheReadOnly)
+}
+
+// progressArgs returns --progress when progress is reported, so git emits it
+// even though stderr is not a terminal.
+func (cfg cloneConfig) progressArgs() []string {
+	if cfg.progress == nil {
+		return nil
+	}
+	return []string{"--progress"}
+}
+
+// Clone clones the provided repository into targetDir. Local directories, file://
+// URLs and archives are copied instead of cloned.
+func Clone(ctx context.Context, repoURL, ref, targetDir string, protocol string, authPrompt bool, opts ...CloneOption) error {
 	cfg := buildCloneConfig(opts)
 
-	cloneURL := repoURL
+	if source.IsLocal(repoURL) {
+		// Local directories and archives have no branches; copy them as-is.
+		cfg.logf("Preparing local source: path=%s target=%s", repoURL, targetDir)
+		return source.Fetch(repoURL, targetDir, cfg.logf)
+	}
 
-	cfg.logf("Preparing git clone: repo=%s branch=%s target=%s", repoURL, branch, targetDir)
+	cfg.logf("Preparing git clone: repo=%s ref=%s target=%s", repoURL, ref, targetDir)
 
-	if protocol == "https" && authPrompt {
-		var err error
-		// Inject credentials using stdin; this still prompts in the terminal.
-		cloneURL, err = injectCredentials(repoURL)
+	if cfg.useCache() {
+		mirror, err := prepareMirror(ctx, cfg, repoURL, protocol, authPrompt)
 		if err != nil {
-			return err
+			if cfg.offline {
+				return err
+			}
+			cfg.logf("Cache unavailable (%v); cloning directly from %s", err, repoURL)
+		} else {
+			if err := runClone(ctx, cfg, nil, mirror, ref, targetDir); err != nil {
+				return err
+			}
+			return setOriginURL(ctx, targetDir, repoURL)
 		}
+	} else if cfg.offline {
+		return errors.New("offline mode requires the repository cache")
+	}
+
+	if err := CheckSSH(ctx, repoURL); err != nil {
+		return err
 	}
+	return runClone(ctx, cfg, authFor(cfg, repoURL, protocol, authPrompt), repoURL, ref, targetDir)
+}
 
-	args := []string{"clone"}
-	if branch != "" {
-		args = append(args, "--branch", branch)
+// runClone clones source into targetDir. Branches and tags are passed to
+// --branch; commit SHAs are checked out detached after a --no-checkout clone.
+// A ref that looks like a SHA but names a branch or tag is cloned as the ref.
+func runClone(ctx context.Context, cfg cloneConfig, auth *httpsAuth, source, ref, targetDir string) error {
+	pinned := false
+	if IsCommitSHA(ref) {
+		named, err := hasNamedRef(ctx, auth, source, ref)
+		if err != nil {
+			return err
+		}
+		pinned = !named
 	}
-	args = append(args, cloneURL, targetDir)
 
-	cmd := exec.CommandContext(ctx, "git", args...)
-	cmd.Stdout = cfg.stdout
-	cmd.Stderr = cfg.stderr
+	args := append([]string{"clone"}, cfg.progressArgs()...)
+	if pinned {
+		args = append(args, "--no-checkout")
+	} else if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, source, targetDir)
 
-	if err := cmd.Run(); err != nil {
+	err := auth.run(ctx, func() *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Stdout = cfg.stdout
+		cmd.Stderr = cfg.stderr
+		return cmd
+	})
+	if err != nil {
 		return fmt.Errorf("git clone failed: %w", err)
 	}
 
+	if pinned {
+		checkout := exec.CommandContext(ctx, "git", "checkout", "--quiet", "--detach", ref)
+		checkout.Dir = targetDir
+		checkout.Stdout = cfg.stdout
+		checkout.Stderr = cfg.stderr
+		if err := checkout.Run(); err != nil {
+			return fmt.Errorf("git checkout %s failed: %w", ref, err)
+		}
+	}
+
 	return nil
 }
 
-func injectCredentials(repoURL string) (string, error) {
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Print("Enter HTTPS username: ")
-	usernameRaw, err := reader.ReadString('\n')
+// hasNamedRef reports whether source has a branch or tag named ref.
+func hasNamedRef(ctx context.Context, auth *httpsAuth, source, ref string) (bool, error) {
+	var out bytes.Buffer
+	err := auth.run(ctx, func() *exec.Cmd {
+		out.Reset()
+		cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", "--tags", source, "refs/heads/"+ref, "refs/tags/"+ref)
+		cmd.Stdout = &out
+		return cmd
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to read username: %w", err)
+		return false, fmt.Errorf("git ls-remote %s failed: %w", source, err)
 	}
-	username := strings.TrimSpace(usernameRaw)
+	return strings.TrimSpace(out.String()) != "", nil
+}
 
-	fmt.Print("Enter HTTPS password/token: ")
-	bytePassword, err := term.ReadPassword(int(os.Stdin.Fd()))
-	fmt.Println()
-	if err != nil {
-		return "", fmt.Errorf("failed to read password: %w", err)
-	}
-	password := strings.TrimSpace(string(bytePassword))
+// IsCommitSHA reports whether ref looks like a full or abbreviated commit hash.
+// Branch and tag names can look the same, so a repository's refs take
+// precedence; see CheckRef.
+func IsCommitSHA(ref string) bool {
+	return commitSHAPattern.MatchString(ref)
+}
+
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
 
-	if username == "" || password == "" {
-		return "", fmt.Errorf("credentials cannot be empty")
+// ResolveCommit returns the commit a clone produced. It must be called before the
+// target's .git directory is removed. Local sources report the HEAD of their own
+// repository when they are clean git working trees, and an empty string
+// otherwise: a copy of a tree with uncommitted changes matches no commit.
+func ResolveCommit(ctx context.Context, repoURL, targetDir string) (string, error) {
+	dir := targetDir
+	if source.IsLocal(repoURL) {
+		path, err := source.ResolvePath(repoURL)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+			return "", nil
+		}
+		status, err := Run(ctx, path, "status", "--porcelain")
+		if err != nil {
+			return "", err
+		}
+		if status != "" {
+			return "", nil
+		}
+		dir = path
 	}
 
-	schemeSplit := strings.SplitN(repoURL, "//", 2)
-	if len(schemeSplit) != 2 {
-		return "", fmt.Errorf("invalid https repo url")
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve commit in %s: %w", dir, err)
 	}
-	return fmt.Sprintf("%s//%s:%s@%s", schemeSplit[0], urlEncode(username), urlEncode(password), schemeSplit[1]), nil
+	return strings.TrimSpace(string(out)), nil
 }
 
-func urlEncode(input string) string {
-	replacer := strings.NewReplacer(
-		"@", "%40",
-		":", "%3A",
-		"/", "%2F",
-	)
-	return replacer.Replace(input)
+func setOriginURL(ctx context.Context, targetDir, repoURL string) error {
+	cmd := exec.CommandContext(ctx, "git", "remote", "set-url", "origin", repoURL)
+	cmd.Dir = targetDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to point origin at %s: %v: %s", repoURL, err, strings.TrimSpace(string(out)))
+	}
+	return nil
 }
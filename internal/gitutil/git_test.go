@@ -0,0 +1,130 @@
+package gitutil
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsCommitSHA(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"", false},
+		{"main", false},
+		{"v1.2.3", false},
+		{"abc123", false},
+		{"abc1234", true},
+		{"deadbeef", true},
+		{"ABC1234", false},
+		{"0123456789abcdef0123456789abcdef01234567", true},
+		{"0123456789abcdef0123456789abcdef012345678", false},
+		{"abc123g", false},
+	}
+	for _, tt := range tests {
+		if got := IsCommitSHA(tt.ref); got != tt.want {
+			t.Errorf("IsCommitSHA(%q) = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+// gitRepo creates a repository with one commit on main and returns its path
+// and the commit.
+func gitRepo(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	git(t, dir, "init", "--quiet", "--initial-branch", "main")
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("starter\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, dir, "add", "README.md")
+	git(t, dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "initial")
+	return dir, git(t, dir, "rev-parse", "HEAD")
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestRunCloneRefs(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo, commit := gitRepo(t)
+	git(t, repo, "branch", "deadbeef")
+	cfg := buildCloneConfig([]CloneOption{WithOutput(io.Discard), WithLogger(nil)})
+
+	tests := []struct {
+		name       string
+		ref        string
+		wantBranch string
+	}{
+		{"branch", "main", "main"},
+		{"hex branch name", "deadbeef", "deadbeef"},
+		{"abbreviated commit", commit[:10], ""},
+		{"full commit", commit, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "clone")
+			if err := runClone(context.Background(), cfg, nil, repo, tt.ref, target); err != nil {
+				t.Fatalf("runClone(%q) error = %v", tt.ref, err)
+			}
+			branch := strings.TrimSpace(gitOutput(target, "symbolic-ref", "--quiet", "--short", "HEAD"))
+			if branch != tt.wantBranch {
+				t.Errorf("runClone(%q) checked out branch %q, want %q", tt.ref, branch, tt.wantBranch)
+			}
+			if head := git(t, target, "rev-parse", "HEAD"); head != commit {
+				t.Errorf("runClone(%q) HEAD = %s, want %s", tt.ref, head, commit)
+			}
+		})
+	}
+}
+
+// gitOutput runs git and returns its output, ignoring failures such as
+// symbolic-ref on a detached HEAD.
+func gitOutput(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, _ := cmd.Output()
+	return string(out)
+}
+
+func TestResolveCommitLocalSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo, commit := gitRepo(t)
+	ctx := context.Background()
+
+	got, err := ResolveCommit(ctx, repo, t.TempDir())
+	if err != nil || got != commit {
+		t.Fatalf("ResolveCommit(clean) = %q, %v; want %s", got, err, commit)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "README.md"), []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ResolveCommit(ctx, repo, t.TempDir())
+	if err != nil || got != "" {
+		t.Fatalf("ResolveCommit(dirty) = %q, %v; want no commit", got, err)
+	}
+
+	plain := t.TempDir()
+	got, err = ResolveCommit(ctx, plain, t.TempDir())
+	if err != nil || got != "" {
+		t.Fatalf("ResolveCommit(no git) = %q, %v; want no commit", got, err)
+	}
+}
@@ -0,0 +1,50 @@
+package gitutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// MergeFile performs a three-way merge of ours and theirs against base using
+// `git merge-file`. It returns the merged content, including conflict markers
+// labelled with labels (ours, base, theirs), and the number of conflicts.
+func MergeFile(ctx context.Context, ours, base, theirs []byte, labels [3]string) ([]byte, int, error) {
+	dir, err := os.MkdirTemp("", "couchfusion-merge-")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create merge directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := [3]string{filepath.Join(dir, "ours"), filepath.Join(dir, "base"), filepath.Join(dir, "theirs")}
+	for i, content := range [][]byte{ours, base, theirs} {
+		if err := os.WriteFile(paths[i], content, 0o600); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "merge-file", "-p",
+		"-L", labels[0], "-L", labels[1], "-L", labels[2],
+		paths[0], paths[1], paths[2])
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err == nil {
+		return stdout.Bytes(), 0, nil
+	}
+
+	// A positive exit status below 128 is the number of conflicts.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code > 0 && code < 128 {
+			return stdout.Bytes(), code, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("git merge-file failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+}
@@ -0,0 +1,107 @@
+package gitutil
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress is one update parsed from git's --progress output, such as
+// "Receiving objects:  42% (420/1000), 1.20 MiB | 2.40 MiB/s".
+type Progress struct {
+	// Phase is git's label, e.g. "Receiving objects" or "Resolving deltas".
+	Phase   string
+	Percent float64 // 0..1
+	Current int
+	Total   int
+	// Transferred and Throughput are git's own strings ("1.20 MiB",
+	// "2.40 MiB/s"); they are empty for phases without a transfer.
+	Transferred string
+	Throughput  string
+	// ETA estimates the remaining time of the phase from its rate so far; zero
+	// when unknown.
+	ETA  time.Duration
+	Done bool
+}
+
+// WithProgress runs network git commands with --progress and reports each parsed
+// progress update to fn instead of writing it to stderr. fn is called from the
+// goroutine running git.
+func WithProgress(fn func(Progress)) CloneOption {
+	return func(cfg *cloneConfig) {
+		cfg.progress = fn
+	}
+}
+
+var progressPattern = regexp.MustCompile(`^(?:remote: )?([A-Za-z][A-Za-z ]*):\s+(\d+)% \((\d+)/(\d+)\)(?:, ([\d.]+ [KMGT]?i?B)(?: \| ([\d.]+ [KMGT]?i?B/s))?)?(?:, done\.)?`)
+
+// progressWriter splits git's stderr on carriage returns and newlines, reports
+// progress lines through fn and forwards everything else to out.
+type progressWriter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	fn      func(Progress)
+	buf     bytes.Buffer
+	phase   string
+	started time.Time
+	now     func() time.Time
+}
+
+func newProgressWriter(out io.Writer, fn func(Progress)) *progressWriter {
+	return &progressWriter{out: out, fn: fn, now: time.Now}
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	for {
+		data := w.buf.Bytes()
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := string(data[:i])
+		w.buf.Next(i + 1)
+		w.handle(line)
+	}
+	return len(p), nil
+}
+
+func (w *progressWriter) handle(line string) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return
+	}
+	m := progressPattern.FindStringSubmatch(trimmed)
+	if m == nil {
+		_, _ = io.WriteString(w.out, trimmed+"\n")
+		return
+	}
+
+	percent, _ := strconv.Atoi(m[2])
+	current, _ := strconv.Atoi(m[3])
+	total, _ := strconv.Atoi(m[4])
+	update := Progress{
+		Phase:       m[1],
+		Percent:     float64(percent) / 100,
+		Current:     current,
+		Total:       total,
+		Transferred: m[5],
+		Throughput:  m[6],
+		Done:        strings.HasSuffix(trimmed, "done.") || current == total,
+	}
+
+	now := w.now()
+	if update.Phase != w.phase {
+		w.phase, w.started = update.Phase, now
+	}
+	if elapsed := now.Sub(w.started); current > 0 && current < total && elapsed > 0 {
+		update.ETA = time.Duration(float64(elapsed) * float64(total-current) / float64(current)).Round(time.Second)
+	}
+	w.fn(update)
+}
@@ -0,0 +1,201 @@
+package gitutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nuxt-apps/couchfusion/internal/source"
+)
+
+// RemoteRef is a branch or tag advertised by a repository.
+type RemoteRef struct {
+	Name string
+	// Tag is true for tags and false for branches.
+	Tag bool
+}
+
+// ListRemoteRefs returns the branches and tags of repoURL using git ls-remote,
+// branches first. Local git repositories are listed directly; local sources
+// without history have no refs and return nil. Offline mode lists the cached mirror.
+func ListRemoteRefs(ctx context.Context, repoURL, protocol string, authPrompt bool, opts ...CloneOption) ([]RemoteRef, error) {
+	cfg := buildCloneConfig(opts)
+
+	target, remote := repoURL, true
+	switch {
+	case source.IsLocal(repoURL):
+		path, err := source.ResolvePath(repoURL)
+		if err != nil {
+			return nil, err
+		}
+		if !isGitRepository(path) {
+			return nil, nil
+		}
+		target, remote = path, false
+	case cfg.offline:
+		if cfg.cacheDir == "" {
+			return nil, fmt.Errorf("offline mode requires the repository cache")
+		}
+		mirror := filepath.Join(cfg.cacheDir, CacheKey(repoURL))
+		if !isMirror(mirror) {
+			return nil, fmt.Errorf("offline mode: no cached copy of %s (run `couchfusion cache update` while online)", repoURL)
+		}
+		target, remote = mirror, false
+	}
+
+	var out bytes.Buffer
+	build := func() *exec.Cmd {
+		out.Reset()
+		cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", "--tags", target)
+		cmd.Stdout = &out
+		cmd.Stderr = cfg.stderr
+		return cmd
+	}
+	var err error
+	if remote {
+		err = runRemote(ctx, cfg, repoURL, protocol, authPrompt, build)
+	} else {
+		err = build().Run()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git ls-remote %s failed: %w", repoURL, err)
+	}
+	return parseRemoteRefs(out.String()), nil
+}
+
+func parseRemoteRefs(out string) []RemoteRef {
+	var branches, tags []RemoteRef
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		name := strings.TrimSuffix(fields[1], "^{}")
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if branch, ok := strings.CutPrefix(name, "refs/heads/"); ok {
+			branches = append(branches, RemoteRef{Name: branch})
+		} else if tag, ok := strings.CutPrefix(name, "refs/tags/"); ok {
+			tags = append(tags, RemoteRef{Name: tag, Tag: true})
+		}
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name < branches[j].Name })
+	// Newest-looking tags first.
+	sort.SliceStable(tags, func(i, j int) bool { return newerTag(tags[i].Name, tags[j].Name) })
+	return append(branches, tags...)
+}
+
+// newerTag orders tags newest first: version tags such as v1.10.0 by their
+// numbers, ahead of other tags, which are in descending string order.
+func newerTag(a, b string) bool {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	switch {
+	case okA && okB:
+		if c := compareVersions(va, vb); c != 0 {
+			return c > 0
+		}
+	case okA != okB:
+		return okA
+	}
+	return a > b
+}
+
+// tagVersion is a tag of the form [v]MAJOR[.MINOR[.PATCH...]][-PRERELEASE].
+type tagVersion struct {
+	numbers    []int
+	prerelease string
+}
+
+func parseVersion(tag string) (tagVersion, bool) {
+	core := strings.TrimPrefix(strings.TrimPrefix(tag, "v"), "V")
+	core, _, _ = strings.Cut(core, "+")
+	core, prerelease, _ := strings.Cut(core, "-")
+	if core == "" {
+		return tagVersion{}, false
+	}
+	var numbers []int
+	for _, part := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || part[0] == '+' {
+			return tagVersion{}, false
+		}
+		numbers = append(numbers, n)
+	}
+	return tagVersion{numbers: numbers, prerelease: prerelease}, true
+}
+
+// compareVersions compares numbers first, missing ones counting as 0; a
+// prerelease is older than its release.
+func compareVersions(a, b tagVersion) int {
+	for i := 0; i < max(len(a.numbers), len(b.numbers)); i++ {
+		var x, y int
+		if i < len(a.numbers) {
+			x = a.numbers[i]
+		}
+		if i < len(b.numbers) {
+			y = b.numbers[i]
+		}
+		if x != y {
+			if x > y {
+				return 1
+			}
+			return -1
+		}
+	}
+	switch {
+	case a.prerelease == b.prerelease:
+		return 0
+	case a.prerelease == "":
+		return 1
+	case b.prerelease == "":
+		return -1
+	}
+	return strings.Compare(a.prerelease, b.prerelease)
+}
+
+// CheckRef verifies that ref names a branch or tag of repoURL before anything is
+// cloned. Empty refs, refs that look like commit SHAs and local sources without
+// history are accepted unchecked; the clone tells SHAs from branch or tag names.
+func CheckRef(ctx context.Context, repoURL, ref, protocol string, authPrompt bool, opts ...CloneOption) error {
+	if ref == "" || IsCommitSHA(ref) {
+		return nil
+	}
+	refs, err := ListRemoteRefs(ctx, repoURL, protocol, authPrompt, opts...)
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	var branches []string
+	for _, r := range refs {
+		if r.Name == ref {
+			return nil
+		}
+		if !r.Tag {
+			branches = append(branches, r.Name)
+		}
+	}
+	if len(branches) > 10 {
+		branches = append(branches[:10], "...")
+	}
+	return fmt.Errorf("branch or tag '%s' not found in %s (branches: %s)", ref, repoURL, strings.Join(branches, ", "))
+}
+
+func isGitRepository(path string) bool {
+	if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		return true
+	}
+	return isMirror(path)
+}
@@ -0,0 +1,57 @@
+package gitutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRemoteRefs(t *testing.T) {
+	out := `1111111 refs/heads/main
+2222222 refs/heads/dev
+3333333 refs/tags/v1.9.0
+4444444 refs/tags/v1.10.0
+4444444 refs/tags/v1.10.0^{}
+5555555 refs/tags/v1.10.0-rc.1
+6666666 refs/tags/v2
+7777777 refs/tags/nightly
+8888888 refs/tags/alpha
+9999999 refs/pull/1/head
+`
+	want := []RemoteRef{
+		{Name: "dev"},
+		{Name: "main"},
+		{Name: "v2", Tag: true},
+		{Name: "v1.10.0", Tag: true},
+		{Name: "v1.10.0-rc.1", Tag: true},
+		{Name: "v1.9.0", Tag: true},
+		{Name: "nightly", Tag: true},
+		{Name: "alpha", Tag: true},
+	}
+	if got := parseRemoteRefs(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRemoteRefs() = %v, want %v", got, want)
+	}
+}
+
+func TestNewerTag(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"v1.10", "v1.9", true},
+		{"v1.9", "v1.10", false},
+		{"1.2.3", "v1.2.2", true},
+		{"v1.2", "v1.2.0-beta", true},
+		{"v1.2.0-beta", "v1.2.0-alpha", true},
+		{"v1.2.0", "v1.2", true},
+		{"v1.2", "v1.2.0", false},
+		{"v0.1", "release", true},
+		{"release", "v0.1", false},
+		{"release", "nightly", true},
+		{"v1.x", "v1.2", false},
+	}
+	for _, tt := range tests {
+		if got := newerTag(tt.a, tt.b); got != tt.want {
+			t.Errorf("newerTag(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package gitutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nuxt-apps/couchfusion/internal/source"
+)
+
+// Run executes git with args inside dir and returns its trimmed stdout. Failures
+// include git's stderr in the error.
+func Run(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return strings.TrimSpace(string(out)), fmt.Errorf("git %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Fetch fetches ref from repoURL into the existing repository at repoDir and
+// returns the fetched commit. It honours the cache and offline options like Clone.
+func Fetch(ctx context.Context, repoURL, ref, repoDir string, protocol string, authPrompt bool, opts ...CloneOption) (string, error) {
+	cfg := buildCloneConfig(opts)
+
+	fetchURL := repoURL
+	auth := authFor(cfg, repoURL, protocol, authPrompt)
+	switch {
+	case source.IsLocal(repoURL):
+		path, err := source.ResolvePath(repoURL)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+			return "", fmt.Errorf("%s is not a git repository; local sources can only be copied", repoURL)
+		}
+		fetchURL = path
+	case cfg.useCache():
+		mirror, err := prepareMirror(ctx, cfg, repoURL, protocol, authPrompt)
+		if err != nil {
+			if cfg.offline {
+				return "", err
+			}
+			cfg.logf("Cache unavailable (%v); fetching directly from %s", err, repoURL)
+		} else {
+			fetchURL, auth = mirror, nil
+		}
+	case cfg.offline:
+		return "", fmt.Errorf("offline mode requires the repository cache")
+	}
+	if fetchURL == repoURL {
+		if err := CheckSSH(ctx, repoURL); err != nil {
+			return "", err
+		}
+	}
+
+	cfg.logf("Fetching %s from %s", ref, repoURL)
+	args := append([]string{"fetch", "--no-tags"}, cfg.progressArgs()...)
+	args = append(args, fetchURL, ref)
+	err := auth.run(ctx, func() *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = repoDir
+		cmd.Stdout = cfg.stdout
+		cmd.Stderr = cfg.stderr
+		return cmd
+	})
+	if err != nil {
+		return "", fmt.Errorf("git fetch %s failed: %w", ref, err)
+	}
+	return Run(ctx, repoDir, "rev-parse", "FETCH_HEAD^{commit}")
+}
+
+// DiffNameStatus maps paths changed between two tree-ish revisions to their
+// status letter (A, M or D). Renames are reported as a delete and an add.
+func DiffNameStatus(ctx context.Context, dir, from, to string) (map[string]string, error) {
+	out, err := Run(ctx, dir, "diff", "--no-renames", "--name-status", "-z", from, to)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]string{}
+	fields := strings.Split(strings.TrimRight(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		changes[fields[i+1]] = fields[i][:1]
+	}
+	return changes, nil
+}
+
+// UnmergedPaths lists paths left in conflict by a merge, sorted.
+func UnmergedPaths(ctx context.Context, dir string) ([]string, error) {
+	out, err := Run(ctx, dir, "diff", "--name-only", "--diff-filter=U", "-z")
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, p := range strings.Split(out, "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// IsClean reports whether the working tree at dir has no staged or unstaged
+// changes to tracked files.
+func IsClean(ctx context.Context, dir string) (bool, error) {
+	out, err := Run(ctx, dir, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return false, err
+	}
+	return out == "", nil
+}
+
+// ReadBlob returns the content of path at the tree-ish rev in the repository at dir.
+func ReadBlob(ctx context.Context, dir, rev, path string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", "cat-file", "blob", rev+":"+path)
+	cmd.Dir = dir
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file %s:%s failed: %v: %s", rev, path, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
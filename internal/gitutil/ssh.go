@@ -0,0 +1,154 @@
+package gitutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	sshCheckMu   sync.Mutex
+	sshCheckDone = map[string]bool{}
+)
+
+// runRemote runs a git command that talks to repoURL, checking SSH prerequisites
+// first and supplying HTTPS credentials when configured.
+func runRemote(ctx context.Context, cfg cloneConfig, repoURL, protocol string, authPrompt bool, build func() *exec.Cmd) error {
+	if err := CheckSSH(ctx, repoURL); err != nil {
+		return err
+	}
+	return authFor(cfg, repoURL, protocol, authPrompt).run(ctx, build)
+}
+
+// CheckSSH verifies that an SSH remote can be reached without interactive
+// prompts: an agent identity or key file must be available and the host key must
+// already be known. Non-SSH URLs pass; successful hosts are checked once per process.
+func CheckSSH(ctx context.Context, repoURL string) error {
+	r, ok := parseRemoteURL(repoURL)
+	if !ok || r.scheme != "ssh" {
+		return nil
+	}
+
+	target := r.host
+	if r.user != "" {
+		target = r.user + "@" + r.host
+	}
+	key := target + ":" + r.port
+
+	sshCheckMu.Lock()
+	defer sshCheckMu.Unlock()
+	if sshCheckDone[key] {
+		return nil
+	}
+
+	if _, err := exec.LookPath("ssh"); err != nil {
+		return fmt.Errorf("%s uses SSH but no ssh client was found in PATH", repoURL)
+	}
+
+	args := []string{"-G"}
+	if r.port != "" {
+		args = append(args, "-p", r.port)
+	}
+	args = append(args, target)
+	out, err := exec.CommandContext(ctx, "ssh", args...).Output()
+	if err != nil {
+		return fmt.Errorf("failed to resolve ssh configuration for %s: %w", r.host, err)
+	}
+	settings := parseSSHConfig(string(out))
+
+	if !hasSSHIdentity(ctx, settings["identityfile"]) {
+		return fmt.Errorf("no SSH key available for %s: start ssh-agent and add a key with `ssh-add`, create one with `ssh-keygen`, or switch the repository to protocol https", r.host)
+	}
+
+	switch first(settings["stricthostkeychecking"]) {
+	case "no", "off", "accept-new":
+		// ssh accepts unknown hosts itself.
+	default:
+		if !hostKeyKnown(ctx, settings) {
+			hostname, port := first(settings["hostname"]), first(settings["port"])
+			return fmt.Errorf("host key for %s is not in known_hosts; verify the fingerprint and add it with `ssh-keyscan -p %s %s >> ~/.ssh/known_hosts`", hostname, port, hostname)
+		}
+	}
+
+	sshCheckDone[key] = true
+	return nil
+}
+
+// parseSSHConfig reads `ssh -G` output into lower-case keys with every value
+// seen for that key.
+func parseSSHConfig(out string) map[string][]string {
+	settings := map[string][]string{}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(key)
+		settings[key] = append(settings[key], strings.TrimSpace(value))
+	}
+	return settings
+}
+
+func hasSSHIdentity(ctx context.Context, identityFiles []string) bool {
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		// ssh-add -l exits 0 only when the agent holds at least one identity.
+		if err := exec.CommandContext(ctx, "ssh-add", "-l").Run(); err == nil {
+			return true
+		}
+	}
+	for _, file := range identityFiles {
+		if _, err := os.Stat(expandHome(file)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hostKeyKnown(ctx context.Context, settings map[string][]string) bool {
+	name := first(settings["hostkeyalias"])
+	if name == "" || name == "none" {
+		name = first(settings["hostname"])
+	}
+	if port := first(settings["port"]); port != "" && port != "22" {
+		name = fmt.Sprintf("[%s]:%s", name, port)
+	}
+
+	var files []string
+	for _, key := range []string{"userknownhostsfile", "globalknownhostsfile"} {
+		for _, value := range settings[key] {
+			files = append(files, strings.Fields(value)...)
+		}
+	}
+	for _, file := range files {
+		file = expandHome(file)
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		if err := exec.CommandContext(ctx, "ssh-keygen", "-F", name, "-f", file).Run(); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
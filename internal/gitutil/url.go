@@ -0,0 +1,135 @@
+package gitutil
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// remoteURL is a git remote location split into its parts. Path never starts
+// with a slash.
+type remoteURL struct {
+	scheme string // ssh, https or http
+	user   string
+	host   string
+	port   string
+	path   string
+}
+
+// scpURLPattern matches the scp-like SSH syntax [user@]host:path. Single-letter
+// hosts are rejected so Windows drive letters are not mistaken for hosts.
+var scpURLPattern = regexp.MustCompile(`^(?:([^@/:]+)@)?([^@/:]{2,}):([^/].*)$`)
+
+func parseRemoteURL(raw string) (remoteURL, bool) {
+	raw = strings.TrimSpace(raw)
+	if m := scpURLPattern.FindStringSubmatch(raw); m != nil && !strings.Contains(raw, "://") {
+		return remoteURL{scheme: "ssh", user: m[1], host: m[2], path: m[3]}, true
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return remoteURL{}, false
+	}
+	switch u.Scheme {
+	case "ssh", "git+ssh", "ssh+git":
+		u.Scheme = "ssh"
+	case "https", "http":
+	default:
+		return remoteURL{}, false
+	}
+	r := remoteURL{scheme: u.Scheme, host: u.Hostname(), port: u.Port(), path: strings.TrimPrefix(u.Path, "/")}
+	if u.User != nil {
+		r.user = u.User.Username()
+	}
+	return r, true
+}
+
+// SSHOptions adjusts the SSH form produced by RewriteURL. Zero values keep the
+// URL's own user, host and port (user defaults to "git").
+type SSHOptions struct {
+	User string
+	Host string
+	Port int
+}
+
+// RewriteURL converts repository URLs between the SSH forms
+// (git@host:org/repo.git, ssh://git@host:port/org/repo.git) and
+// https://host/org/repo.git according to protocol ("ssh" or "https"). Local paths,
+// unknown schemes and an empty protocol leave raw unchanged; plain http URLs are
+// kept when https is requested.
+func RewriteURL(raw, protocol string, opts SSHOptions) string {
+	r, ok := parseRemoteURL(raw)
+	if !ok {
+		return raw
+	}
+
+	switch protocol {
+	case "ssh":
+		user, host, port := opts.User, opts.Host, ""
+		if user == "" && r.scheme == "ssh" {
+			user = r.user
+		}
+		if user == "" {
+			user = "git"
+		}
+		if host == "" {
+			host = r.host
+		}
+		if opts.Port > 0 {
+			port = strconv.Itoa(opts.Port)
+		} else if r.scheme == "ssh" {
+			port = r.port
+		}
+		if port != "" && port != "22" {
+			return fmt.Sprintf("ssh://%s@%s:%s/%s", user, host, port, r.path)
+		}
+		return fmt.Sprintf("%s@%s:%s", user, host, r.path)
+	case "https":
+		if r.scheme != "ssh" {
+			return raw
+		}
+		return fmt.Sprintf("https://%s/%s", r.host, r.path)
+	default:
+		return raw
+	}
+}
+
+// URLHost returns the host name of a git remote URL, or an empty string for
+// local paths.
+func URLHost(raw string) string {
+	r, ok := parseRemoteURL(raw)
+	if !ok {
+		return ""
+	}
+	return r.host
+}
+
+// URLProtocol returns the protocol of a git remote URL: "ssh" for the SSH forms,
+// "https" for http and https URLs, and an empty string for local paths.
+func URLProtocol(raw string) string {
+	r, ok := parseRemoteURL(raw)
+	switch {
+	case !ok:
+		return ""
+	case r.scheme == "ssh":
+		return "ssh"
+	default:
+		return "https"
+	}
+}
+
+// SameRepository reports whether a and b point at the same repository,
+// regardless of protocol, user or a trailing ".git".
+func SameRepository(a, b string) bool {
+	ra, okA := parseRemoteURL(a)
+	rb, okB := parseRemoteURL(b)
+	if !okA || !okB {
+		return a == b
+	}
+	trim := func(path string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(path, "/"), ".git")
+	}
+	return strings.EqualFold(ra.host, rb.host) && trim(ra.path) == trim(rb.path)
+}
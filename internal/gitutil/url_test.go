@@ -0,0 +1,77 @@
+package gitutil
+
+import "testing"
+
+func TestRewriteURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		protocol string
+		opts     SSHOptions
+		want     string
+	}{
+		{"https to ssh", "https://github.com/org/repo.git", "ssh", SSHOptions{}, "git@github.com:org/repo.git"},
+		{"ssh to https", "git@github.com:org/repo.git", "https", SSHOptions{}, "https://github.com/org/repo.git"},
+		{"ssh url to https", "ssh://git@host:2222/org/repo.git", "https", SSHOptions{}, "https://host/org/repo.git"},
+		{"ssh keeps user and port", "ssh://deploy@host:2222/org/repo.git", "ssh", SSHOptions{}, "ssh://deploy@host:2222/org/repo.git"},
+		{"ssh default port", "ssh://git@host:22/org/repo.git", "ssh", SSHOptions{}, "git@host:org/repo.git"},
+		{"ssh options", "https://github.com/org/repo.git", "ssh", SSHOptions{User: "git", Host: "ssh.github.com", Port: 443}, "ssh://git@ssh.github.com:443/org/repo.git"},
+		{"https stays https", "https://github.com/org/repo.git", "https", SSHOptions{}, "https://github.com/org/repo.git"},
+		{"http kept for https", "http://git.local/org/repo.git", "https", SSHOptions{}, "http://git.local/org/repo.git"},
+		{"empty protocol", "git@github.com:org/repo.git", "", SSHOptions{}, "git@github.com:org/repo.git"},
+		{"local path", "/srv/starters/app", "ssh", SSHOptions{}, "/srv/starters/app"},
+		{"windows path", `C:\starters\app`, "https", SSHOptions{}, `C:\starters\app`},
+		{"unknown scheme", "file:///srv/app.git", "ssh", SSHOptions{}, "file:///srv/app.git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RewriteURL(tt.raw, tt.protocol, tt.opts); got != tt.want {
+				t.Errorf("RewriteURL(%q, %q) = %q, want %q", tt.raw, tt.protocol, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLHostAndProtocol(t *testing.T) {
+	tests := []struct {
+		raw          string
+		wantHost     string
+		wantProtocol string
+	}{
+		{"https://github.com/org/repo.git", "github.com", "https"},
+		{"http://git.local:8080/org/repo.git", "git.local", "https"},
+		{"git@gitlab.com:org/repo.git", "gitlab.com", "ssh"},
+		{"ssh://git@host:2222/org/repo.git", "host", "ssh"},
+		{"git+ssh://host/org/repo.git", "host", "ssh"},
+		{"/srv/starters/app", "", ""},
+		{"../starters/app", "", ""},
+	}
+	for _, tt := range tests {
+		if got := URLHost(tt.raw); got != tt.wantHost {
+			t.Errorf("URLHost(%q) = %q, want %q", tt.raw, got, tt.wantHost)
+		}
+		if got := URLProtocol(tt.raw); got != tt.wantProtocol {
+			t.Errorf("URLProtocol(%q) = %q, want %q", tt.raw, got, tt.wantProtocol)
+		}
+	}
+}
+
+func TestSameRepository(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"https://github.com/org/repo.git", "git@github.com:org/repo.git", true},
+		{"https://github.com/org/repo", "ssh://deploy@github.com:2222/org/repo.git", true},
+		{"https://GitHub.com/org/repo.git", "https://github.com/org/repo/", true},
+		{"https://github.com/org/repo.git", "https://github.com/org/other.git", false},
+		{"https://github.com/org/repo.git", "https://gitlab.com/org/repo.git", false},
+		{"/srv/starters/app", "/srv/starters/app", true},
+		{"/srv/starters/app", "https://github.com/srv/starters/app", false},
+	}
+	for _, tt := range tests {
+		if got := SameRepository(tt.a, tt.b); got != tt.want {
+			t.Errorf("SameRepository(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package source
+
+import "testing"
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{"*.log", `[^/]*\.log`},
+		{"file?.txt", `file[^/]\.txt`},
+		{"**/cache", `(?:.*/)?cache`},
+		{"build/**", `build/.*`},
+		{"[abc].md", `[abc]\.md`},
+		{"[!abc].md", `[^abc]\.md`},
+		{"[unclosed", `\[unclosed`},
+	}
+	for _, tt := range tests {
+		if got := globToRegexp(tt.glob); got != tt.want {
+			t.Errorf("globToRegexp(%q) = %q, want %q", tt.glob, got, tt.want)
+		}
+	}
+}
+
+func TestParseIgnore(t *testing.T) {
+	m := parseIgnore([]byte(`# comments and blank lines are skipped
+
+*.log
+!keep.log
+node_modules/
+/dist
+docs/**/draft.md
+\#literal
+`))
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"debug.log", false, true},
+		{"nested/deep/debug.log", false, true},
+		{"keep.log", false, false},
+		{"nested/keep.log", false, false},
+		{"node_modules", true, true},
+		{"app/node_modules", true, true},
+		{"node_modules", false, false},
+		{"dist", true, true},
+		{"app/dist", true, false},
+		{"docs/draft.md", false, true},
+		{"docs/a/b/draft.md", false, true},
+		{"draft.md", false, false},
+		{"#literal", false, true},
+		{"README.md", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
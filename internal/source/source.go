@@ -0,0 +1,335 @@
+// Package source materializes starter templates that live on the local
+// filesystem (plain directories, file:// URLs and .tar.gz/.zip archives)
+// instead of a git remote.
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// scpLike matches git's scp-style remote syntax, e.g. git@github.com:org/repo.git.
+var scpLike = regexp.MustCompile(`^[\w.-]+@[\w.-]+:`)
+
+// IsLocal reports whether raw points at a local directory, file:// URL or archive
+// that should be copied rather than cloned. Bare git repositories on disk are
+// still treated as git remotes.
+func IsLocal(raw string) bool {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return false
+	}
+	if strings.HasPrefix(raw, "file://") {
+		return true
+	}
+	if strings.Contains(raw, "://") || scpLike.MatchString(raw) {
+		return false
+	}
+	if isArchive(raw) {
+		return true
+	}
+
+	path, err := ResolvePath(raw)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	return !isBareRepo(path)
+}
+
+// ResolvePath converts a local source reference into an absolute filesystem path.
+func ResolvePath(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "file://") {
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid file url %s: %w", raw, err)
+		}
+		raw = parsed.Path
+		if filepath.VolumeName(strings.TrimPrefix(raw, "/")) != "" {
+			// file:///C:/path on Windows
+			raw = strings.TrimPrefix(raw, "/")
+		}
+	}
+	if strings.HasPrefix(raw, "~") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to resolve home directory: %w", err)
+		}
+		raw = filepath.Join(home, strings.TrimPrefix(raw, "~"))
+	}
+	return filepath.Abs(filepath.FromSlash(raw))
+}
+
+// Fetch copies or extracts the source at raw into targetDir. Paths matched by the
+// source's root .gitignore, as well as any .git directory, are skipped.
+func Fetch(raw, targetDir string, logf func(string, ...any)) error {
+	path, err := ResolvePath(raw)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("local source %s not found: %w", raw, err)
+	}
+
+	root := path
+	if !info.IsDir() {
+		if !isArchive(path) {
+			return fmt.Errorf("local source %s must be a directory, .tar.gz/.tgz or .zip archive", raw)
+		}
+		tmp, err := os.MkdirTemp("", "couchfusion-source-")
+		if err != nil {
+			return fmt.Errorf("failed to create extraction directory: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+
+		logf("Extracting %s", path)
+		if err := extract(path, tmp); err != nil {
+			return err
+		}
+		root, err = archiveRoot(tmp)
+		if err != nil {
+			return err
+		}
+	}
+
+	logf("Copying local source %s into %s", root, targetDir)
+	return copyTree(root, targetDir)
+}
+
+func copyTree(root, targetDir string) error {
+	matcher, err := loadIgnoreFile(filepath.Join(root, ".gitignore"))
+	if err != nil {
+		return fmt.Errorf("failed to read .gitignore in %s: %w", root, err)
+	}
+
+	if err := os.MkdirAll(targetDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", targetDir, err)
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		slashRel := filepath.ToSlash(rel)
+		if d.Name() == ".git" || matcher.Match(slashRel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		dest := filepath.Join(targetDir, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(dest, info.Mode().Perm()|0o700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, dest)
+		case info.Mode().IsRegular():
+			return copyFile(path, dest, info.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
+
+func copyFile(src, dest string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dest, in, perm)
+}
+
+func writeFile(dest string, r io.Reader, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func isArchive(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") || strings.HasSuffix(lower, ".zip")
+}
+
+func isBareRepo(path string) bool {
+	if _, err := os.Stat(filepath.Join(path, "HEAD")); err != nil {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(path, "objects"))
+	return err == nil && info.IsDir()
+}
+
+func extract(archive, dest string) error {
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		return extractZip(archive, dest)
+	}
+	return extractTarGz(archive, dest)
+}
+
+func extractTarGz(archive, dest string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", archive, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", archive, err)
+		}
+
+		target, err := safeJoin(dest, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, fs.FileMode(header.Mode).Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// Links may only point inside the extraction directory, so
+			// later entries cannot be written through them.
+			if filepath.IsAbs(header.Linkname) {
+				return fmt.Errorf("archive symlink %q points outside the extraction directory", header.Name)
+			}
+			if _, err := safeJoin(dest, filepath.ToSlash(filepath.Join(filepath.Dir(header.Name), header.Linkname))); err != nil {
+				return fmt.Errorf("archive symlink %q points outside the extraction directory", header.Name)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractZip(archive, dest string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", archive, err)
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		target, err := safeJoin(dest, file.Name)
+		if err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, rc, file.Mode().Perm())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeJoin rejects archive entries that would escape the extraction directory,
+// by name or by being written through a symlink extracted earlier.
+func safeJoin(dest, name string) (string, error) {
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dest, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %q escapes the extraction directory", name)
+	}
+	if rel == "." {
+		return target, nil
+	}
+	path := dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("archive entry %q is written through the symlink %s", name, filepath.ToSlash(strings.TrimPrefix(path, dest+string(filepath.Separator))))
+		}
+	}
+	return target, nil
+}
+
+// archiveRoot strips a single top-level directory, as produced by GitHub/GitLab
+// source downloads.
+func archiveRoot(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dir, entries[0].Name()), nil
+	}
+	return dir, nil
+}
@@ -0,0 +1,141 @@
+package source
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+}
+
+func writeTarGz(t *testing.T, path string, entries []tarEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Linkname: entry.linkname, Mode: 0o644, Size: int64(len(entry.body))}
+		if entry.typeflag == tar.TypeDir {
+			header.Mode = 0o755
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractTarGz(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries func(outside string) []tarEntry
+		wantErr string
+		check   func(t *testing.T, dest string)
+	}{
+		{
+			name: "files and inner symlink",
+			entries: func(string) []tarEntry {
+				return []tarEntry{
+					{name: "app/sub/", typeflag: tar.TypeDir},
+					{name: "app/sub/y", typeflag: tar.TypeReg, body: "y"},
+					{name: "app/link", typeflag: tar.TypeSymlink, linkname: "sub/y"},
+				}
+			},
+			check: func(t *testing.T, dest string) {
+				data, err := os.ReadFile(filepath.Join(dest, "app", "link"))
+				if err != nil || string(data) != "y" {
+					t.Fatalf("app/link = %q, %v; want y", data, err)
+				}
+			},
+		},
+		{
+			name: "entry name escapes",
+			entries: func(string) []tarEntry {
+				return []tarEntry{{name: "../evil", typeflag: tar.TypeReg, body: "x"}}
+			},
+			wantErr: "escapes the extraction directory",
+		},
+		{
+			name: "absolute symlink",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{
+					{name: "a", typeflag: tar.TypeSymlink, linkname: outside},
+					{name: "a/passwd", typeflag: tar.TypeReg, body: "x"},
+				}
+			},
+			wantErr: "points outside the extraction directory",
+		},
+		{
+			name: "relative symlink escapes",
+			entries: func(string) []tarEntry {
+				return []tarEntry{
+					{name: "app/a", typeflag: tar.TypeSymlink, linkname: "../../outside"},
+					{name: "app/a/passwd", typeflag: tar.TypeReg, body: "x"},
+				}
+			},
+			wantErr: "points outside the extraction directory",
+		},
+		{
+			name: "write through inner symlink",
+			entries: func(string) []tarEntry {
+				return []tarEntry{
+					{name: "app/sub/", typeflag: tar.TypeDir},
+					{name: "app/l", typeflag: tar.TypeSymlink, linkname: "sub"},
+					{name: "app/l/x", typeflag: tar.TypeReg, body: "x"},
+				}
+			},
+			wantErr: "written through the symlink app/l",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			outside := filepath.Join(dir, "outside")
+			if err := os.Mkdir(outside, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			archive := filepath.Join(dir, "src.tar.gz")
+			writeTarGz(t, archive, tt.entries(outside))
+			dest := filepath.Join(dir, "dest")
+			if err := os.Mkdir(dest, 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := extractTarGz(archive, dest)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("extractTarGz() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("extractTarGz() error = %v", err)
+			}
+			if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+				t.Fatalf("extraction wrote outside the destination: %v", entries)
+			}
+			if tt.check != nil {
+				tt.check(t, dest)
+			}
+		})
+	}
+}
@@ -62,9 +62,18 @@ func (lb *LogBuffer) Errorf(format string, args ...any) {
 }
 
 func (lb *LogBuffer) Render() string {
+	return lb.RenderTail(0)
+}
+
+// RenderTail renders at most the last n events; n <= 0 renders everything.
+func (lb *LogBuffer) RenderTail(n int) string {
 	lb.mu.Lock()
-	events := make([]LogEvent, len(lb.events))
-	copy(events, lb.events)
+	start := 0
+	if n > 0 && len(lb.events) > n {
+		start = len(lb.events) - n
+	}
+	events := make([]LogEvent, len(lb.events)-start)
+	copy(events, lb.events[start:])
 	lb.mu.Unlock()
 
 	lines := make([]string, 0, len(events))
@@ -23,6 +23,12 @@ type hintProvider interface {
 	Hints() []string
 }
 
+// textCapturer is implemented by children that need plain keys such as 'q' for
+// free-text input; while CapturesText is true only ctrl+c quits.
+type textCapturer interface {
+	CapturesText() bool
+}
+
 func NewRootModel(title, subtitle string, child tea.Model, logs *LogBuffer, hints []string) *RootModel {
 	if logs == nil {
 		logs = NewLogBuffer(64)
@@ -46,10 +52,19 @@ func (m *RootModel) Init() tea.Cmd {
 func (m *RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		capturing := false
+		if c, ok := m.Child.(textCapturer); ok {
+			capturing = c.CapturesText()
+		}
 		switch msg.String() {
-		case "ctrl+c", "q":
+		case "ctrl+c":
 			m.quitting = true
 			return m, tea.Quit
+		case "q":
+			if !capturing {
+				m.quitting = true
+				return m, tea.Quit
+			}
 		}
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
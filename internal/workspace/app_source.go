@@ -0,0 +1,83 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nuxt-apps/couchfusion/internal/config"
+)
+
+// AppSource is an app recorded in a couchfusion.json that `new --from`
+// reproduces under another name.
+type AppSource struct {
+	Path    string
+	Name    string
+	Modules []string
+
+	starter    templateRevision
+	parameters []appParameter
+}
+
+// LoadAppSource reads the couchfusion.json at path, or inside the app
+// directory path.
+func LoadAppSource(path string) (*AppSource, error) {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(resolved); err == nil && info.IsDir() {
+		resolved = filepath.Join(resolved, appMetadataFileName)
+	}
+
+	meta, err := readAppMetadata(resolved)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s not found; --from takes an app directory or its %s", resolved, appMetadataFileName)
+		}
+		return nil, err
+	}
+	if meta.Starter.URL == "" {
+		return nil, fmt.Errorf("%s records no starter repository", resolved)
+	}
+	return &AppSource{
+		Path:       resolved,
+		Name:       meta.AppName,
+		Modules:    meta.Modules,
+		starter:    meta.Starter,
+		parameters: meta.Parameters,
+	}, nil
+}
+
+// Starter describes the recorded starter revision.
+func (s *AppSource) Starter() string {
+	if s.starter.Commit == "" {
+		return fmt.Sprintf("%s at %s", s.starter.URL, s.starter.Ref)
+	}
+	return fmt.Sprintf("%s at %s (commit %s)", s.starter.URL, valueOr(s.starter.Ref, "HEAD"), shortCommit(s.starter.Commit))
+}
+
+// runState prepares a `new` run of name that clones the recorded starter
+// commit, or overrideBranch when set.
+func (s *AppSource) runState(cfg *config.Config, name, overrideBranch string) (*runState, error) {
+	for _, module := range s.Modules {
+		if _, ok := cfg.Modules[module]; !ok {
+			return nil, fmt.Errorf("module '%s' of %s not found in config", module, s.Path)
+		}
+	}
+
+	state := newRunState("new", name, newAppSteps)
+	state.Modules = append([]string{}, s.Modules...)
+	state.Repo = s.starter.URL
+	if overrideBranch != "" {
+		state.Ref = overrideBranch
+	} else {
+		state.Ref, state.Commit = s.starter.Ref, s.starter.Commit
+	}
+	state.Source = s.Path
+	for _, param := range s.parameters {
+		state.setParameter(param.Module, param.Key, param.Value, param.Secret)
+	}
+	return state, nil
+}
@@ -0,0 +1,386 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/nuxt-apps/couchfusion/internal/config"
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+)
+
+// workspaceSpec is the declarative description of a workspace read by
+// `couchfusion apply -f workspace.yaml`.
+type workspaceSpec struct {
+	Layers layersSpec         `yaml:"layers"`
+	Apps   map[string]appSpec `yaml:"apps"`
+}
+
+type layersSpec struct {
+	// Branch is the layers ref the workspace should be recorded at in
+	// couchfusion.lock; a mismatch is reported as drift.
+	Branch string `yaml:"branch"`
+	// Selected lists the layers that must be present under /layers.
+	Selected []string `yaml:"selected"`
+}
+
+type appSpec struct {
+	Modules []string `yaml:"modules"`
+	// Branch is the starter ref new apps are created from.
+	Branch string `yaml:"branch"`
+	// Parameters holds per-module layer parameters, e.g. auth.username.
+	Parameters map[string]map[string]string `yaml:"parameters"`
+}
+
+// authParameters are the parameters the auth layer accepts; values are
+// expanded with environment variables so secrets stay out of the file.
+var authParameters = map[string]struct{}{"username": {}, "password": {}}
+
+// Change kinds reported by RunApply.
+const (
+	ApplyCreate    = "create"
+	ApplyUpdate    = "update"
+	ApplyUnchanged = "unchanged"
+	ApplyDrift     = "drift"
+)
+
+// ApplyChange is one difference between workspace.yaml and the workspace.
+type ApplyChange struct {
+	Kind   string
+	Path   string
+	Detail string
+}
+
+// ApplyReport lists what RunApply changed (or would change) and the drift it
+// cannot converge on its own.
+type ApplyReport struct {
+	Changes []ApplyChange
+}
+
+func (r *ApplyReport) add(kind, path, format string, args ...any) {
+	r.Changes = append(r.Changes, ApplyChange{Kind: kind, Path: path, Detail: fmt.Sprintf(format, args...)})
+}
+
+// HasDrift reports whether the workspace still differs from the spec in ways
+// apply does not fix.
+func (r *ApplyReport) HasDrift() bool {
+	for _, c := range r.Changes {
+		if c.Kind == ApplyDrift {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints one line per change and a summary.
+func (r *ApplyReport) Write(w io.Writer, dryRun bool) {
+	symbols := map[string]string{ApplyCreate: "+", ApplyUpdate: "~", ApplyUnchanged: "=", ApplyDrift: "!"}
+	counts := map[string]int{}
+	for _, c := range r.Changes {
+		counts[c.Kind]++
+		if c.Detail == "" {
+			fmt.Fprintf(w, "  %s %s\n", symbols[c.Kind], c.Path)
+		} else {
+			fmt.Fprintf(w, "  %s %s: %s\n", symbols[c.Kind], c.Path, c.Detail)
+		}
+	}
+	if dryRun {
+		fmt.Fprintf(w, "Plan: %d to create, %d to update, %d unchanged, %d drifted.\n", counts[ApplyCreate], counts[ApplyUpdate], counts[ApplyUnchanged], counts[ApplyDrift])
+		return
+	}
+	fmt.Fprintf(w, "Apply complete: %d created, %d updated, %d unchanged, %d drifted.\n", counts[ApplyCreate], counts[ApplyUpdate], counts[ApplyUnchanged], counts[ApplyDrift])
+}
+
+// loadWorkspaceSpec reads and validates a workspace spec against cfg.
+func loadWorkspaceSpec(path string, cfg *config.Config) (*workspaceSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	spec := &workspaceSpec{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(spec); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for name, app := range spec.Apps {
+		if sanitizeName(name) != name {
+			return nil, fmt.Errorf("%s: app name '%s' must be lowercase letters, digits and dashes", path, name)
+		}
+		for _, module := range app.Modules {
+			if _, ok := cfg.Modules[module]; !ok {
+				return nil, fmt.Errorf("%s: app '%s' uses module '%s', which is not in the config", path, name, module)
+			}
+		}
+		for module, params := range app.Parameters {
+			if !containsModule(app.Modules, module) {
+				return nil, fmt.Errorf("%s: app '%s' has parameters for module '%s', which it does not use", path, name, module)
+			}
+			if module != "auth" {
+				return nil, fmt.Errorf("%s: module '%s' takes no parameters", path, module)
+			}
+			for key := range params {
+				if _, ok := authParameters[key]; !ok {
+					return nil, fmt.Errorf("%s: unknown auth parameter '%s' for app '%s' (expected username, password)", path, key, name)
+				}
+			}
+		}
+	}
+	return spec, nil
+}
+
+// RunApply converges the workspace in the current directory on the spec at
+// specPath: missing layers are added, missing apps are created through RunNew
+// and existing apps gain or lose modules. Layer refs, starter refs and apps or
+// layers missing from the spec are only reported as drift. With dryRun nothing
+// is changed.
+func RunApply(ctx context.Context, cfg *config.Config, specPath string, dryRun bool, cloneOpts ...gitutil.CloneOption) (*ApplyReport, error) {
+	spec, err := loadWorkspaceSpec(specPath, cfg)
+	if err != nil {
+		return nil, err
+	}
+	root, manifest, err := openWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	report := &ApplyReport{}
+
+	if err := applyLayers(ctx, cfg, root, spec.Layers, report, dryRun, cloneOpts); err != nil {
+		return report, err
+	}
+
+	names := make([]string, 0, len(spec.Apps))
+	for name := range spec.Apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := applyApp(ctx, cfg, root, manifest, name, spec.Apps[name], report, dryRun, cloneOpts); err != nil {
+			return report, fmt.Errorf("app '%s': %w", name, err)
+		}
+	}
+
+	existing, err := listProjects(filepath.Join(root, "apps"))
+	if err != nil {
+		return report, err
+	}
+	for _, name := range existing {
+		if _, ok := spec.Apps[name]; !ok {
+			report.add(ApplyDrift, "apps/"+name, "not in %s", filepath.Base(specPath))
+		}
+	}
+	return report, nil
+}
+
+func applyLayers(ctx context.Context, cfg *config.Config, root string, spec layersSpec, report *ApplyReport, dryRun bool, cloneOpts []gitutil.CloneOption) error {
+	if spec.Branch != "" {
+		lock, err := loadLock(root)
+		if err != nil {
+			return err
+		}
+		if base, ok := lock.Entries[layersPrefix]; !ok {
+			report.add(ApplyDrift, layersPrefix, "no base revision recorded in %s", lockFileName)
+		} else if base.Ref != spec.Branch {
+			report.add(ApplyDrift, layersPrefix, "at %s, spec wants %s (run `couchfusion layers update --ref %s`)", valueOr(base.Ref, shortCommit(base.Commit)), spec.Branch, spec.Branch)
+		}
+	}
+	if len(spec.Selected) == 0 {
+		return nil
+	}
+
+	present, err := layerDirs(filepath.Join(root, layersPrefix))
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, name := range spec.Selected {
+		if !containsModule(present, name) {
+			missing = append(missing, name)
+		}
+	}
+	for _, name := range present {
+		if !containsModule(spec.Selected, name) {
+			report.add(ApplyDrift, "layers/"+name, "not selected in the spec")
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if !dryRun {
+		if err := RunLayersAdd(ctx, cfg, missing, cloneOpts...); err != nil {
+			return err
+		}
+	}
+	for _, name := range missing {
+		report.add(ApplyCreate, "layers/"+name, "")
+	}
+	return nil
+}
+
+func applyApp(ctx context.Context, cfg *config.Config, root string, manifest *workspaceManifest, name string, spec appSpec, report *ApplyReport, dryRun bool, cloneOpts []gitutil.CloneOption) error {
+	path := "apps/" + name
+	appDir := filepath.Join(root, "apps", name)
+	if params, ok := spec.Parameters["auth"]; ok {
+		ctx = WithAuthCredentials(ctx, os.ExpandEnv(params["username"]), os.ExpandEnv(params["password"]))
+	}
+
+	if _, err := os.Stat(appDir); errors.Is(err, os.ErrNotExist) {
+		modules := spec.Modules
+		if modules == nil {
+			modules = cfg.DefaultModuleSelection()
+		}
+		if !dryRun {
+			if err := RunNew(ctx, cfg, name, modules, spec.Branch, false, cloneOpts...); err != nil {
+				return err
+			}
+		}
+		report.add(ApplyCreate, path, "modules: %s", valueOr(strings.Join(modules, ", "), "none"))
+		return nil
+	}
+
+	meta, err := loadAppMetadata(appDir)
+	if err != nil {
+		return err
+	}
+	current := meta.Modules
+	if spec.Branch != "" {
+		if starter := meta.Starter; starter.Ref != spec.Branch {
+			report.add(ApplyDrift, path, "starter at %s, spec wants %s (run `couchfusion upgrade --ref %s %s`)", valueOr(starter.Ref, shortCommit(starter.Commit)), spec.Branch, spec.Branch, name)
+		}
+	}
+
+	// Without a modules list the spec does not manage the modules of an
+	// existing app; an explicit list, even an empty one, is enforced.
+	modules := spec.Modules
+	if modules == nil {
+		report.add(ApplyUnchanged, path, "")
+		return nil
+	}
+
+	var added, removed []string
+	for _, module := range modules {
+		if !containsModule(current, module) {
+			added = append(added, module)
+		}
+	}
+	for _, module := range current {
+		if !containsModule(modules, module) {
+			removed = append(removed, module)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		report.add(ApplyUnchanged, path, "")
+		return nil
+	}
+
+	if !dryRun {
+		if err := checkLayersPresent(root, added); err != nil {
+			return err
+		}
+		if err := updateAppModules(ctx, cfg, root, manifest, appDir, modules, added, removed); err != nil {
+			return err
+		}
+	}
+	report.add(ApplyUpdate, path, "modules %s", moduleChanges(added, removed))
+	return nil
+}
+
+// updateAppModules switches an existing app to modules: layer dependencies,
+// nuxt.config extends, couchfusion.json and docs/module_setup.json are
+// rewritten and parameters of added layers are configured. Every file is
+// restored when a step fails. The changes are left uncommitted for review.
+func updateAppModules(ctx context.Context, cfg *config.Config, root string, manifest *workspaceManifest, appDir string, modules, added, removed []string) error {
+	tx := editScaffold(appDir)
+	tx.state = newRunState("apply", filepath.Base(appDir), nil)
+	defer tx.rollback(ctx)
+	for _, name := range plannedProjectFiles {
+		if err := tx.preserveFile(filepath.Join(appDir, name)); err != nil {
+			return err
+		}
+	}
+
+	if err := removeLayerDependencies(appDir, removed); err != nil {
+		return err
+	}
+	if err := updateLayerDependencies(appDir, added, manifest.PackageWorkspaces); err != nil {
+		return err
+	}
+	if err := applyLayerParameters(ctx, tx, added); err != nil {
+		return err
+	}
+	if err := updateNuxtExtends(appDir, modules); err != nil {
+		return err
+	}
+	layers, err := layerRevisions(root, added)
+	if err != nil {
+		return err
+	}
+	err = editAppMetadata(appDir, func(meta *appMetadata) {
+		meta.setModules(modules, layers)
+		meta.setParameters(tx.state.Parameters)
+		meta.addDatabases(tx.state.Databases)
+		meta.record("apply", "modules "+moduleChanges(added, removed))
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeModuleSetup(appDir, cfg, modules); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// moduleChanges formats added and removed modules as "+a -b".
+func moduleChanges(added, removed []string) string {
+	changes := make([]string, 0, len(added)+len(removed))
+	for _, module := range added {
+		changes = append(changes, "+"+module)
+	}
+	for _, module := range removed {
+		changes = append(changes, "-"+module)
+	}
+	return strings.Join(changes, " ")
+}
+
+// removeLayerDependencies drops the @my/<module> dependencies of modules from
+// the app's package.json.
+func removeLayerDependencies(targetDir string, modules []string) error {
+	if len(modules) == 0 {
+		return nil
+	}
+	pkgPath := filepath.Join(targetDir, "package.json")
+	data, err := os.ReadFile(pkgPath)
+	if err != nil {
+		return fmt.Errorf("failed to read package.json: %w", err)
+	}
+	pkg := map[string]any{}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return fmt.Errorf("failed to parse package.json: %w", err)
+	}
+	deps, ok := pkg["dependencies"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	for _, module := range modules {
+		delete(deps, layerPackageName(module))
+	}
+
+	updated, err := json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal package.json: %w", err)
+	}
+	if err := os.WriteFile(pkgPath, append(updated, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write package.json: %w", err)
+	}
+	return nil
+}
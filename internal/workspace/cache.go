@@ -0,0 +1,152 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nuxt-apps/couchfusion/internal/config"
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+	"github.com/nuxt-apps/couchfusion/internal/logging"
+	"github.com/nuxt-apps/couchfusion/internal/source"
+)
+
+// RunCacheList prints the cached repository mirrors stored under cacheDir.
+func RunCacheList(ctx context.Context, cacheDir string, w io.Writer) error {
+	entries, err := gitutil.ListCache(ctx, cacheDir)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintf(w, "No cached repositories in %s\n", cacheDir)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tURL\tUPDATED\tSIZE")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", entry.Key, entry.URL, entry.UpdatedAt.Local().Format(time.RFC822), formatBytes(entry.Size))
+	}
+	return tw.Flush()
+}
+
+// RunCacheUpdate creates or refreshes mirrors for every configured repository and
+// refreshes any other mirror already present in the cache. With dryRun it only
+// logs the mirrors it would create or refresh.
+func RunCacheUpdate(ctx context.Context, cfg *config.Config, cacheDir string, dryRun bool, cloneOpts ...gitutil.CloneOption) error {
+	opts := append([]gitutil.CloneOption{gitutil.WithCache(cacheDir)}, cloneOpts...)
+
+	entries, err := gitutil.ListCache(ctx, cacheDir)
+	if err != nil {
+		return err
+	}
+	cached := map[string]bool{}
+	for _, entry := range entries {
+		cached[entry.URL] = true
+	}
+
+	configured := configuredRepos(cfg)
+	for _, url := range sortedKeys(configured) {
+		repo := configured[url]
+		if source.IsLocal(repo.URL) {
+			continue
+		}
+		if dryRun {
+			if cached[repo.URL] {
+				logging.Infof("Would refresh cached mirror of %s", repo.URL)
+			} else {
+				logging.Infof("Would create cached mirror of %s", repo.URL)
+			}
+			continue
+		}
+		if err := gitutil.UpdateCache(ctx, repo.URL, repo.Protocol, repo.AuthPrompt, repoCloneOptions(repo, opts)...); err != nil {
+			return fmt.Errorf("failed to update cache for %s: %w", repo.URL, err)
+		}
+	}
+
+	for _, entry := range entries {
+		if _, ok := configured[entry.URL]; ok || entry.URL == "" {
+			continue
+		}
+		if dryRun {
+			logging.Infof("Would refresh cached mirror of %s", entry.URL)
+			continue
+		}
+		if err := gitutil.UpdateCache(ctx, entry.URL, "", false, opts...); err != nil {
+			logging.Warnf("Failed to refresh cached mirror of %s: %v", entry.URL, err)
+		}
+	}
+	return nil
+}
+
+// RunCachePrune removes mirrors that are no longer referenced by the config or that
+// have not been refreshed within olderThan (when positive). With all set, every
+// mirror is removed. It returns the removed entries; with dryRun the entries it
+// would remove are returned and kept.
+func RunCachePrune(ctx context.Context, cfg *config.Config, cacheDir string, all bool, olderThan time.Duration, dryRun bool) ([]gitutil.CacheEntry, error) {
+	entries, err := gitutil.ListCache(ctx, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	configured := configuredRepos(cfg)
+	removed := []gitutil.CacheEntry{}
+	for _, entry := range entries {
+		_, referenced := configured[entry.URL]
+		stale := olderThan > 0 && time.Since(entry.UpdatedAt) > olderThan
+		if !all && referenced && !stale {
+			continue
+		}
+		if dryRun {
+			removed = append(removed, entry)
+			continue
+		}
+		if err := gitutil.RemoveCacheEntry(entry); err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
+
+func configuredRepos(cfg *config.Config) map[string]config.RepoConfig {
+	keys := make([]string, 0, len(cfg.Repos))
+	for key := range cfg.Repos {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	repos := map[string]config.RepoConfig{}
+	for _, key := range keys {
+		repo := cfg.Repos[key]
+		if _, ok := repos[repo.URL]; !ok {
+			repos[repo.URL] = repo
+		}
+	}
+	return repos
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
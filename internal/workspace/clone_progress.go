@@ -0,0 +1,94 @@
+package workspace
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/progress"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+)
+
+type cloneProgressMsg struct {
+	update gitutil.Progress
+	ok     bool
+}
+
+// cloneProgress relays git --progress updates from a running command to the TUI
+// and renders the latest one as a progress bar.
+type cloneProgress struct {
+	updates chan gitutil.Progress
+	bar     progress.Model
+	latest  gitutil.Progress
+	seen    bool
+}
+
+func newCloneProgress() *cloneProgress {
+	return &cloneProgress{bar: progress.New(progress.WithDefaultGradient(), progress.WithWidth(40))}
+}
+
+// Start prepares a new run. The option reports progress to the TUI, done must be
+// called by the goroutine running git once it returns, and wait delivers the
+// first update.
+func (p *cloneProgress) Start() (opt gitutil.CloneOption, done func(), wait tea.Cmd) {
+	updates := make(chan gitutil.Progress, 1)
+	p.updates, p.seen = updates, false
+	opt = gitutil.WithProgress(func(update gitutil.Progress) {
+		// Keep only the newest update when the UI falls behind.
+		select {
+		case updates <- update:
+		default:
+			select {
+			case <-updates:
+			default:
+			}
+			select {
+			case updates <- update:
+			default:
+			}
+		}
+	})
+	return opt, func() { close(updates) }, p.wait()
+}
+
+func (p *cloneProgress) wait() tea.Cmd {
+	updates := p.updates
+	return func() tea.Msg {
+		update, ok := <-updates
+		return cloneProgressMsg{update: update, ok: ok}
+	}
+}
+
+// Update records an update and waits for the next one.
+func (p *cloneProgress) Update(msg cloneProgressMsg) tea.Cmd {
+	if !msg.ok {
+		return nil
+	}
+	p.latest, p.seen = msg.update, true
+	return p.wait()
+}
+
+func (p *cloneProgress) View() string {
+	if !p.seen {
+		return ""
+	}
+	u := p.latest
+	details := []string{fmt.Sprintf("%d/%d", u.Current, u.Total)}
+	if u.Transferred != "" {
+		details = append(details, u.Transferred)
+	}
+	if u.Throughput != "" {
+		details = append(details, u.Throughput)
+	}
+	if u.Done {
+		details = append(details, "done")
+	} else if u.ETA > 0 {
+		details = append(details, "ETA "+u.ETA.String())
+	}
+	return strings.Join([]string{
+		u.Phase,
+		p.bar.ViewAs(u.Percent),
+		hintStyle.Render(strings.Join(details, " · ")),
+	}, "\n")
+}
@@ -37,18 +37,23 @@ type createLayerModel struct {
 	logs *ui.LogBuffer
 
 	nameInput   textinput.Model
-	branchInput textinput.Model
+	refPicker   refPickerModel
+	branch      string
+	refsLoading bool
 	force       bool
+	cloneOpts   []gitutil.CloneOption
 
-	spinner spinner.Model
-	step    layerStep
-	err     error
-	aborted bool
-	done    bool
-	layer   string
+	spinner  spinner.Model
+	progress *cloneProgress
+	steps    *stepList
+	step     layerStep
+	err      error
+	aborted  bool
+	done     bool
+	layer    string
 }
 
-func newCreateLayerModel(ctx context.Context, cfg *config.Config, nameHint, branchHint string, force bool, logs *ui.LogBuffer) *createLayerModel {
+func newCreateLayerModel(ctx context.Context, cfg *config.Config, nameHint, branchHint string, force bool, logs *ui.LogBuffer, cloneOpts []gitutil.CloneOption) *createLayerModel {
 	name := textinput.New()
 	name.Placeholder = "layer-name"
 	name.CharLimit = 64
@@ -56,25 +61,23 @@ func newCreateLayerModel(ctx context.Context, cfg *config.Config, nameHint, bran
 	name.SetValue(nameHint)
 	name.Focus()
 
-	branch := textinput.New()
-	branch.Placeholder = "(config default)"
-	branch.CharLimit = 128
-	branch.Prompt = ""
-	branch.SetValue(branchHint)
-
 	spin := spinner.New()
 	spin.Spinner = spinner.Dot
 	spin.Style = lipgloss.NewStyle().Foreground(ui.PrimaryLight)
 
 	return &createLayerModel{
-		ctx:         ctx,
-		cfg:         cfg,
-		logs:        logs,
-		nameInput:   name,
-		branchInput: branch,
-		force:       force,
-		spinner:     spin,
-		step:        layerStepName,
+		ctx:       ctx,
+		cfg:       cfg,
+		logs:      logs,
+		nameInput: name,
+		refPicker: newRefPickerModel(branchHint, cfg.Repos["create_layer"].ResolveRef("")),
+		branch:    branchHint,
+		force:     force,
+		cloneOpts: cloneOpts,
+		spinner:   spin,
+		progress:  newCloneProgress(),
+		steps:     newStepList(createLayerSteps),
+		step:      layerStepName,
 	}
 }
 
@@ -102,12 +105,21 @@ func (m *createLayerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, tea.Quit
 			}
 		}
+	case cloneProgressMsg:
+		return m, m.progress.Update(msg)
 	case spinner.TickMsg:
 		if m.step == layerStepRunning {
 			var cmd tea.Cmd
 			m.spinner, cmd = m.spinner.Update(msg)
 			return m, cmd
 		}
+	case refsLoadedMsg:
+		m.refsLoading = false
+		if msg.err != nil {
+			m.logs.Warnf("Unable to list layer template refs: %v", msg.err)
+		}
+		m.refPicker.SetRefs(msg)
+		return m, nil
 	case layerResultMsg:
 		if msg.err != nil {
 			m.err = msg.err
@@ -135,34 +147,47 @@ func (m *createLayerModel) updateName(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 		m.layer = value
-		m.step = layerStepBranch
-		m.branchInput.Focus()
 		m.nameInput.Blur()
-		return m, nil
+		return m, m.enterBranch()
 	}
 	var cmd tea.Cmd
 	m.nameInput, cmd = m.nameInput.Update(msg)
 	return m, cmd
 }
 
+// enterBranch shows the ref picker, listing the remote refs the first time.
+func (m *createLayerModel) enterBranch() tea.Cmd {
+	m.step = layerStepBranch
+	cmd := m.refPicker.Focus()
+	if m.refPicker.Loaded() || m.refsLoading {
+		return cmd
+	}
+	m.refsLoading = true
+	return tea.Batch(cmd, loadRefsCmd(m.ctx, m.cfg.Repos["create_layer"], m.logs, m.cloneOpts))
+}
+
 func (m *createLayerModel) updateBranch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
-	case "ctrl+c", "q":
+	case "ctrl+c":
 		m.aborted = true
 		return m, tea.Quit
-	case "b":
+	case "esc":
 		m.step = layerStepName
 		m.nameInput.Focus()
-		m.branchInput.Blur()
+		m.refPicker.Blur()
 		return m, nil
 	case "enter":
+		branch, err := m.refPicker.Selected()
+		if err != nil {
+			m.logs.Warnf("%v", err)
+			return m, nil
+		}
+		m.branch = branch
 		m.step = layerStepSummary
-		m.branchInput.Blur()
+		m.refPicker.Blur()
 		return m, nil
 	}
-	var cmd tea.Cmd
-	m.branchInput, cmd = m.branchInput.Update(msg)
-	return m, cmd
+	return m, m.refPicker.Update(msg)
 }
 
 func (m *createLayerModel) updateSummary(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
@@ -174,9 +199,7 @@ func (m *createLayerModel) updateSummary(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.force = !m.force
 		return m, nil
 	case "b":
-		m.step = layerStepBranch
-		m.branchInput.Focus()
-		return m, nil
+		return m, m.enterBranch()
 	case "enter":
 		if m.layer == "" {
 			name := sanitizeName(m.nameInput.Value())
@@ -197,13 +220,16 @@ func (m *createLayerModel) updateSummary(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 func (m *createLayerModel) runCreateLayerCmd() tea.Cmd {
 	name := m.layer
-	branch := strings.TrimSpace(m.branchInput.Value())
+	branch := m.branch
 	force := m.force
 	cfg := m.cfg
-	ctx := m.ctx
+	ctx := WithStepObserver(m.ctx, m.steps.Observe)
 	logs := m.logs
+	progressOpt, progressDone, waitProgress := m.progress.Start()
+	cloneOpts := append([]gitutil.CloneOption{progressOpt}, m.cloneOpts...)
 
-	return func() tea.Msg {
+	run := func() tea.Msg {
+		defer progressDone()
 		logs.Infof("Target layer: %s", name)
 		if branch != "" {
 			logs.Infof("Branch override: %s", branch)
@@ -213,14 +239,16 @@ func (m *createLayerModel) runCreateLayerCmd() tea.Cmd {
 		}
 
 		logWriter := logs.Writer(ui.Info)
-		err := RunCreateLayer(ctx, cfg, name, branch, force, gitutil.WithOutput(logWriter), gitutil.WithLogger(func(format string, args ...any) {
+		cloneOpts = append(cloneOpts, gitutil.WithOutput(logWriter), gitutil.WithLogger(func(format string, args ...any) {
 			logs.Infof(format, args...)
 		}))
+		err := RunCreateLayer(ctx, cfg, name, branch, force, cloneOpts...)
 		if err != nil {
 			return layerResultMsg{err: err}
 		}
 		return layerResultMsg{err: nil}
 	}
+	return tea.Batch(run, waitProgress)
 }
 
 func (m *createLayerModel) View() string {
@@ -237,12 +265,12 @@ func (m *createLayerModel) View() string {
 		return ui.Content.Render(lipgloss.JoinVertical(
 			lipgloss.Left,
 			ui.Title.Render("Branch override"),
-			ui.Subtitle.Render("Optionally override the layer template branch."),
+			ui.Subtitle.Render("Pick the layer template branch or tag, or type a commit SHA."),
 			"",
-			ui.Content.Render(m.branchInput.View()),
+			ui.Content.Render(m.refPicker.View()),
 		))
 	case layerStepSummary:
-		branch := strings.TrimSpace(m.branchInput.Value())
+		branch := m.branch
 		if branch == "" {
 			branch = "config default"
 		}
@@ -252,6 +280,9 @@ func (m *createLayerModel) View() string {
 			fmt.Sprintf("Force : %v", m.force),
 			"",
 			ui.Hint.Render("Press 'f' to toggle force."),
+			"",
+			"Steps:",
+			m.steps.View(""),
 		}
 		return lipgloss.JoinVertical(
 			lipgloss.Left,
@@ -266,13 +297,17 @@ func (m *createLayerModel) View() string {
 			ui.Title.Render("Creating layer"),
 			ui.Subtitle.Render("Cloning template into /layers."),
 			"",
-			ui.Content.Render(fmt.Sprintf("%s  %s", m.spinner.View(), "Working...")),
+			ui.Content.Render(m.steps.View(m.spinner.View())),
+			"",
+			ui.Content.Render(m.progress.View()),
 		))
 	case layerStepDone:
 		return lipgloss.JoinVertical(
 			lipgloss.Left,
 			ui.Title.Render("Layer ready"),
 			ui.Subtitle.Render("Press Enter to exit."),
+			"",
+			ui.Content.Render(m.steps.View("")),
 		)
 	case layerStepError:
 		return lipgloss.JoinVertical(
@@ -286,12 +321,17 @@ func (m *createLayerModel) View() string {
 	}
 }
 
+// CapturesText lets the ref filter receive 'q'.
+func (m *createLayerModel) CapturesText() bool {
+	return m.step == layerStepBranch
+}
+
 func (m *createLayerModel) Hints() []string {
 	switch m.step {
 	case layerStepName:
 		return []string{"Enter next", "Ctrl+C cancel"}
 	case layerStepBranch:
-		return []string{"Enter next", "b back", "Ctrl+C cancel"}
+		return []string{"Type to filter", "↑/↓ move", "Enter select", "Esc back", "Ctrl+C cancel"}
 	case layerStepSummary:
 		return []string{"Enter confirm", "f toggle force", "b back", "Ctrl+C cancel"}
 	case layerStepRunning:
@@ -312,9 +352,9 @@ func (m *createLayerModel) Result() (string, error) {
 	return m.layer, m.err
 }
 
-func RunCreateLayerTUI(ctx context.Context, cfg *config.Config, nameHint, branchHint string, force bool) (string, error) {
+func RunCreateLayerTUI(ctx context.Context, cfg *config.Config, nameHint, branchHint string, force bool, cloneOpts ...gitutil.CloneOption) (string, error) {
 	logs := ui.NewLogBuffer(128)
-	model := newCreateLayerModel(ctx, cfg, nameHint, branchHint, force, logs)
+	model := newCreateLayerModel(ctx, cfg, nameHint, branchHint, force, logs, cloneOpts)
 	root := ui.NewRootModel("Create Layer", "Scaffold a new reusable layer inside /layers.", model, logs, nil)
 	final, err := ui.Run(root, tea.WithAltScreen())
 	if err != nil {
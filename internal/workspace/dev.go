@@ -0,0 +1,437 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/nuxt-apps/couchfusion/internal/ui"
+)
+
+const (
+	devStopTimeout  = 5 * time.Second
+	devStableWindow = 30 * time.Second
+	devMaxBackoff   = 30 * time.Second
+	// devPortCandidates is how many ports nextFreePort probes.
+	devPortCandidates = 100
+)
+
+// devPalette assigns a distinct colour to each dev target's prefix and pane.
+var devPalette = []lipgloss.Color{"75", "213", "84", "214", "147", "203", "117", "222"}
+
+// DevTarget describes a project started by the dev runner.
+type DevTarget struct {
+	Name  string
+	Dir   string
+	Port  int
+	Layer bool
+}
+
+// Label returns the display name used for prefixes and pane titles.
+func (t DevTarget) Label() string {
+	if t.Layer {
+		return "layer:" + t.Name
+	}
+	return t.Name
+}
+
+// DevOptions configures how dev servers are launched and supervised.
+type DevOptions struct {
+	// Command is the dev server command run inside each project directory.
+	// The assigned port is exported as PORT/NUXT_PORT, which nuxt dev reads;
+	// no flag is appended, since runners such as npm would swallow it.
+	Command []string
+	// MaxRestarts caps consecutive restarts of a crashing process; negative means unlimited.
+	// A process that exits with status 0 is not restarted.
+	MaxRestarts int
+}
+
+// DevStatus reports the lifecycle state of a supervised dev process.
+type DevStatus int
+
+const (
+	DevStarting DevStatus = iota
+	DevRunning
+	DevRestarting
+	DevStopped
+	DevFailed
+)
+
+func (s DevStatus) String() string {
+	switch s {
+	case DevStarting:
+		return "starting"
+	case DevRunning:
+		return "running"
+	case DevRestarting:
+		return "restarting"
+	case DevStopped:
+		return "stopped"
+	case DevFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// devOutput receives process output and lifecycle events from the runner.
+type devOutput interface {
+	Line(index int, text string)
+	Event(index int, level ui.LogLevel, format string, args ...any)
+}
+
+type devTargetState struct {
+	status   DevStatus
+	restarts int
+}
+
+type devRunner struct {
+	targets []DevTarget
+	opts    DevOptions
+	out     devOutput
+
+	mu     sync.Mutex
+	states []devTargetState
+}
+
+func newDevRunner(targets []DevTarget, opts DevOptions, out devOutput) *devRunner {
+	if len(opts.Command) == 0 {
+		opts.Command = []string{"bun", "run", "dev"}
+	}
+	return &devRunner{
+		targets: targets,
+		opts:    opts,
+		out:     out,
+		states:  make([]devTargetState, len(targets)),
+	}
+}
+
+// ResolveDevTargets maps app and layer names inside the current workspace to dev
+// targets with unique ports. When no app names are given every app under /apps is used.
+func ResolveDevTargets(apps, layers []string, basePort int) ([]DevTarget, error) {
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine current working directory: %w", err)
+	}
+
+	if len(apps) == 0 {
+		apps, err = listProjects(filepath.Join(root, "apps"))
+		if err != nil {
+			return nil, err
+		}
+		if len(apps) == 0 {
+			return nil, errors.New("no apps found under apps/; create one with `couchfusion new`")
+		}
+	}
+
+	targets := []DevTarget{}
+	seen := map[string]struct{}{}
+	add := func(name string, layer bool) error {
+		parent := "apps"
+		if layer {
+			parent = "layers"
+		}
+		key := parent + "/" + name
+		if _, ok := seen[key]; ok {
+			return nil
+		}
+		seen[key] = struct{}{}
+
+		dir := filepath.Join(root, parent, name)
+		if _, err := os.Stat(filepath.Join(dir, "package.json")); err != nil {
+			return fmt.Errorf("%s is not a runnable project (missing package.json)", key)
+		}
+		targets = append(targets, DevTarget{Name: name, Dir: dir, Layer: layer})
+		return nil
+	}
+
+	for _, name := range apps {
+		if err := add(name, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range layers {
+		if err := add(name, true); err != nil {
+			return nil, err
+		}
+	}
+
+	port := basePort
+	for i := range targets {
+		if port, err = nextFreePort(port); err != nil {
+			return nil, fmt.Errorf("%s: %w", targets[i].Label(), err)
+		}
+		targets[i].Port = port
+		port++
+	}
+
+	return targets, nil
+}
+
+// listProjects returns the projects in dir, sorted: the directories with a
+// package.json, skipping hidden ones such as the staging directories of
+// unfinished runs. A missing dir has none. dev and verify share it, so they
+// agree on what the apps of a workspace are.
+func listProjects(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, entry.Name(), "package.json")); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// nextFreePort returns the first port from port on that can be listened on.
+// The probe releases the port before the dev server binds it, so another
+// process may take it in between; the server then fails to start and
+// supervise restarts it with backoff until the port is free again.
+func nextFreePort(port int) (int, error) {
+	for candidate := port; candidate < port+devPortCandidates; candidate++ {
+		ln, err := net.Listen("tcp", ":"+strconv.Itoa(candidate))
+		if err != nil {
+			continue
+		}
+		ln.Close()
+		return candidate, nil
+	}
+	return 0, fmt.Errorf("no free port between %d and %d; choose another range with --port", port, port+devPortCandidates-1)
+}
+
+// RunDev starts every target concurrently and streams prefixed, coloured output to w
+// until ctx is cancelled.
+func RunDev(ctx context.Context, targets []DevTarget, opts DevOptions, w io.Writer) error {
+	out := newPrefixedDevOutput(targets, w)
+	runner := newDevRunner(targets, opts, out)
+	runner.run(ctx)
+	return nil
+}
+
+func (r *devRunner) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range r.targets {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			r.supervise(ctx, index)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (r *devRunner) supervise(ctx context.Context, index int) {
+	target := r.targets[index]
+	backoff := time.Second
+	restarts := 0
+
+	for {
+		r.setStatus(index, DevStarting, restarts)
+		r.out.Event(index, ui.Info, "Starting %s on port %d", strings.Join(r.opts.Command, " "), target.Port)
+
+		started := time.Now()
+		err := r.runOnce(ctx, index)
+		if ctx.Err() != nil {
+			r.setStatus(index, DevStopped, restarts)
+			r.out.Event(index, ui.Info, "Stopped.")
+			return
+		}
+		if err == nil {
+			// Only crashes are restarted; exit status 0 is a deliberate stop.
+			r.setStatus(index, DevStopped, restarts)
+			r.out.Event(index, ui.Info, "Process exited cleanly; not restarting.")
+			return
+		}
+
+		if time.Since(started) > devStableWindow {
+			restarts = 0
+			backoff = time.Second
+		}
+		restarts++
+
+		reason := err.Error()
+		if r.opts.MaxRestarts >= 0 && restarts > r.opts.MaxRestarts {
+			r.setStatus(index, DevFailed, restarts-1)
+			r.out.Event(index, ui.Error, "Process %s; giving up after %d restarts.", reason, r.opts.MaxRestarts)
+			return
+		}
+
+		r.setStatus(index, DevRestarting, restarts)
+		r.out.Event(index, ui.Warn, "Process %s; restarting in %s.", reason, backoff)
+		select {
+		case <-ctx.Done():
+			r.setStatus(index, DevStopped, restarts)
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > devMaxBackoff {
+			backoff = devMaxBackoff
+		}
+	}
+}
+
+func (r *devRunner) runOnce(ctx context.Context, index int) error {
+	target := r.targets[index]
+	port := strconv.Itoa(target.Port)
+
+	cmd := exec.Command(r.opts.Command[0], r.opts.Command[1:]...)
+	cmd.Dir = target.Dir
+	cmd.Env = append(os.Environ(), "PORT="+port, "NUXT_PORT="+port)
+	lines := &devLineWriter{emit: func(text string) { r.out.Line(index, text) }}
+	cmd.Stdout = lines
+	cmd.Stderr = lines
+	cmd.WaitDelay = devStopTimeout
+	configureDevProcess(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start: %w", err)
+	}
+	r.setStatus(index, DevRunning, r.restarts(index))
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		lines.Flush()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if err := interruptDevProcess(cmd); err != nil {
+			_ = killDevProcess(cmd)
+		}
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(devStopTimeout):
+			r.out.Event(index, ui.Warn, "Did not exit after %s; killing.", devStopTimeout)
+			_ = killDevProcess(cmd)
+			return <-done
+		}
+	}
+}
+
+func (r *devRunner) setStatus(index int, status DevStatus, restarts int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states[index] = devTargetState{status: status, restarts: restarts}
+}
+
+func (r *devRunner) restarts(index int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.states[index].restarts
+}
+
+func (r *devRunner) state(index int) devTargetState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.states[index]
+}
+
+// devLineWriter splits process output into lines, treating carriage returns as
+// line breaks so progress redraws do not collapse into one entry.
+type devLineWriter struct {
+	mu      sync.Mutex
+	pending []byte
+	emit    func(string)
+}
+
+func (w *devLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, p...)
+	for {
+		idx := bytes.IndexAny(w.pending, "\r\n")
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimRight(string(w.pending[:idx]), " \t")
+		w.pending = w.pending[idx+1:]
+		if strings.TrimSpace(line) != "" {
+			w.emit(line)
+		}
+	}
+	return len(p), nil
+}
+
+func (w *devLineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if line := strings.TrimSpace(string(w.pending)); line != "" {
+		w.emit(line)
+	}
+	w.pending = nil
+}
+
+type prefixedDevOutput struct {
+	mu       sync.Mutex
+	w        io.Writer
+	prefixes []string
+}
+
+func newPrefixedDevOutput(targets []DevTarget, w io.Writer) *prefixedDevOutput {
+	width := 0
+	for _, t := range targets {
+		if len(t.Label()) > width {
+			width = len(t.Label())
+		}
+	}
+	prefixes := make([]string, len(targets))
+	for i, t := range targets {
+		style := lipgloss.NewStyle().Foreground(devColor(i)).Bold(true)
+		prefixes[i] = style.Render(fmt.Sprintf("%-*s │", width, t.Label()))
+	}
+	return &prefixedDevOutput{w: w, prefixes: prefixes}
+}
+
+func (o *prefixedDevOutput) Line(index int, text string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fmt.Fprintf(o.w, "%s %s\n", o.prefixes[index], text)
+}
+
+func (o *prefixedDevOutput) Event(index int, level ui.LogLevel, format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	switch level {
+	case ui.Warn:
+		text = ui.LogWarn.Render(text)
+	case ui.Error:
+		text = ui.LogError.Render(text)
+	case ui.Success:
+		text = ui.LogSuccess.Render(text)
+	default:
+		text = ui.LogInfo.Render(text)
+	}
+	o.Line(index, text)
+}
+
+func devColor(index int) lipgloss.Color {
+	return devPalette[index%len(devPalette)]
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package workspace
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureDevProcess starts the dev server in its own process group so the
+// whole tree (bun, nuxi, node workers) can be signalled together.
+func configureDevProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func interruptDevProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+}
+
+func killDevProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package workspace
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func configureDevProcess(cmd *exec.Cmd) {}
+
+// interruptDevProcess asks taskkill to stop the whole process tree, since
+// Windows has no process-group SIGINT equivalent for console children.
+func interruptDevProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return exec.Command("taskkill", "/T", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
+
+func killDevProcess(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
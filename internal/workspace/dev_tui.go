@@ -0,0 +1,171 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/nuxt-apps/couchfusion/internal/logging"
+	"github.com/nuxt-apps/couchfusion/internal/ui"
+)
+
+const devRefreshInterval = 200 * time.Millisecond
+
+type devTickMsg struct{}
+
+// paneDevOutput routes each target's output into its own log buffer.
+type paneDevOutput struct {
+	buffers []*ui.LogBuffer
+}
+
+func (o *paneDevOutput) Line(index int, text string) {
+	o.buffers[index].Infof("%s", text)
+}
+
+func (o *paneDevOutput) Event(index int, level ui.LogLevel, format string, args ...any) {
+	o.buffers[index].Append(level, format, args...)
+}
+
+type devModel struct {
+	runner  *devRunner
+	buffers []*ui.LogBuffer
+
+	width  int
+	height int
+}
+
+func newDevModel(runner *devRunner, buffers []*ui.LogBuffer) *devModel {
+	return &devModel{runner: runner, buffers: buffers}
+}
+
+func devTick() tea.Cmd {
+	return tea.Tick(devRefreshInterval, func(time.Time) tea.Msg {
+		return devTickMsg{}
+	})
+}
+
+func (m *devModel) Init() tea.Cmd {
+	return devTick()
+}
+
+func (m *devModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+	case devTickMsg:
+		return m, devTick()
+	}
+	return m, nil
+}
+
+func (m *devModel) View() string {
+	width := m.width
+	if width <= 0 {
+		width = 96
+	}
+	height := m.height
+	if height <= 0 {
+		height = 40
+	}
+
+	columns := 1
+	if width >= 140 && len(m.runner.targets) > 1 {
+		columns = 2
+	}
+	rows := (len(m.runner.targets) + columns - 1) / columns
+
+	// Leave room for the root frame, title, shared log lines and hints.
+	paneWidth := (width-8)/columns - 2
+	paneLines := (height-18)/rows - 3
+	if paneLines < 3 {
+		paneLines = 3
+	}
+
+	panes := make([]string, 0, len(m.runner.targets))
+	for i := range m.runner.targets {
+		panes = append(panes, m.renderPane(i, paneWidth, paneLines))
+	}
+
+	grid := make([]string, 0, rows)
+	for start := 0; start < len(panes); start += columns {
+		end := start + columns
+		if end > len(panes) {
+			end = len(panes)
+		}
+		grid = append(grid, lipgloss.JoinHorizontal(lipgloss.Top, panes[start:end]...))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, grid...)
+}
+
+func (m *devModel) renderPane(index, width, lines int) string {
+	target := m.runner.targets[index]
+	state := m.runner.state(index)
+	color := devColor(index)
+
+	status := state.status.String()
+	if state.restarts > 0 {
+		status = fmt.Sprintf("%s, %d restarts", status, state.restarts)
+	}
+	header := lipgloss.NewStyle().Foreground(color).Bold(true).
+		Render(fmt.Sprintf("%s :%d", target.Label(), target.Port))
+	header += " " + ui.Hint.Render("["+status+"]")
+
+	body := lipgloss.NewStyle().MaxWidth(width).
+		Render(m.buffers[index].RenderTail(lines))
+	body = padLines(body, lines)
+
+	return lipgloss.NewStyle().
+		BorderStyle(lipgloss.RoundedBorder()).
+		BorderForeground(color).
+		Width(width).
+		Render(lipgloss.JoinVertical(lipgloss.Left, header, body))
+}
+
+func padLines(content string, lines int) string {
+	count := strings.Count(content, "\n") + 1
+	if count >= lines {
+		return content
+	}
+	return content + strings.Repeat("\n", lines-count)
+}
+
+func (m *devModel) Hints() []string {
+	return []string{"Ctrl+C stop all and exit"}
+}
+
+// RunDevTUI runs the dev servers with one live log pane per target. Quitting the
+// interface stops every child process before returning.
+func RunDevTUI(ctx context.Context, targets []DevTarget, opts DevOptions) error {
+	buffers := make([]*ui.LogBuffer, len(targets))
+	for i := range targets {
+		buffers[i] = ui.NewLogBuffer(200)
+	}
+	runner := newDevRunner(targets, opts, &paneDevOutput{buffers: buffers})
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runner.run(runCtx)
+	}()
+
+	logs := ui.NewLogBuffer(4)
+	logs.Infof("Started %d dev server(s).", len(targets))
+	model := newDevModel(runner, buffers)
+	root := ui.NewRootModel("Dev Servers", "Running apps and layer playgrounds side by side.", model, logs, nil)
+	_, err := ui.Run(root, tea.WithAltScreen())
+
+	logging.Infof("Stopping dev servers...")
+	cancel()
+	wg.Wait()
+	return err
+}
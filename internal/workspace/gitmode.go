@@ -0,0 +1,107 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nuxt-apps/couchfusion/internal/config"
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+)
+
+const (
+	gitModePerProject = "per-project"
+	gitModeMonorepo   = "monorepo"
+)
+
+// initWorkspaceRepo makes root the single repository of a monorepo workspace,
+// reusing an existing repository.
+func initWorkspaceRepo(ctx context.Context, settings config.GitScaffoldConfig, root string) error {
+	if _, err := os.Stat(filepath.Join(root, ".git")); err == nil {
+		return ensureEnvIgnored(ctx, root)
+	}
+	return initProjectRepo(ctx, settings, root, filepath.Base(root))
+}
+
+// prepareProjectRepo replaces the starter history of a freshly cloned project:
+// per-project workspaces get a new repository in targetDir, monorepo workspaces
+// keep no nested repository at all.
+func prepareProjectRepo(ctx context.Context, settings config.GitScaffoldConfig, gitMode, targetDir, name string) error {
+	if gitMode != gitModeMonorepo {
+		return reinitializeGitRepo(ctx, settings, targetDir, name)
+	}
+	if err := os.RemoveAll(filepath.Join(targetDir, ".git")); err != nil {
+		return fmt.Errorf("failed to remove git history in %s: %w", targetDir, err)
+	}
+	return ensureEnvIgnored(ctx, targetDir)
+}
+
+// commitProjectRepo creates the configured initial commit of a per-project
+// repository once every file of the project is written. Monorepo projects are
+// committed with the workspace instead.
+func commitProjectRepo(ctx context.Context, settings config.GitScaffoldConfig, gitMode, dir string) error {
+	if gitMode == gitModeMonorepo {
+		return nil
+	}
+	return commitScaffold(ctx, settings, dir)
+}
+
+// stageProjectRepo stages a project that is in place at targetDir, plus the
+// updated lock file and package workspace files, into the root repository of a
+// monorepo workspace.
+func stageProjectRepo(ctx context.Context, gitMode, root, targetDir string) error {
+	if gitMode != gitModeMonorepo {
+		return nil
+	}
+	rel, err := filepath.Rel(root, targetDir)
+	if err != nil {
+		return err
+	}
+	paths := []string{rel, lockFileName}
+	for _, name := range []string{rootPackageFileName, pnpmWorkspaceFileName} {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			paths = append(paths, name)
+		}
+	}
+	if _, err := gitutil.Run(ctx, root, append([]string{"add", "--"}, paths...)...); err != nil {
+		return fmt.Errorf("failed to stage %s in the workspace repository: %w", rel, err)
+	}
+	return nil
+}
+
+// finishWorkspaceRepo commits (when git.scaffold.initialCommit is set) or stages
+// everything init created in a monorepo workspace.
+func finishWorkspaceRepo(ctx context.Context, settings config.GitScaffoldConfig, root string) error {
+	if settings.InitialCommit {
+		return commitScaffold(ctx, settings, root)
+	}
+	_, err := gitutil.Run(ctx, root, "add", "--all")
+	return err
+}
+
+// planProjectRepo records what prepareProjectRepo and commitProjectRepo would do
+// to the project at targetDir.
+func planProjectRepo(plan *Plan, settings config.GitScaffoldConfig, gitMode, targetDir, name string) {
+	rel := plan.rel(targetDir)
+	if gitMode == gitModeMonorepo {
+		plan.action("drop the template history of %s; the workspace repository tracks it", rel)
+		return
+	}
+	details := []string{}
+	if branch := strings.TrimSpace(settings.DefaultBranch); branch != "" {
+		details = append(details, "branch "+branch)
+	}
+	if remote := settings.RemoteURL(name); remote != "" {
+		details = append(details, "remote origin "+remote)
+	}
+	if len(details) > 0 {
+		plan.action("initialize a new git repository in %s (%s)", rel, strings.Join(details, ", "))
+	} else {
+		plan.action("initialize a new git repository in %s", rel)
+	}
+	if settings.InitialCommit {
+		plan.action("commit %s: %q", rel, settings.ResolveCommitMessage())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/spinner"
@@ -22,6 +23,7 @@ type initStep int
 const (
 	initStepPath initStep = iota
 	initStepBranch
+	initStepLayers
 	initStepSummary
 	initStepRunning
 	initStepDone
@@ -38,17 +40,25 @@ type initModel struct {
 	logs *ui.LogBuffer
 
 	pathInput   textinput.Model
-	branchInput textinput.Model
+	refPicker   refPickerModel
+	branch      string
+	layerView   moduleSelectModel
+	layersMode  string
+	gitMode     string
+	packages    string
 	force       bool
+	cloneOpts   []gitutil.CloneOption
+	refsLoading bool
 
-	spinner spinner.Model
-	step    initStep
-	err     error
-	aborted bool
-	done    bool
+	spinner  spinner.Model
+	progress *cloneProgress
+	step     initStep
+	err      error
+	aborted  bool
+	done     bool
 }
 
-func newInitModel(ctx context.Context, cfg *config.Config, pathHint, branchHint string, force bool, logs *ui.LogBuffer) *initModel {
+func newInitModel(ctx context.Context, cfg *config.Config, pathHint, branchHint, layersMode, gitMode, packages string, layerHints []string, force bool, logs *ui.LogBuffer, cloneOpts []gitutil.CloneOption) *initModel {
 	path := textinput.New()
 	path.Placeholder = "./"
 	path.CharLimit = 256
@@ -60,25 +70,26 @@ func newInitModel(ctx context.Context, cfg *config.Config, pathHint, branchHint
 	}
 	path.Focus()
 
-	branch := textinput.New()
-	branch.Placeholder = "(config default)"
-	branch.CharLimit = 128
-	branch.Prompt = ""
-	branch.SetValue(branchHint)
-
 	spin := spinner.New()
 	spin.Spinner = spinner.Dot
 	spin.Style = lipgloss.NewStyle().Foreground(ui.PrimaryLight)
 
 	return &initModel{
-		ctx:         ctx,
-		cfg:         cfg,
-		logs:        logs,
-		pathInput:   path,
-		branchInput: branch,
-		force:       force,
-		spinner:     spin,
-		step:        initStepPath,
+		ctx:        ctx,
+		cfg:        cfg,
+		logs:       logs,
+		pathInput:  path,
+		refPicker:  newRefPickerModel(branchHint, cfg.Repos["init"].ResolveRef("")),
+		branch:     branchHint,
+		layerView:  newModuleSelectModel(initLayerChoices(cfg, layerHints), layerHints),
+		layersMode: layersMode,
+		gitMode:    gitMode,
+		packages:   packages,
+		force:      force,
+		cloneOpts:  cloneOpts,
+		spinner:    spin,
+		progress:   newCloneProgress(),
+		step:       initStepPath,
 	}
 }
 
@@ -94,6 +105,8 @@ func (m *initModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updatePath(msg)
 		case initStepBranch:
 			return m.updateBranch(msg)
+		case initStepLayers:
+			return m.updateLayers(msg)
 		case initStepSummary:
 			return m.updateSummary(msg)
 		case initStepRunning:
@@ -106,12 +119,21 @@ func (m *initModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, tea.Quit
 			}
 		}
+	case cloneProgressMsg:
+		return m, m.progress.Update(msg)
 	case spinner.TickMsg:
 		if m.step == initStepRunning {
 			var cmd tea.Cmd
 			m.spinner, cmd = m.spinner.Update(msg)
 			return m, cmd
 		}
+	case refsLoadedMsg:
+		m.refsLoading = false
+		if msg.err != nil {
+			m.logs.Warnf("Unable to list layers repository refs: %v", msg.err)
+		}
+		m.refPicker.SetRefs(msg)
+		return m, nil
 	case initResultMsg:
 		if msg.err != nil {
 			m.err = msg.err
@@ -138,34 +160,62 @@ func (m *initModel) updatePath(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			value = "."
 			m.pathInput.SetValue(value)
 		}
-		m.step = initStepBranch
-		m.branchInput.Focus()
 		m.pathInput.Blur()
-		return m, nil
+		return m, m.enterBranch()
 	}
 	var cmd tea.Cmd
 	m.pathInput, cmd = m.pathInput.Update(msg)
 	return m, cmd
 }
 
+// enterBranch shows the ref picker, listing the remote refs the first time.
+func (m *initModel) enterBranch() tea.Cmd {
+	m.step = initStepBranch
+	cmd := m.refPicker.Focus()
+	if m.refPicker.Loaded() || m.refsLoading {
+		return cmd
+	}
+	m.refsLoading = true
+	return tea.Batch(cmd, loadRefsCmd(m.ctx, m.cfg.Repos["init"], m.logs, m.cloneOpts))
+}
+
 func (m *initModel) updateBranch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
-	case "ctrl+c", "q":
+	case "ctrl+c":
 		m.aborted = true
 		return m, tea.Quit
-	case "b":
+	case "esc":
 		m.step = initStepPath
 		m.pathInput.Focus()
-		m.branchInput.Blur()
+		m.refPicker.Blur()
 		return m, nil
+	case "enter":
+		branch, err := m.refPicker.Selected()
+		if err != nil {
+			m.logs.Warnf("%v", err)
+			return m, nil
+		}
+		m.branch = branch
+		m.step = initStepLayers
+		m.refPicker.Blur()
+		return m, nil
+	}
+	return m, m.refPicker.Update(msg)
+}
+
+func (m *initModel) updateLayers(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		m.aborted = true
+		return m, tea.Quit
+	case "b":
+		return m, m.enterBranch()
 	case "enter":
 		m.step = initStepSummary
-		m.branchInput.Blur()
 		return m, nil
 	}
-	var cmd tea.Cmd
-	m.branchInput, cmd = m.branchInput.Update(msg)
-	return m, cmd
+	m.layerView.HandleKey(msg.String())
+	return m, nil
 }
 
 func (m *initModel) updateSummary(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
@@ -176,9 +226,17 @@ func (m *initModel) updateSummary(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "f":
 		m.force = !m.force
 		return m, nil
+	case "m":
+		m.layersMode = nextLayersMode(m.layersMode)
+		return m, nil
+	case "g":
+		m.gitMode = nextMode(config.GitModes, m.gitMode)
+		return m, nil
+	case "p":
+		m.packages = nextMode(packageWorkspaceChoices, m.packages)
+		return m, nil
 	case "b":
-		m.step = initStepBranch
-		m.branchInput.Focus()
+		m.step = initStepLayers
 		return m, nil
 	case "enter":
 		m.step = initStepRunning
@@ -193,30 +251,45 @@ func (m *initModel) runInitCmd() tea.Cmd {
 	if path == "" {
 		path = "."
 	}
-	branch := strings.TrimSpace(m.branchInput.Value())
+	branch := m.branch
+	layersMode := m.layersMode
+	gitMode := m.gitMode
+	packages := m.packages
+	layers := m.layerView.SelectedNames()
 	force := m.force
 	cfg := m.cfg
 	ctx := m.ctx
 	logs := m.logs
+	progressOpt, progressDone, waitProgress := m.progress.Start()
+	cloneOpts := append([]gitutil.CloneOption{progressOpt}, m.cloneOpts...)
 
-	return func() tea.Msg {
+	run := func() tea.Msg {
+		defer progressDone()
 		logs.Infof("Target path: %s", filepath.Clean(path))
 		if branch != "" {
 			logs.Infof("Layers branch override: %s", branch)
 		}
+		logs.Infof("Layers mode: %s", layersMode)
+		logs.Infof("Git mode: %s", gitMode)
+		logs.Infof("Package workspaces: %s", packages)
+		if len(layers) > 0 {
+			logs.Infof("Selected layers: %s", strings.Join(layers, ", "))
+		}
 		if force {
 			logs.Warnf("Force flag enabled; existing directories may be reused if empty.")
 		}
 
 		logWriter := logs.Writer(ui.Info)
-		err := RunInit(ctx, cfg, path, branch, force, gitutil.WithOutput(logWriter), gitutil.WithLogger(func(format string, args ...any) {
+		cloneOpts = append(cloneOpts, gitutil.WithOutput(logWriter), gitutil.WithLogger(func(format string, args ...any) {
 			logs.Infof(format, args...)
 		}))
+		err := RunInit(ctx, cfg, path, branch, layersMode, gitMode, packages, layers, force, cloneOpts...)
 		if err != nil {
 			return initResultMsg{err: err}
 		}
 		return initResultMsg{err: nil}
 	}
+	return tea.Batch(run, waitProgress)
 }
 
 func (m *initModel) View() string {
@@ -233,23 +306,39 @@ func (m *initModel) View() string {
 		return ui.Content.Render(lipgloss.JoinVertical(
 			lipgloss.Left,
 			ui.Title.Render("Layers branch"),
-			ui.Subtitle.Render("Optionally override the layers repository branch."),
+			ui.Subtitle.Render("Pick the layers repository branch or tag, or type a commit SHA."),
+			"",
+			ui.Content.Render(m.refPicker.View()),
+		))
+	case initStepLayers:
+		return ui.Content.Render(lipgloss.JoinVertical(
+			lipgloss.Left,
+			ui.Title.Render("Base layers"),
+			ui.Subtitle.Render("Use space to pick the layers to materialize. Leave empty to keep every layer."),
+			"",
+			m.layerView.ViewList(),
 			"",
-			ui.Content.Render(m.branchInput.View()),
+			ui.Content.Render(renderLayerSelection(m.layerView.SelectedNames())),
 		))
 	case initStepSummary:
 		lines := []string{
 			fmt.Sprintf("Path   : %s", filepath.Clean(m.pathInput.Value())),
 		}
-		branch := strings.TrimSpace(m.branchInput.Value())
+		branch := m.branch
 		if branch == "" {
 			branch = "config default"
 		}
 		lines = append(lines,
 			fmt.Sprintf("Branch : %s", branch),
+			fmt.Sprintf("Mode   : %s", m.layersMode),
+			fmt.Sprintf("Git    : %s", m.gitMode),
+			fmt.Sprintf("Pkgs   : %s", m.packages),
+			fmt.Sprintf("Layers : %s", layerSelectionLabel(m.layerView.SelectedNames())),
 			fmt.Sprintf("Force  : %v", m.force),
 			"",
-			ui.Hint.Render("Press 'f' to toggle force."),
+			ui.Hint.Render("Press 'f' to toggle force, 'm' to switch layers mode, 'g' to switch git mode, 'p' to switch package workspaces."),
+			ui.Hint.Render(layersModeDescription(m.layersMode)),
+			ui.Hint.Render(gitModeDescription(m.gitMode)),
 		)
 		content := lipgloss.JoinVertical(
 			lipgloss.Left,
@@ -266,6 +355,7 @@ func (m *initModel) View() string {
 			ui.Subtitle.Render("Creating directories and cloning layers repository."),
 			"",
 			ui.Content.Render(fmt.Sprintf("%s  %s", m.spinner.View(), "Working...")),
+			ui.Content.Render(m.progress.View()),
 		))
 	case initStepDone:
 		return lipgloss.JoinVertical(
@@ -285,14 +375,21 @@ func (m *initModel) View() string {
 	}
 }
 
+// CapturesText lets the ref filter receive 'q'.
+func (m *initModel) CapturesText() bool {
+	return m.step == initStepBranch
+}
+
 func (m *initModel) Hints() []string {
 	switch m.step {
 	case initStepPath:
 		return []string{"Enter to continue", "Ctrl+C cancel"}
 	case initStepBranch:
-		return []string{"Enter next", "b back", "Ctrl+C cancel"}
+		return []string{"Type to filter", "↑/↓ move", "Enter select", "Esc back", "Ctrl+C cancel"}
+	case initStepLayers:
+		return []string{"↑/↓ move", "Space toggle", "Enter next", "b back", "Ctrl+C cancel"}
 	case initStepSummary:
-		return []string{"Enter confirm", "f toggle force", "b back", "Ctrl+C cancel"}
+		return []string{"Enter confirm", "f toggle force", "m layers mode", "g git mode", "b back", "Ctrl+C cancel"}
 	case initStepRunning:
 		return []string{"Ctrl+C abort (best effort)"}
 	case initStepDone:
@@ -311,9 +408,24 @@ func (m *initModel) Result() (string, error) {
 	return filepath.Clean(m.pathInput.Value()), m.err
 }
 
-func RunInitTUI(ctx context.Context, cfg *config.Config, pathHint, branchHint string, force bool) (string, error) {
+func RunInitTUI(ctx context.Context, cfg *config.Config, pathHint, branchHint, layersMode, gitMode, packageWorkspaces string, layerHints []string, force bool, cloneOpts ...gitutil.CloneOption) (string, error) {
+	mode, err := cfg.ResolveLayersMode(layersMode)
+	if err != nil {
+		return "", err
+	}
+	repoMode, err := cfg.ResolveGitMode(gitMode)
+	if err != nil {
+		return "", err
+	}
+	packages, err := cfg.ResolvePackageWorkspaces(packageWorkspaces)
+	if err != nil {
+		return "", err
+	}
+	if packages == "" {
+		packages = "none"
+	}
 	logs := ui.NewLogBuffer(128)
-	model := newInitModel(ctx, cfg, pathHint, branchHint, force, logs)
+	model := newInitModel(ctx, cfg, pathHint, branchHint, mode, repoMode, packages, layerHints, force, logs, cloneOpts)
 	root := ui.NewRootModel("Initialize Workspace", "Prepare /apps and /layers with starter content.", model, logs, nil)
 	final, err := ui.Run(root, tea.WithAltScreen())
 	if err != nil {
@@ -329,3 +441,62 @@ func RunInitTUI(ctx context.Context, cfg *config.Config, pathHint, branchHint st
 	}
 	return child.Result()
 }
+
+func nextLayersMode(current string) string {
+	return nextMode(config.LayersModes, current)
+}
+
+func nextMode(modes []string, current string) string {
+	for i, mode := range modes {
+		if mode == current {
+			return modes[(i+1)%len(modes)]
+		}
+	}
+	return modes[0]
+}
+
+// packageWorkspaceChoices are the package workspace settings the summary cycles
+// through.
+var packageWorkspaceChoices = append([]string{"none"}, config.PackageManagers...)
+
+func gitModeDescription(mode string) string {
+	if mode == gitModeMonorepo {
+		return "monorepo: one git repository at the workspace root; new apps and layers are staged into it."
+	}
+	return "per-project: /layers and every app get their own git repository."
+}
+
+func layersModeDescription(mode string) string {
+	switch mode {
+	case layersModeRemote:
+		return "remote: keep the layers clone with the base repository as the 'upstream' remote."
+	case layersModeSubtree:
+		return "subtree: add the layers to a workspace git repository with git subtree."
+	default:
+		return "snapshot: copy the layers without history and record the base commit."
+	}
+}
+
+// initLayerChoices offers the configured modules, which name the base layers,
+// plus any layer requested on the command line.
+func initLayerChoices(cfg *config.Config, hints []string) []string {
+	choices := availableModules(cfg)
+	for _, hint := range hints {
+		if !containsModule(choices, hint) {
+			choices = append(choices, hint)
+		}
+	}
+	sort.Strings(choices)
+	return choices
+}
+
+func layerSelectionLabel(names []string) string {
+	if len(names) == 0 {
+		return "all"
+	}
+	return strings.Join(names, ", ")
+}
+
+func renderLayerSelection(names []string) string {
+	return summaryStyle.Render("Selected: " + layerSelectionLabel(names))
+}
@@ -0,0 +1,811 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nuxt-apps/couchfusion/internal/config"
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+	"github.com/nuxt-apps/couchfusion/internal/source"
+)
+
+// Layers modes decide how /layers stays connected to the base layers repository.
+// snapshot discards the clone history and records the base commit in
+// couchfusion.lock; remote keeps the clone with the repository as the "upstream"
+// remote; subtree adds the layers to a workspace-level repository with
+// `git subtree add --squash`.
+const (
+	layersModeSnapshot = "snapshot"
+	layersModeRemote   = "remote"
+	layersModeSubtree  = "subtree"
+)
+
+const (
+	upstreamRemote = "upstream"
+	layersPrefix   = "layers"
+)
+
+// LayerUpdate is the result of bringing upstream changes into one layer. Layer is
+// the top-level directory name, or empty for files at the root of /layers.
+type LayerUpdate struct {
+	Layer  string
+	Report MergeReport
+}
+
+// DisplayName returns the layer name used in summaries.
+func (u LayerUpdate) DisplayName() string {
+	if u.Layer == "" {
+		return "(layers root)"
+	}
+	return u.Layer
+}
+
+// WriteLayerUpdates prints a summary per layer, skipping layers without changes.
+func WriteLayerUpdates(w io.Writer, updates []LayerUpdate, dryRun bool) {
+	printed := 0
+	for _, u := range updates {
+		r := u.Report
+		if len(r.Updated)+len(r.Added)+len(r.Deleted)+len(r.Conflicts)+len(r.Rejected) == 0 {
+			continue
+		}
+		if printed > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "[%s] ", u.DisplayName())
+		r.WriteSummary(w, dryRun)
+		printed++
+	}
+	if printed == 0 {
+		fmt.Fprintln(w, "Base layers are already up to date.")
+	}
+}
+
+// LayerUpdatesHaveConflicts reports whether any layer needs manual resolution.
+func LayerUpdatesHaveConflicts(updates []LayerUpdate) bool {
+	for _, u := range updates {
+		if u.Report.HasConflicts() {
+			return true
+		}
+	}
+	return false
+}
+
+// initLayers populates layersDir according to mode and returns the revision it
+// was created from. When selected is non-empty only those layers are kept in the
+// working tree: snapshot workspaces prune the others, git-backed modes hide them
+// with a sparse checkout.
+func initLayers(ctx context.Context, root string, repo config.RepoConfig, ref, mode string, selected []string, cloneOpts []gitutil.CloneOption) (templateRevision, error) {
+	layersDir := filepath.Join(root, layersPrefix)
+
+	if mode != layersModeSnapshot && source.IsLocal(repo.URL) {
+		return templateRevision{}, fmt.Errorf("layers mode %s needs a git repository URL; %s can only be copied (use --layers-mode snapshot)", mode, repo.URL)
+	}
+
+	if mode == layersModeSubtree {
+		revision, err := initSubtreeLayers(ctx, root, repo, ref, cloneOpts)
+		if err != nil {
+			return templateRevision{}, err
+		}
+		return revision, selectLayers(ctx, root, layersDir, mode, selected)
+	}
+
+	if err := gitutil.Clone(ctx, repo.URL, ref, layersDir, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+		return templateRevision{}, err
+	}
+
+	revision, err := resolveTemplateRevision(ctx, repo.URL, ref, layersDir)
+	if err != nil {
+		return templateRevision{}, err
+	}
+
+	if mode == layersModeSnapshot {
+		// RunInit replaces the clone's history according to the git mode.
+		return revision, selectLayers(ctx, root, layersDir, mode, selected)
+	}
+
+	if err := selectLayers(ctx, root, layersDir, mode, selected); err != nil {
+		return templateRevision{}, err
+	}
+
+	if _, err := gitutil.Run(ctx, layersDir, "remote", "rename", "origin", upstreamRemote); err != nil {
+		return templateRevision{}, err
+	}
+	if _, err := gitutil.Run(ctx, layersDir, "symbolic-ref", "--quiet", "HEAD"); err != nil {
+		// Pinned clones are detached; give local work a branch to live on.
+		if _, err := gitutil.Run(ctx, layersDir, "checkout", "--quiet", "-b", "main"); err != nil {
+			return templateRevision{}, err
+		}
+	}
+	return revision, nil
+}
+
+func initSubtreeLayers(ctx context.Context, root string, repo config.RepoConfig, ref string, cloneOpts []gitutil.CloneOption) (templateRevision, error) {
+	// git subtree add refuses to write into an existing prefix directory.
+	if err := os.Remove(filepath.Join(root, layersPrefix)); err != nil && !os.IsNotExist(err) {
+		return templateRevision{}, fmt.Errorf("failed to prepare layers directory: %w", err)
+	}
+	if err := ensureWorkspaceRepo(ctx, root); err != nil {
+		return templateRevision{}, err
+	}
+
+	commit, err := gitutil.Fetch(ctx, repo.URL, ref, root, repo.Protocol, repo.AuthPrompt, cloneOpts...)
+	if err != nil {
+		return templateRevision{}, err
+	}
+	message := fmt.Sprintf("Add base layers from %s at %s", repo.URL, shortCommit(commit))
+	if _, err := gitutil.Run(ctx, root, "subtree", "add", "--prefix="+layersPrefix, "--squash", commit, "-m", message); err != nil {
+		return templateRevision{}, err
+	}
+	return newTemplateRevision(repo.URL, ref, commit), nil
+}
+
+// selectLayers keeps only the selected top-level layer directories of a freshly
+// populated layersDir. An empty selection keeps everything.
+func selectLayers(ctx context.Context, root, layersDir, mode string, selected []string) error {
+	if len(selected) == 0 {
+		return nil
+	}
+	available, err := layerDirs(layersDir)
+	if err != nil {
+		return err
+	}
+	known := map[string]struct{}{}
+	for _, name := range available {
+		known[name] = struct{}{}
+	}
+	for _, name := range selected {
+		if _, ok := known[name]; !ok {
+			return fmt.Errorf("layer '%s' is not part of the base layers (available: %s)", name, strings.Join(available, ", "))
+		}
+	}
+
+	if mode != layersModeSnapshot {
+		return applySparseLayers(ctx, root, mode, selected)
+	}
+	keep := layersManifest{Selected: selected}
+	for _, name := range available {
+		if keep.includes(name) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(layersDir, name)); err != nil {
+			return fmt.Errorf("failed to remove unselected layer %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// applySparseLayers limits the working tree of a remote or subtree workspace to
+// the selected layers. Non-cone patterns keep every other path of the repository
+// checked out, so apps committed to a subtree workspace are never hidden.
+func applySparseLayers(ctx context.Context, root, mode string, selected []string) error {
+	dir, prefix := filepath.Join(root, layersPrefix), ""
+	if mode == layersModeSubtree {
+		dir, prefix = root, layersPrefix+"/"
+	}
+
+	patterns := []string{"/*", "!/" + prefix + "*/", "/" + prefix + ".*/"}
+	for _, name := range selected {
+		patterns = append(patterns, "/"+prefix+name+"/")
+	}
+	args := append([]string{"sparse-checkout", "set", "--no-cone"}, patterns...)
+	_, err := gitutil.Run(ctx, dir, args...)
+	return err
+}
+
+// RunLayersAdd materializes more base layers in a workspace created with a layer
+// selection, taking them from the base revision recorded in couchfusion.lock.
+func RunLayersAdd(ctx context.Context, cfg *config.Config, names []string, cloneOpts ...gitutil.CloneOption) error {
+	root, manifest, base, selected, err := resolveLayersAdd(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	if manifest.Layers.Mode == layersModeSnapshot {
+		if err := copyBaseLayers(ctx, cfg, root, base, names, cloneOpts); err != nil {
+			return err
+		}
+	} else if err := applySparseLayers(ctx, root, manifest.Layers.Mode, selected); err != nil {
+		return err
+	}
+
+	manifest.Layers.Selected = selected
+	return manifest.save(root)
+}
+
+// PlanLayersAdd resolves a `layers add` run like RunLayersAdd and describes it.
+// Snapshot workspaces check the names when the base revision is fetched.
+func PlanLayersAdd(ctx context.Context, names []string) (*Plan, error) {
+	root, manifest, base, selected, err := resolveLayersAdd(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := newPlan("layers add", root)
+	plan.set("layers", strings.Join(names, ", "))
+	plan.set("layers mode", manifest.Layers.Mode)
+	plan.set("base revision", fmt.Sprintf("%s at %s", base.URL, valueOr(shortCommit(base.Commit), base.Ref)))
+	if manifest.Layers.Mode == layersModeSnapshot {
+		plan.action("fetch the base revision into a temporary directory and move %s into %s", strings.Join(names, ", "), layersPrefix)
+		for _, name := range names {
+			plan.createDir(filepath.Join(root, layersPrefix, name))
+		}
+	} else {
+		plan.action("widen the sparse checkout to: %s", strings.Join(selected, ", "))
+	}
+
+	manifest.Layers.Selected = selected
+	err = planRootFiles(ctx, plan, root, manifest.save, manifestFileName)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// resolveLayersAdd validates names against the workspace in the current
+// directory and returns it with the base revision and the new layer selection.
+func resolveLayersAdd(ctx context.Context, names []string) (string, *workspaceManifest, templateRevision, []string, error) {
+	fail := func(err error) (string, *workspaceManifest, templateRevision, []string, error) {
+		return "", nil, templateRevision{}, nil, err
+	}
+
+	root, manifest, err := openWorkspace()
+	if err != nil {
+		return fail(err)
+	}
+	if len(manifest.Layers.Selected) == 0 {
+		return fail(errors.New("every base layer is already present in this workspace"))
+	}
+	for _, name := range names {
+		if manifest.Layers.includes(name) {
+			return fail(fmt.Errorf("layer '%s' is already present in this workspace", name))
+		}
+	}
+
+	lock, err := loadLock(root)
+	if err != nil {
+		return fail(err)
+	}
+	base, ok := lock.Entries[layersPrefix]
+	if !ok {
+		return fail(fmt.Errorf("no base layers revision recorded in %s", lockFileName))
+	}
+
+	switch manifest.Layers.Mode {
+	case layersModeSnapshot:
+	case layersModeRemote, layersModeSubtree:
+		dir, prefix := filepath.Join(root, layersPrefix), ""
+		if manifest.Layers.Mode == layersModeSubtree {
+			dir, prefix = root, layersPrefix+"/"
+		}
+		for _, name := range names {
+			if _, err := gitutil.Run(ctx, dir, "cat-file", "-e", "HEAD:"+prefix+name); err != nil {
+				return fail(fmt.Errorf("layer '%s' is not part of the base layers", name))
+			}
+		}
+	default:
+		return fail(fmt.Errorf("unknown layers mode '%s' in %s", manifest.Layers.Mode, manifestFileName))
+	}
+
+	selected := append(append([]string{}, manifest.Layers.Selected...), names...)
+	sort.Strings(selected)
+	return root, manifest, base, selected, nil
+}
+
+// copyBaseLayers checks out the base revision next to /layers and moves the named
+// layer directories into place.
+func copyBaseLayers(ctx context.Context, cfg *config.Config, root string, base templateRevision, names []string, cloneOpts []gitutil.CloneOption) error {
+	repo := cfg.Repos["init"]
+	if !gitutil.SameRepository(repo.URL, base.URL) {
+		repo = cfg.ResolveRepo(config.RepoConfig{URL: base.URL})
+	}
+	cloneOpts = repoCloneOptions(repo, cloneOpts)
+	ref := base.Commit
+	if ref == "" {
+		// Local sources without history can only be copied at their current state.
+		ref = base.Ref
+	}
+
+	// Staying inside the workspace keeps the final rename on one filesystem.
+	tmp, err := os.MkdirTemp(root, ".couchfusion-layers-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	checkout := filepath.Join(tmp, "base")
+	if err := gitutil.Clone(ctx, repo.URL, ref, checkout, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+		return fmt.Errorf("failed to fetch base revision: %w", err)
+	}
+
+	layersDir := filepath.Join(root, layersPrefix)
+	for _, name := range names {
+		src := filepath.Join(checkout, name)
+		if info, err := os.Stat(src); err != nil || !info.IsDir() {
+			return fmt.Errorf("layer '%s' is not part of %s", name, repo.URL)
+		}
+		dest := filepath.Join(layersDir, name)
+		if _, err := os.Stat(dest); err == nil {
+			return fmt.Errorf("%s already exists", dest)
+		}
+	}
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(checkout, name), filepath.Join(layersDir, name)); err != nil {
+			return fmt.Errorf("failed to add layer %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ensureWorkspaceRepo makes root a git repository with at least one commit, which
+// git subtree needs to record its merges.
+func ensureWorkspaceRepo(ctx context.Context, root string) error {
+	if _, err := os.Stat(filepath.Join(root, ".git")); os.IsNotExist(err) {
+		if _, err := gitutil.Run(ctx, root, "init", "--quiet"); err != nil {
+			return err
+		}
+	}
+	if _, err := gitutil.Run(ctx, root, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		return nil
+	}
+	_, err := gitutil.Run(ctx, root, "commit", "--quiet", "--allow-empty", "-m", "Initialize couchfusion workspace")
+	return err
+}
+
+// RunLayersUpdate brings upstream changes from the base layers repository at
+// targetRef (the configured ref when empty) into /layers. Snapshot workspaces can
+// limit the update to the named layers; remote and subtree workspaces always merge
+// the whole repository through git.
+func RunLayersUpdate(ctx context.Context, cfg *config.Config, targetRef string, layers []string, dryRun bool, cloneOpts ...gitutil.CloneOption) ([]LayerUpdate, error) {
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine current working directory: %w", err)
+	}
+	if err := checkInitialized(root); err != nil {
+		return nil, err
+	}
+
+	manifest, err := loadManifest(root)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := loadLock(root)
+	if err != nil {
+		return nil, err
+	}
+	base, ok := lock.Entries[layersPrefix]
+	if !ok || base.Commit == "" {
+		return nil, fmt.Errorf("no base layers commit recorded in %s; layers update needs a workspace initialized from a git repository", lockFileName)
+	}
+
+	repo := cfg.Repos["init"]
+	if !gitutil.SameRepository(repo.URL, base.URL) {
+		// Keep fetching from the repository the layers were created from.
+		repo = cfg.ResolveRepo(config.RepoConfig{URL: base.URL})
+	}
+	ref := repo.ResolveRef(targetRef)
+	if ref == "" {
+		ref = base.Ref
+	}
+
+	if manifest.Layers.Mode != layersModeSnapshot && len(layers) > 0 {
+		return nil, fmt.Errorf("layers mode %s merges the whole repository; layer names are only supported in snapshot mode", manifest.Layers.Mode)
+	}
+
+	u := layersUpdater{
+		root:      root,
+		repo:      repo,
+		ref:       ref,
+		base:      base,
+		lock:      lock,
+		layers:    manifest.Layers,
+		dryRun:    dryRun,
+		cloneOpts: repoCloneOptions(repo, cloneOpts),
+	}
+
+	var updates []LayerUpdate
+	switch manifest.Layers.Mode {
+	case layersModeSnapshot:
+		updates, err = u.updateSnapshot(ctx, layers)
+	case layersModeRemote:
+		updates, err = u.updateRemote(ctx)
+	case layersModeSubtree:
+		updates, err = u.updateSubtree(ctx)
+	default:
+		return nil, fmt.Errorf("unknown layers mode '%s' in %s", manifest.Layers.Mode, manifestFileName)
+	}
+	if err != nil || dryRun {
+		return updates, err
+	}
+	return updates, lock.save(root)
+}
+
+type layersUpdater struct {
+	root      string
+	repo      config.RepoConfig
+	ref       string
+	base      templateRevision
+	lock      *workspaceLock
+	layers    layersManifest
+	dryRun    bool
+	cloneOpts []gitutil.CloneOption
+}
+
+// updateSnapshot three-way merges each layer directory between its recorded base
+// commit and the target revision. Layers updated individually get their own
+// layers/<name> lock entry until the next full update.
+func (u layersUpdater) updateSnapshot(ctx context.Context, names []string) ([]LayerUpdate, error) {
+	tmp, err := os.MkdirTemp("", "couchfusion-layers-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	targetDir := filepath.Join(tmp, "target")
+	if err := gitutil.Clone(ctx, u.repo.URL, u.ref, targetDir, u.repo.Protocol, u.repo.AuthPrompt, u.cloneOpts...); err != nil {
+		return nil, fmt.Errorf("failed to fetch target revision: %w", err)
+	}
+	target, err := resolveTemplateRevision(ctx, u.repo.URL, u.ref, targetDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Base checkouts are shared between layers recorded at the same commit.
+	baseDirs := map[string]string{}
+	baseDir := func(commit string) (string, error) {
+		if dir, ok := baseDirs[commit]; ok {
+			return dir, nil
+		}
+		dir := filepath.Join(tmp, "base-"+shortCommit(commit))
+		if err := gitutil.Clone(ctx, u.repo.URL, commit, dir, u.repo.Protocol, u.repo.AuthPrompt, u.cloneOpts...); err != nil {
+			return "", fmt.Errorf("failed to fetch base revision %s: %w", shortCommit(commit), err)
+		}
+		baseDirs[commit] = dir
+		return dir, nil
+	}
+
+	mainBase, err := baseDir(u.base.Commit)
+	if err != nil {
+		return nil, err
+	}
+	available, err := layerDirs(mainBase, targetDir)
+	if err != nil {
+		return nil, err
+	}
+
+	full := len(names) == 0
+	if full {
+		names = []string{""}
+		for _, name := range available {
+			if u.layers.includes(name) {
+				names = append(names, name)
+			}
+		}
+	} else {
+		known := map[string]struct{}{}
+		for _, name := range available {
+			known[name] = struct{}{}
+		}
+		for _, name := range names {
+			if _, ok := known[name]; !ok {
+				return nil, fmt.Errorf("layer '%s' is not part of %s", name, u.repo.URL)
+			}
+			if !u.layers.includes(name) {
+				return nil, fmt.Errorf("layer '%s' is not materialized in this workspace (use `couchfusion layers add %s`)", name, name)
+			}
+		}
+	}
+
+	layersDir := filepath.Join(u.root, layersPrefix)
+	updates := []LayerUpdate{}
+	for _, name := range names {
+		base := u.base
+		if rev, ok := u.lock.Entries[layersPrefix+"/"+name]; ok && name != "" && rev.URL == u.base.URL && rev.Commit != "" {
+			base = rev
+		}
+		dir, err := baseDir(base.Commit)
+		if err != nil {
+			return nil, err
+		}
+
+		update := LayerUpdate{Layer: name, Report: MergeReport{BaseCommit: base.Commit, TargetCommit: target.Commit}}
+		if base.Commit != target.Commit {
+			merge := treeMerge{
+				baseDir:   filepath.Join(dir, name),
+				theirsDir: filepath.Join(targetDir, name),
+				oursDir:   filepath.Join(layersDir, name),
+				dryRun:    u.dryRun,
+			}
+			if name == "" {
+				// The root unit only covers files directly under /layers.
+				merge.skip = func(rel string) bool { return strings.Contains(rel, "/") }
+			}
+			if err := merge.run(ctx, &update.Report); err != nil {
+				return updates, fmt.Errorf("failed to update %s: %w", update.DisplayName(), err)
+			}
+		}
+		updates = append(updates, update)
+	}
+
+	if full {
+		u.lock.Entries[layersPrefix] = target
+		for key, rev := range u.lock.Entries {
+			if strings.HasPrefix(key, layersPrefix+"/") && rev.URL == target.URL {
+				delete(u.lock.Entries, key)
+			}
+		}
+	} else {
+		for _, name := range names {
+			u.lock.Entries[layersPrefix+"/"+name] = target
+		}
+	}
+	return updates, nil
+}
+
+// updateRemote fetches the target revision into the layers clone and merges it.
+func (u layersUpdater) updateRemote(ctx context.Context) ([]LayerUpdate, error) {
+	layersDir := filepath.Join(u.root, layersPrefix)
+	if err := u.requireClean(ctx, layersDir); err != nil {
+		return nil, err
+	}
+
+	repoURL := u.repo.URL
+	if remote, err := gitutil.Run(ctx, layersDir, "remote", "get-url", upstreamRemote); err == nil && remote != "" {
+		repoURL = remote
+	}
+	dir, cleanup, err := u.fetchDir(ctx, layersDir)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	target, err := gitutil.Fetch(ctx, repoURL, u.ref, dir, u.repo.Protocol, u.repo.AuthPrompt, u.cloneOpts...)
+	if err != nil {
+		return nil, err
+	}
+	mergeBase, err := gitutil.Run(ctx, dir, "merge-base", "HEAD", target)
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Update base layers to %s", shortCommit(target))
+	return u.mergeWithGit(ctx, dir, "", mergeBase, target,
+		[]string{"merge", "--no-edit", "-m", message, target})
+}
+
+// updateSubtree fetches the target revision into the workspace repository and
+// merges it into the layers prefix with git subtree.
+func (u layersUpdater) updateSubtree(ctx context.Context) ([]LayerUpdate, error) {
+	if err := u.requireClean(ctx, u.root); err != nil {
+		return nil, err
+	}
+
+	dir, cleanup, err := u.fetchDir(ctx, u.root)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	target, err := gitutil.Fetch(ctx, u.repo.URL, u.ref, dir, u.repo.Protocol, u.repo.AuthPrompt, u.cloneOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gitutil.Run(ctx, dir, "cat-file", "-e", u.base.Commit+"^{commit}"); err != nil {
+		// Squashed subtrees do not keep the upstream history reachable.
+		if _, err := gitutil.Fetch(ctx, u.repo.URL, u.base.Commit, dir, u.repo.Protocol, u.repo.AuthPrompt, u.cloneOpts...); err != nil {
+			return nil, fmt.Errorf("failed to fetch base revision: %w", err)
+		}
+	}
+
+	message := fmt.Sprintf("Update base layers to %s", shortCommit(target))
+	return u.mergeWithGit(ctx, dir, layersPrefix+"/", u.base.Commit, target,
+		[]string{"subtree", "merge", "--prefix=" + layersPrefix, "--squash", "-m", message, target})
+}
+
+// fetchDir returns the repository to fetch the upstream revisions into: repo
+// itself, or for dry runs a temporary clone at repo's HEAD that shares its
+// objects, so fetched objects and FETCH_HEAD never reach the workspace.
+func (u layersUpdater) fetchDir(ctx context.Context, repo string) (string, func(), error) {
+	if !u.dryRun {
+		return repo, func() {}, nil
+	}
+	head, err := gitutil.Run(ctx, repo, "rev-parse", "HEAD")
+	if err != nil {
+		return "", nil, err
+	}
+	tmp, err := os.MkdirTemp("", "couchfusion-layers-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	scratch := filepath.Join(tmp, "repo")
+	if _, err := gitutil.Run(ctx, tmp, "clone", "--quiet", "--shared", "--no-checkout", repo, scratch); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if _, err := gitutil.Run(ctx, scratch, "update-ref", "--no-deref", "HEAD", head); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return scratch, cleanup, nil
+}
+
+func (u layersUpdater) requireClean(ctx context.Context, dir string) error {
+	if u.dryRun {
+		return nil
+	}
+	clean, err := gitutil.IsClean(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if !clean {
+		return fmt.Errorf("%s has uncommitted changes; commit or stash them before updating layers", dir)
+	}
+	return nil
+}
+
+// mergeWithGit reports upstream changes between base and target and, unless
+// running dry, runs mergeArgs in dir. prefix locates the layers inside dir's
+// HEAD ("" for the layers clone, "layers/" for a subtree). Dry runs trial-merge
+// paths changed on both sides; real merges report the paths git left unmerged.
+func (u layersUpdater) mergeWithGit(ctx context.Context, dir, prefix, base, target string, mergeArgs []string) ([]LayerUpdate, error) {
+	upstream, err := gitutil.DiffNameStatus(ctx, dir, base, target)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := map[string]struct{}{}
+	if u.dryRun {
+		local := "HEAD:" + strings.TrimSuffix(prefix, "/")
+		localChanges, err := gitutil.DiffNameStatus(ctx, dir, base, local)
+		if err != nil {
+			return nil, err
+		}
+		for path, status := range upstream {
+			localStatus, changed := localChanges[path]
+			if !changed {
+				continue
+			}
+			conflict, err := trialMerge(ctx, dir, path, prefix, base, target, localStatus, status)
+			if err != nil {
+				return nil, err
+			}
+			if conflict {
+				conflicts[path] = struct{}{}
+			}
+		}
+	} else if _, mergeErr := gitutil.Run(ctx, dir, mergeArgs...); mergeErr != nil {
+		unmerged, err := gitutil.UnmergedPaths(ctx, dir)
+		if err != nil || len(unmerged) == 0 {
+			return nil, mergeErr
+		}
+		for _, path := range unmerged {
+			conflicts[strings.TrimPrefix(path, prefix)] = struct{}{}
+		}
+	}
+
+	if !u.dryRun {
+		u.lock.Entries[layersPrefix] = newTemplateRevision(u.repo.URL, u.ref, target)
+	}
+
+	// Layers left out by a sparse selection are merged by git but not reported.
+	updates := []LayerUpdate{}
+	for _, update := range groupLayerChanges(upstream, conflicts, u.base.Commit, target) {
+		if update.Layer == "" || u.layers.includes(update.Layer) {
+			updates = append(updates, update)
+		}
+	}
+	return updates, nil
+}
+
+// trialMerge reports whether merging path changed on both sides would conflict.
+// The local version is read from HEAD at prefix+path.
+func trialMerge(ctx context.Context, dir, path, prefix, base, target, localStatus, upstreamStatus string) (bool, error) {
+	if localStatus == "D" || upstreamStatus == "D" {
+		// Deleted on both sides merges cleanly; delete/modify does not.
+		return localStatus != upstreamStatus, nil
+	}
+	var baseData []byte
+	if upstreamStatus != "A" {
+		var err error
+		if baseData, err = gitutil.ReadBlob(ctx, dir, base, path); err != nil {
+			return false, err
+		}
+	}
+	ours, err := gitutil.ReadBlob(ctx, dir, "HEAD", prefix+path)
+	if err != nil {
+		return false, err
+	}
+	theirs, err := gitutil.ReadBlob(ctx, dir, target, path)
+	if err != nil {
+		return false, err
+	}
+	if isBinary(ours) || isBinary(baseData) || isBinary(theirs) {
+		return !bytes.Equal(ours, theirs), nil
+	}
+	_, conflicts, err := gitutil.MergeFile(ctx, ours, baseData, theirs, [3]string{"ours", "base", "theirs"})
+	return conflicts > 0, err
+}
+
+// groupLayerChanges splits repository-relative changes into per-layer reports.
+func groupLayerChanges(upstream map[string]string, conflicts map[string]struct{}, base, target string) []LayerUpdate {
+	byLayer := map[string]*MergeReport{}
+	report := func(path string) (*MergeReport, string) {
+		layer, rel := "", path
+		if i := strings.Index(path, "/"); i >= 0 {
+			layer, rel = path[:i], path[i+1:]
+		}
+		r, ok := byLayer[layer]
+		if !ok {
+			r = &MergeReport{BaseCommit: base, TargetCommit: target}
+			byLayer[layer] = r
+		}
+		return r, rel
+	}
+
+	paths := make([]string, 0, len(upstream))
+	for path := range upstream {
+		paths = append(paths, path)
+	}
+	for path := range conflicts {
+		if _, ok := upstream[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		r, rel := report(path)
+		if _, conflict := conflicts[path]; conflict {
+			r.Conflicts = append(r.Conflicts, rel)
+			continue
+		}
+		switch upstream[path] {
+		case "A":
+			r.Added = append(r.Added, rel)
+		case "D":
+			r.Deleted = append(r.Deleted, rel)
+		default:
+			r.Updated = append(r.Updated, rel)
+		}
+	}
+
+	layers := make([]string, 0, len(byLayer))
+	for layer := range byLayer {
+		layers = append(layers, layer)
+	}
+	sort.Strings(layers)
+
+	updates := make([]LayerUpdate, 0, len(layers))
+	for _, layer := range layers {
+		updates = append(updates, LayerUpdate{Layer: layer, Report: *byLayer[layer]})
+	}
+	return updates
+}
+
+// layerDirs returns the sorted union of top-level directories in dirs, ignoring
+// hidden ones.
+func layerDirs(dirs ...string) ([]string, error) {
+	seen := map[string]struct{}{}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				seen[entry.Name()] = struct{}{}
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
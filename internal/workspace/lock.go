@@ -0,0 +1,89 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+)
+
+const lockFileName = "couchfusion.lock"
+
+// templateRevision records the exact template revision a scaffold was created from.
+type templateRevision struct {
+	URL        string `json:"url"`
+	Ref        string `json:"ref,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	ResolvedAt string `json:"resolvedAt"`
+}
+
+// workspaceLock is persisted as couchfusion.lock at the workspace root and maps
+// workspace-relative paths (layers, apps/<name>, layers/<name>) to revisions.
+type workspaceLock struct {
+	LockVersion int                         `json:"lockVersion"`
+	Entries     map[string]templateRevision `json:"entries"`
+}
+
+// resolveTemplateRevision captures the commit checked out in targetDir. It must run
+// before reinitializeGitRepo discards the clone history.
+func resolveTemplateRevision(ctx context.Context, repoURL, ref, targetDir string) (templateRevision, error) {
+	commit, err := gitutil.ResolveCommit(ctx, repoURL, targetDir)
+	if err != nil {
+		return templateRevision{}, err
+	}
+	return newTemplateRevision(repoURL, ref, commit), nil
+}
+
+func newTemplateRevision(repoURL, ref, commit string) templateRevision {
+	return templateRevision{
+		URL:        repoURL,
+		Ref:        ref,
+		Commit:     commit,
+		ResolvedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func loadLock(root string) (*workspaceLock, error) {
+	lock := &workspaceLock{LockVersion: 1, Entries: map[string]templateRevision{}}
+	data, err := os.ReadFile(filepath.Join(root, lockFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lock, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", lockFileName, err)
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", lockFileName, err)
+	}
+	if lock.Entries == nil {
+		lock.Entries = map[string]templateRevision{}
+	}
+	return lock, nil
+}
+
+func (l *workspaceLock) save(root string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(filepath.Join(root, lockFileName), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", lockFileName, err)
+	}
+	return nil
+}
+
+// recordRevision stores rev under the workspace-relative key in couchfusion.lock.
+func recordRevision(root, key string, rev templateRevision) error {
+	lock, err := loadLock(root)
+	if err != nil {
+		return err
+	}
+	lock.Entries[filepath.ToSlash(key)] = rev
+	return lock.save(root)
+}
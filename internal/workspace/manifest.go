@@ -0,0 +1,131 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const manifestFileName = "couchfusion.workspace.json"
+
+// workspaceManifest is persisted as couchfusion.workspace.json at the workspace
+// root and records how the workspace was initialized.
+type workspaceManifest struct {
+	ManifestVersion int            `json:"manifestVersion"`
+	Layers          layersManifest `json:"layers"`
+	// GitMode is per-project or monorepo; see RunInit.
+	GitMode string `json:"gitMode,omitempty"`
+	// PackageWorkspaces names the package manager (bun, npm or pnpm) whose root
+	// workspace ties apps and layers together; empty when disabled.
+	PackageWorkspaces string `json:"packageWorkspaces,omitempty"`
+	// Profile is the config profile commands inside the workspace use unless
+	// --profile or COUCHFUSION_PROFILE select another; see RecordedProfile.
+	Profile string `json:"profile,omitempty"`
+}
+
+type layersManifest struct {
+	// Mode is snapshot, remote or subtree; see RunInit.
+	Mode string `json:"mode"`
+	// Selected lists the materialized layers; empty means every layer.
+	Selected []string `json:"selected,omitempty"`
+}
+
+// includes reports whether layer is materialized in the workspace.
+func (l layersManifest) includes(layer string) bool {
+	if len(l.Selected) == 0 {
+		return true
+	}
+	for _, name := range l.Selected {
+		if name == layer {
+			return true
+		}
+	}
+	return false
+}
+
+// loadManifest reads the workspace manifest. Workspaces created before the
+// manifest existed are reported as snapshot workspaces.
+func loadManifest(root string) (*workspaceManifest, error) {
+	manifest := &workspaceManifest{ManifestVersion: 1, Layers: layersManifest{Mode: layersModeSnapshot}, GitMode: gitModePerProject}
+	data, err := os.ReadFile(filepath.Join(root, manifestFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return manifest, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", manifestFileName, err)
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", manifestFileName, err)
+	}
+	if manifest.Layers.Mode == "" {
+		manifest.Layers.Mode = layersModeSnapshot
+	}
+	if manifest.GitMode == "" {
+		manifest.GitMode = gitModePerProject
+	}
+	return manifest, nil
+}
+
+func (m *workspaceManifest) save(root string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(filepath.Join(root, manifestFileName), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", manifestFileName, err)
+	}
+	return nil
+}
+
+// RecordedProfile returns the config profile recorded by the workspace that
+// contains dir (the current directory when empty) and the manifest recording
+// it. The name is empty outside a workspace or when none is recorded.
+func RecordedProfile(dir string) (string, string, error) {
+	if strings.TrimSpace(dir) == "" {
+		var err error
+		if dir, err = os.Getwd(); err != nil {
+			return "", "", fmt.Errorf("unable to determine working directory: %w", err)
+		}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for {
+		path := filepath.Join(dir, manifestFileName)
+		if _, err := os.Stat(path); err == nil {
+			manifest, err := loadManifest(dir)
+			if err != nil {
+				return "", "", err
+			}
+			return manifest.Profile, path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
+
+// RecordProfile records profile in the manifest of the workspace in the
+// current directory; the empty string clears it. It returns the manifest path.
+func RecordProfile(profile string) (string, error) {
+	if err := EnsureCurrentWorkspace(); err != nil {
+		return "", err
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine current working directory: %w", err)
+	}
+	manifest, err := loadManifest(root)
+	if err != nil {
+		return "", err
+	}
+	manifest.Profile = profile
+	return filepath.Join(root, manifestFileName), manifest.save(root)
+}
@@ -0,0 +1,282 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+)
+
+// MergeReport summarizes a three-way merge of template changes into a workspace directory.
+type MergeReport struct {
+	BaseCommit   string
+	TargetCommit string
+
+	Updated   []string
+	Added     []string
+	Deleted   []string
+	Conflicts []string
+	Rejected  []string
+}
+
+// HasConflicts reports whether any path needs manual resolution.
+func (r *MergeReport) HasConflicts() bool {
+	return len(r.Conflicts) > 0 || len(r.Rejected) > 0
+}
+
+// WriteSummary prints the changed, added, deleted and conflicting paths.
+func (r *MergeReport) WriteSummary(w io.Writer, dryRun bool) {
+	verb := "Applied"
+	if dryRun {
+		verb = "Would apply"
+	}
+	fmt.Fprintf(w, "%s template changes %s -> %s\n", verb, shortCommit(r.BaseCommit), shortCommit(r.TargetCommit))
+
+	sections := []struct {
+		title string
+		paths []string
+	}{
+		{"Changed", r.Updated},
+		{"Added", r.Added},
+		{"Deleted", r.Deleted},
+		{"Conflicts (conflict markers)", r.Conflicts},
+		{"Conflicts (.rej files)", r.Rejected},
+	}
+	total := 0
+	for _, section := range sections {
+		if len(section.paths) == 0 {
+			continue
+		}
+		total += len(section.paths)
+		fmt.Fprintf(w, "%s:\n", section.title)
+		for _, p := range section.paths {
+			fmt.Fprintf(w, "  %s\n", p)
+		}
+	}
+	if total == 0 {
+		fmt.Fprintln(w, "No changes.")
+	}
+}
+
+// treeMerge three-way merges the change between baseDir and theirsDir into oursDir.
+type treeMerge struct {
+	baseDir   string
+	theirsDir string
+	oursDir   string
+	// skip excludes slash-separated relative paths from the merge.
+	skip   func(rel string) bool
+	dryRun bool
+}
+
+func (m treeMerge) run(ctx context.Context, report *MergeReport) error {
+	base, err := listTreeFiles(m.baseDir)
+	if err != nil {
+		return err
+	}
+	theirs, err := listTreeFiles(m.theirsDir)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(base)+len(theirs))
+	for rel := range base {
+		paths = append(paths, rel)
+	}
+	for rel := range theirs {
+		if _, ok := base[rel]; !ok {
+			paths = append(paths, rel)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, rel := range paths {
+		if m.skip != nil && m.skip(rel) {
+			continue
+		}
+		if err := m.mergePath(ctx, rel, base, theirs, report); err != nil {
+			return fmt.Errorf("failed to merge %s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+func (m treeMerge) mergePath(ctx context.Context, rel string, base, theirs map[string]fs.FileMode, report *MergeReport) error {
+	_, inBase := base[rel]
+	theirsMode, inTheirs := theirs[rel]
+
+	baseData, err := readIfPresent(filepath.Join(m.baseDir, rel), inBase)
+	if err != nil {
+		return err
+	}
+	theirsData, err := readIfPresent(filepath.Join(m.theirsDir, rel), inTheirs)
+	if err != nil {
+		return err
+	}
+	if inBase && inTheirs && bytes.Equal(baseData, theirsData) {
+		return nil
+	}
+
+	oursPath := filepath.Join(m.oursDir, filepath.FromSlash(rel))
+	oursData, err := os.ReadFile(oursPath)
+	inOurs := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	switch {
+	case !inBase:
+		// Added upstream.
+		if !inOurs {
+			report.Added = append(report.Added, rel)
+			return m.write(oursPath, theirsData, theirsMode)
+		}
+		if bytes.Equal(oursData, theirsData) {
+			return nil
+		}
+		return m.mergeContent(ctx, rel, oursData, nil, theirsData, report)
+	case !inTheirs:
+		// Deleted upstream.
+		if !inOurs {
+			return nil
+		}
+		if bytes.Equal(oursData, baseData) {
+			report.Deleted = append(report.Deleted, rel)
+			if m.dryRun {
+				return nil
+			}
+			return os.Remove(oursPath)
+		}
+		return m.reject(ctx, rel, baseData, nil, report)
+	default:
+		// Modified upstream.
+		if !inOurs {
+			return m.reject(ctx, rel, baseData, theirsData, report)
+		}
+		if bytes.Equal(oursData, baseData) {
+			report.Updated = append(report.Updated, rel)
+			return m.write(oursPath, theirsData, theirsMode)
+		}
+		if bytes.Equal(oursData, theirsData) {
+			return nil
+		}
+		return m.mergeContent(ctx, rel, oursData, baseData, theirsData, report)
+	}
+}
+
+func (m treeMerge) mergeContent(ctx context.Context, rel string, ours, base, theirs []byte, report *MergeReport) error {
+	oursPath := filepath.Join(m.oursDir, filepath.FromSlash(rel))
+	if isBinary(ours) || isBinary(base) || isBinary(theirs) {
+		// Binary files cannot carry markers; keep ours and leave the upstream version alongside.
+		report.Rejected = append(report.Rejected, rel+".rej")
+		return m.write(oursPath+".rej", theirs, 0o644)
+	}
+
+	merged, conflicts, err := gitutil.MergeFile(ctx, ours, base, theirs, [3]string{"app", "base", "starter"})
+	if err != nil {
+		return err
+	}
+	if conflicts > 0 {
+		report.Conflicts = append(report.Conflicts, rel)
+	} else {
+		report.Updated = append(report.Updated, rel)
+	}
+	return m.write(oursPath, merged, 0)
+}
+
+// reject leaves the upstream change from base to theirs, a nil theirs for a
+// deletion, as a unified diff in rel.rej.
+func (m treeMerge) reject(ctx context.Context, rel string, base, theirs []byte, report *MergeReport) error {
+	patch, err := gitutil.UnifiedDiff(ctx, rel, base, theirs)
+	if err != nil {
+		return err
+	}
+	report.Rejected = append(report.Rejected, rel+".rej")
+	return m.write(filepath.Join(m.oursDir, filepath.FromSlash(rel))+".rej", []byte(patch), 0o644)
+}
+
+// write stores data at path unless running dry. A zero mode keeps the existing
+// file's permissions.
+func (m treeMerge) write(path string, data []byte, mode fs.FileMode) error {
+	if m.dryRun {
+		return nil
+	}
+	if mode == 0 {
+		mode = 0o644
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, mode.Perm())
+}
+
+// listTreeFiles returns regular files below dir keyed by slash-separated relative
+// path, skipping .git. A missing dir has no files.
+func listTreeFiles(dir string) (map[string]fs.FileMode, error) {
+	files := map[string]fs.FileMode{}
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return files, nil
+	}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info.Mode().Perm()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+func readIfPresent(path string, present bool) ([]byte, error) {
+	if !present {
+		return nil, nil
+	}
+	return os.ReadFile(path)
+}
+
+func isBinary(data []byte) bool {
+	limit := len(data)
+	if limit > 8000 {
+		limit = 8000
+	}
+	return bytes.IndexByte(data[:limit], 0) >= 0
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	if commit == "" {
+		return "(unknown)"
+	}
+	return commit
+}
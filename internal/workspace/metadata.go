@@ -0,0 +1,251 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	appMetadataFileName = "couchfusion.json"
+	// appMetadataVersion is the schema version this CLI writes. Files without a
+	// schemaVersion are version 1.
+	appMetadataVersion = 2
+)
+
+// appMetadata is the couchfusion.json of an app: how it was scaffolded and
+// every CLI operation applied to it since.
+type appMetadata struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	AppName       string `json:"appName"`
+	// CLIVersion and GeneratedAt describe the last write of the file.
+	CLIVersion  string           `json:"cliVersion"`
+	GeneratedAt string           `json:"generatedAt"`
+	Modules     []string         `json:"modules"`
+	Starter     templateRevision `json:"starter"`
+	// Layers maps each module to the revision of its layer when the module was
+	// added; files migrated from version 1 have none.
+	Layers map[string]templateRevision `json:"layers,omitempty"`
+	// Parameters lists the layer parameters that were set. Values of secret
+	// parameters are never stored.
+	Parameters []appParameter `json:"parameters,omitempty"`
+	// Databases lists the CouchDB databases and documents created for the
+	// app, as paths on the server such as _users/org.couchdb.user:admin.
+	Databases []string       `json:"databases,omitempty"`
+	History   []appOperation `json:"history"`
+}
+
+// appParameter is a layer parameter set while scaffolding or updating an app.
+type appParameter struct {
+	Module string `json:"module"`
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// appOperation is an entry of the history of an app.
+type appOperation struct {
+	Command    string `json:"command"`
+	Detail     string `json:"detail,omitempty"`
+	CLIVersion string `json:"cliVersion"`
+	At         string `json:"at"`
+}
+
+// appMetadataMigrations[v] rewrites a decoded couchfusion.json of schema
+// version v into version v+1.
+var appMetadataMigrations = map[int]func(meta map[string]any) error{
+	1: migrateAppMetadataV1,
+}
+
+// migrateAppMetadataV1 turns the parameters map of `new --from` into a list and
+// starts the history with the scaffold the file was generated by.
+func migrateAppMetadataV1(meta map[string]any) error {
+	if raw, ok := meta["parameters"]; ok {
+		byModule, ok := raw.(map[string]any)
+		if !ok {
+			return errors.New("parameters is not an object")
+		}
+		params := []any{}
+		for _, module := range sortedKeys(byModule) {
+			values, ok := byModule[module].(map[string]any)
+			if !ok {
+				return fmt.Errorf("parameters.%s is not an object", module)
+			}
+			for _, key := range sortedKeys(values) {
+				params = append(params, map[string]any{"module": module, "key": key, "value": values[key]})
+			}
+		}
+		meta["parameters"] = params
+	}
+	if _, ok := meta["history"]; !ok {
+		meta["history"] = []any{map[string]any{
+			"command":    "new",
+			"cliVersion": meta["cliVersion"],
+			"at":         meta["generatedAt"],
+		}}
+	}
+	return nil
+}
+
+// newAppMetadata describes an app that is being scaffolded.
+func newAppMetadata(appName string, modules []string, starter templateRevision) *appMetadata {
+	return &appMetadata{
+		SchemaVersion: appMetadataVersion,
+		AppName:       appName,
+		Modules:       modules,
+		Starter:       starter,
+		History:       []appOperation{},
+	}
+}
+
+// loadAppMetadata reads the couchfusion.json of the app in appDir.
+func loadAppMetadata(appDir string) (*appMetadata, error) {
+	meta, err := readAppMetadata(filepath.Join(appDir, appMetadataFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s is not a couchfusion app (missing %s)", appDir, appMetadataFileName)
+	}
+	return meta, err
+}
+
+// readAppMetadata reads the couchfusion.json at path and migrates it to the
+// current schema version. The file itself is rewritten by the next save.
+func readAppMetadata(path string) (*appMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]any{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	version := 1
+	if v, ok := raw["schemaVersion"]; ok {
+		n, ok := v.(float64)
+		if !ok || n < 1 || n != float64(int(n)) {
+			return nil, fmt.Errorf("%s has an invalid schemaVersion %v", path, v)
+		}
+		version = int(n)
+	}
+	if version > appMetadataVersion {
+		return nil, fmt.Errorf("%s uses schema version %d; this couchfusion supports up to %d, please upgrade the CLI", path, version, appMetadataVersion)
+	}
+	if version < appMetadataVersion {
+		for ; version < appMetadataVersion; version++ {
+			if err := appMetadataMigrations[version](raw); err != nil {
+				return nil, fmt.Errorf("failed to migrate %s from schema version %d: %w", path, version, err)
+			}
+		}
+		raw["schemaVersion"] = appMetadataVersion
+		if data, err = json.Marshal(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	meta := &appMetadata{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if meta.History == nil {
+		meta.History = []appOperation{}
+	}
+	return meta, nil
+}
+
+// save writes the metadata to couchfusion.json in appDir, stamped with the
+// running CLI version.
+func (m *appMetadata) save(appDir string) error {
+	m.SchemaVersion = appMetadataVersion
+	m.CLIVersion = version()
+	m.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	return os.WriteFile(filepath.Join(appDir, appMetadataFileName), data, 0o644)
+}
+
+// record appends an operation to the history.
+func (m *appMetadata) record(command, detail string) {
+	m.History = append(m.History, appOperation{
+		Command:    command,
+		Detail:     detail,
+		CLIVersion: version(),
+		At:         time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// setModules switches the app to modules, recording the layer revision of
+// added modules and forgetting the layers and parameters of removed ones.
+func (m *appMetadata) setModules(modules []string, layers map[string]templateRevision) {
+	m.Modules = modules
+	for module := range m.Layers {
+		if !containsModule(modules, module) {
+			delete(m.Layers, module)
+		}
+	}
+	kept := m.Parameters[:0]
+	for _, param := range m.Parameters {
+		if containsModule(modules, param.Module) {
+			kept = append(kept, param)
+		}
+	}
+	m.Parameters = kept
+	for module, rev := range layers {
+		if m.Layers == nil {
+			m.Layers = map[string]templateRevision{}
+		}
+		m.Layers[module] = rev
+	}
+}
+
+// setParameters records params, replacing earlier values of the same keys.
+func (m *appMetadata) setParameters(params []appParameter) {
+	for _, param := range params {
+		m.Parameters = setAppParameter(m.Parameters, param)
+	}
+}
+
+// addDatabases records CouchDB objects created for the app.
+func (m *appMetadata) addDatabases(paths []string) {
+	for _, path := range paths {
+		if !containsModule(m.Databases, path) {
+			m.Databases = append(m.Databases, path)
+		}
+	}
+}
+
+func setAppParameter(params []appParameter, param appParameter) []appParameter {
+	if param.Secret {
+		param.Value = ""
+	}
+	for i := range params {
+		if params[i].Module == param.Module && params[i].Key == param.Key {
+			params[i] = param
+			return params
+		}
+	}
+	return append(params, param)
+}
+
+// layerRevisions returns the lock revision of the layer of each module: its
+// own entry when it was created with create_layer, the base layers otherwise.
+func layerRevisions(root string, modules []string) (map[string]templateRevision, error) {
+	lock, err := loadLock(root)
+	if err != nil {
+		return nil, err
+	}
+	revisions := map[string]templateRevision{}
+	for _, module := range modules {
+		if rev, ok := lock.Entries["layers/"+module]; ok {
+			revisions[module] = rev
+		} else if rev, ok := lock.Entries["layers"]; ok {
+			revisions[module] = rev
+		}
+	}
+	return revisions, nil
+}
@@ -37,10 +37,11 @@ type newAppResultMsg struct {
 }
 
 type newAppModel struct {
-	ctx    context.Context
-	cfg    *config.Config
-	branch string
-	force  bool
+	ctx       context.Context
+	cfg       *config.Config
+	branch    string
+	force     bool
+	cloneOpts []gitutil.CloneOption
 
 	logs *ui.LogBuffer
 
@@ -59,15 +60,17 @@ type newAppModel struct {
 	authUsername  string
 	authPassword  string
 
-	spinner spinner.Model
-	status  string
+	spinner  spinner.Model
+	progress *cloneProgress
+	steps    *stepList
+	status   string
 
 	err     error
 	aborted bool
 	done    bool
 }
 
-func newAppModelWithDefaults(ctx context.Context, cfg *config.Config, nameHint string, moduleHints []string, branch string, force bool, logs *ui.LogBuffer) *newAppModel {
+func newAppModelWithDefaults(ctx context.Context, cfg *config.Config, nameHint string, moduleHints []string, branch string, force bool, logs *ui.LogBuffer, cloneOpts []gitutil.CloneOption) *newAppModel {
 	defaults := cfg.DefaultModuleSelection()
 	modulesList := availableModules(cfg)
 
@@ -109,13 +112,16 @@ func newAppModelWithDefaults(ctx context.Context, cfg *config.Config, nameHint s
 		cfg:           cfg,
 		branch:        branch,
 		force:         force,
+		cloneOpts:     cloneOpts,
 		logs:          logs,
 		nameInput:     nameInput,
 		moduleView:    newModuleSelectModel(modulesList, initialModules),
 		defaults:      defaults,
 		authUserInput: authUser,
 		authPassInput: authPass,
+		steps:         newStepList(newAppSteps),
 		spinner:       spin,
+		progress:      newCloneProgress(),
 	}
 
 	if sanitizedName != "" {
@@ -157,6 +163,8 @@ func (m *newAppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, tea.Quit
 			}
 		}
+	case cloneProgressMsg:
+		return m, m.progress.Update(msg)
 	case spinner.TickMsg:
 		if m.step == stepRunning {
 			var cmd tea.Cmd
@@ -304,15 +312,18 @@ func (m *newAppModel) runCreateCmd() tea.Cmd {
 	cfg := m.cfg
 	ctx := m.ctx
 	logs := m.logs
+	progressOpt, progressDone, waitProgress := m.progress.Start()
+	cloneOpts := append([]gitutil.CloneOption{progressOpt}, m.cloneOpts...)
 
 	root, _ := os.Getwd()
 	targetDir := filepath.Join(root, "apps", name)
 
-	return func() tea.Msg {
+	run := func() tea.Msg {
+		defer progressDone()
 		logs.Infof("Target directory: %s", targetDir)
 		logs.Infof("Selected modules: %s", strings.Join(modules, ", "))
 
-		cmdCtx := ctx
+		cmdCtx := WithStepObserver(ctx, m.steps.Observe)
 		if containsModule(modules, "auth") {
 			if m.authUsername != "" && m.authPassword != "" {
 				logs.Infof("Using provided CouchDB admin user '%s'", m.authUsername)
@@ -324,14 +335,16 @@ func (m *newAppModel) runCreateCmd() tea.Cmd {
 
 		logWriter := logs.Writer(ui.Info)
 		logs.Infof("Cloning starter repository...")
-		err := RunNew(cmdCtx, cfg, name, modules, branch, force, gitutil.WithOutput(logWriter), gitutil.WithLogger(func(format string, args ...any) {
+		cloneOpts = append(cloneOpts, gitutil.WithOutput(logWriter), gitutil.WithLogger(func(format string, args ...any) {
 			logs.Infof(format, args...)
 		}))
+		err := RunNew(cmdCtx, cfg, name, modules, branch, force, cloneOpts...)
 		if err != nil {
 			return newAppResultMsg{err: err}
 		}
 		return newAppResultMsg{err: nil}
 	}
+	return tea.Batch(run, waitProgress)
 }
 
 func (m *newAppModel) enterAuthStep() {
@@ -452,6 +465,9 @@ func (m *newAppModel) viewSummaryStep() string {
 		ui.Subtitle.Render("Press Enter to scaffold the app, or navigate back to adjust details."),
 		"",
 		ui.Content.Render(strings.Join(lines, "\n")),
+		"",
+		ui.Content.Render("Steps:"),
+		ui.Content.Render(m.steps.View("")),
 	)
 	return content
 }
@@ -462,7 +478,9 @@ func (m *newAppModel) viewRunningStep() string {
 		ui.Title.Render("Scaffolding app"),
 		ui.Subtitle.Render("Hang tight while we clone the template and write configuration files."),
 		"",
-		ui.Content.Render(fmt.Sprintf("%s  %s", m.spinner.View(), "Working...")),
+		ui.Content.Render(m.steps.View(m.spinner.View())),
+		"",
+		ui.Content.Render(m.progress.View()),
 	)
 	return content
 }
@@ -479,6 +497,8 @@ func (m *newAppModel) viewDoneStep() string {
 		"",
 		ui.Content.Render(strings.Join(modList, ", ")),
 		"",
+		ui.Content.Render(m.steps.View("")),
+		"",
 		ui.LogSuccess.Render("Press Enter to exit."),
 	)
 	return content
@@ -540,11 +560,11 @@ func (m *newAppModel) Result() (string, []string, error) {
 }
 
 // RunNewTUI runs the interactive Bubble Tea experience for scaffolding a new app.
-func RunNewTUI(ctx context.Context, cfg *config.Config, nameHint string, modulesHint string, branch string, force bool) (string, []string, error) {
+func RunNewTUI(ctx context.Context, cfg *config.Config, nameHint string, modulesHint string, branch string, force bool, cloneOpts ...gitutil.CloneOption) (string, []string, error) {
 	logBuffer := ui.NewLogBuffer(128)
 
 	initialModules := parseModules(modulesHint)
-	model := newAppModelWithDefaults(ctx, cfg, nameHint, initialModules, branch, force, logBuffer)
+	model := newAppModelWithDefaults(ctx, cfg, nameHint, initialModules, branch, force, logBuffer, cloneOpts)
 
 	root := ui.NewRootModel("Create Nuxt App", "Scaffold a new Nuxt application with CouchFusion layers.", model, logBuffer, nil)
 	finalModel, err := ui.Run(root, tea.WithAltScreen())
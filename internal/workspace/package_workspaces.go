@@ -0,0 +1,233 @@
+package workspace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/nuxt-apps/couchfusion/internal/logging"
+)
+
+const (
+	rootPackageFileName   = "package.json"
+	pnpmWorkspaceFileName = "pnpm-workspace.yaml"
+)
+
+// workspacePackages are the globs every package workspace covers.
+var workspacePackages = []string{"apps/*", "layers/*"}
+
+// layerPackageName is the package name apps depend on for a layer.
+func layerPackageName(layer string) string {
+	return "@my/" + layer
+}
+
+// layerDependencySpec is the version apps use for a layer dependency. Without a
+// package workspace apps link layers by path; npm resolves workspace packages by
+// name from a plain "*" because it has no workspace: protocol.
+func layerDependencySpec(manager, layer string) string {
+	switch manager {
+	case "":
+		return "link:../../layers/" + layer
+	case "npm":
+		return "*"
+	default:
+		return "workspace:*"
+	}
+}
+
+// syncPackageWorkspaces creates or updates the root package.json (and, for
+// pnpm, pnpm-workspace.yaml) so apps/* and layers/* are workspace packages.
+// Existing content is kept; nothing happens when manager is empty.
+func syncPackageWorkspaces(root, manager string) error {
+	if manager == "" {
+		return nil
+	}
+	if err := syncRootPackage(root, manager); err != nil {
+		return err
+	}
+	if manager == "pnpm" {
+		return syncPnpmWorkspace(root)
+	}
+	return nil
+}
+
+func syncRootPackage(root, manager string) error {
+	path := filepath.Join(root, rootPackageFileName)
+	pkg := map[string]any{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &pkg); err != nil {
+			return fmt.Errorf("failed to parse root %s: %w", rootPackageFileName, err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		pkg["name"] = sanitizeName(filepath.Base(root))
+	default:
+		return fmt.Errorf("failed to read root %s: %w", rootPackageFileName, err)
+	}
+
+	pkg["private"] = true
+	// pnpm reads its globs from pnpm-workspace.yaml instead.
+	if manager != "pnpm" {
+		var globs []any
+		switch existing := pkg["workspaces"].(type) {
+		case nil:
+		case []any:
+			globs = existing
+		default:
+			return fmt.Errorf("root %s workspaces must be an array", rootPackageFileName)
+		}
+		pkg["workspaces"] = appendMissing(globs, workspacePackages)
+	}
+
+	updated, err := json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal root %s: %w", rootPackageFileName, err)
+	}
+	updated = append(updated, '\n')
+	if bytes.Equal(updated, data) {
+		return nil
+	}
+	if err := os.WriteFile(path, updated, 0o644); err != nil {
+		return fmt.Errorf("failed to write root %s: %w", rootPackageFileName, err)
+	}
+	return nil
+}
+
+func appendMissing(values []any, wanted []string) []any {
+	for _, want := range wanted {
+		found := false
+		for _, value := range values {
+			if value == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, want)
+		}
+	}
+	return values
+}
+
+// syncPnpmWorkspace adds the workspace globs to pnpm-workspace.yaml, editing
+// the YAML nodes so comments and other settings survive.
+func syncPnpmWorkspace(root string) error {
+	path := filepath.Join(root, pnpmWorkspaceFileName)
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", pnpmWorkspaceFileName, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("failed to read %s: %w", pnpmWorkspaceFileName, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s must contain a mapping", pnpmWorkspaceFileName)
+	}
+
+	var packages *yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "packages" {
+			packages = mapping.Content[i+1]
+			break
+		}
+	}
+	if packages == nil {
+		packages = &yaml.Node{Kind: yaml.SequenceNode}
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "packages"}, packages)
+	}
+	if packages.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%s packages must be a list", pnpmWorkspaceFileName)
+	}
+
+	changed := false
+	for _, want := range workspacePackages {
+		found := false
+		for _, item := range packages.Content {
+			if item.Value == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			packages.Content = append(packages.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: want, Style: yaml.DoubleQuotedStyle})
+			changed = true
+		}
+	}
+	if !changed && data != nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", pnpmWorkspaceFileName, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", pnpmWorkspaceFileName, err)
+	}
+	return nil
+}
+
+// setLayerPackageName names a layer's package after the dependency apps declare
+// for it, so workspace resolution finds it.
+func setLayerPackageName(layerDir, layer string) error {
+	path := filepath.Join(layerDir, "package.json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	pkg := map[string]any{}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if pkg["name"] == layerPackageName(layer) {
+		return nil
+	}
+	pkg["name"] = layerPackageName(layer)
+	updated, err := json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(updated, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// warnLayerPackageNames reports selected layers whose package name does not
+// match the workspace dependency apps declare for them.
+func warnLayerPackageNames(root string, modules []string) {
+	for _, module := range modules {
+		data, err := os.ReadFile(filepath.Join(root, "layers", module, "package.json"))
+		if err != nil {
+			continue
+		}
+		var pkg struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(data, &pkg) != nil || pkg.Name == layerPackageName(module) {
+			continue
+		}
+		logging.Warnf("layers/%s/package.json is named '%s'; rename it to '%s' so the workspace resolves the dependency.", module, pkg.Name, layerPackageName(module))
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -18,8 +19,13 @@ import (
 	"golang.org/x/term"
 )
 
-// applyLayerParameters executes post-clone configuration for selected modules.
-func applyLayerParameters(ctx context.Context, targetDir string, modules []string) error {
+// couchDBURL is the CouchDB instance layer parameters are configured against.
+const couchDBURL = "http://localhost:5984"
+
+// applyLayerParameters executes post-clone configuration for selected modules in
+// the staging directory of tx, registering undo steps for changes made outside
+// of it.
+func applyLayerParameters(ctx context.Context, tx *scaffoldTx, modules []string) error {
 	seen := map[string]struct{}{}
 	for _, module := range modules {
 		if _, handled := seen[module]; handled {
@@ -29,7 +35,7 @@ func applyLayerParameters(ctx context.Context, targetDir string, modules []strin
 
 		switch module {
 		case "auth":
-			if err := configureAuthLayer(ctx, targetDir); err != nil {
+			if err := configureAuthLayer(ctx, tx); err != nil {
 				return fmt.Errorf("auth layer configuration failed: %w", err)
 			}
 		}
@@ -37,13 +43,21 @@ func applyLayerParameters(ctx context.Context, targetDir string, modules []strin
 	return nil
 }
 
-func configureAuthLayer(ctx context.Context, targetDir string) error {
+func configureAuthLayer(ctx context.Context, tx *scaffoldTx) error {
 	username := ""
 	password := ""
 	if creds, ok := credentialsFromContext(ctx); ok {
 		username = strings.TrimSpace(creds.Username)
 		password = strings.TrimSpace(creds.Password)
 	}
+	if username == "" {
+		// Reproduced apps reuse the username of their source.
+		username = tx.state.parameter("auth", "username")
+	}
+
+	if tx.plan != nil {
+		return planAuthLayer(tx, username, password)
+	}
 
 	var err error
 	if username == "" {
@@ -75,7 +89,7 @@ func configureAuthLayer(ctx context.Context, targetDir string) error {
 		return err
 	}
 
-	envPath := filepath.Join(targetDir, ".env")
+	envPath := filepath.Join(tx.Dir(), ".env")
 	values := map[string]string{
 		"COUCHDB_ADMIN_AUTH":    authHeader,
 		"COUCHDB_COOKIE_SECRET": secret,
@@ -85,17 +99,51 @@ func configureAuthLayer(ctx context.Context, targetDir string) error {
 		return err
 	}
 
-	if err := ensureCouchDBAdminUser(ctx, username, password); err != nil {
+	rev, err := ensureCouchDBAdminUser(ctx, username, password)
+	if err != nil {
 		return err
 	}
+	if rev != "" {
+		tx.onRollback(fmt.Sprintf("delete CouchDB user '%s'", username), func(ctx context.Context) error {
+			return deleteCouchDBUser(ctx, username, password, rev)
+		})
+		tx.state.addDatabase("_users/org.couchdb.user:" + username)
+	}
 
-	logging.Infof("Updated %s with COUCHDB_ADMIN_AUTH and COUCHDB_COOKIE_SECRET.", envPath)
+	tx.state.setParameter("auth", "username", username, false)
+	tx.state.setParameter("auth", "password", "", true)
+	logging.Infof("Updated .env with COUCHDB_ADMIN_AUTH and COUCHDB_COOKIE_SECRET.")
 	return nil
 }
 
+// planAuthLayer records the CouchDB requests configureAuthLayer would send and
+// writes .env with the values it can know without them; it neither prompts nor
+// contacts CouchDB.
+func planAuthLayer(tx *scaffoldTx, username, password string) error {
+	auth := "<base64 of the CouchDB admin credentials>"
+	if username != "" && password != "" {
+		auth = base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	}
+	if username == "" {
+		username = "<admin>"
+	}
+
+	tx.state.setParameter("auth", "username", username, false)
+	tx.state.setParameter("auth", "password", "", true)
+	userURL := fmt.Sprintf("%s/_users/org.couchdb.user:%s", couchDBURL, username)
+	tx.plan.request(http.MethodGet, couchDBURL+"/_node/_local/_config/chttpd_auth/secret", "read COUCHDB_COOKIE_SECRET")
+	tx.plan.request(http.MethodGet, userURL, "check whether the admin user exists")
+	tx.plan.request(http.MethodPut, userURL, "create the admin user unless it exists; deleted again on rollback")
+
+	return ensureEnvEntries(filepath.Join(tx.Dir(), ".env"), map[string]string{
+		"COUCHDB_ADMIN_AUTH":    auth,
+		"COUCHDB_COOKIE_SECRET": "<cookie secret from CouchDB>",
+	})
+}
+
 func fetchCouchDBCookieSecret(ctx context.Context, username, password string) (string, error) {
 	client := &http.Client{Timeout: 5 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:5984/_node/_local/_config/chttpd_auth/secret", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, couchDBURL+"/_node/_local/_config/chttpd_auth/secret", nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to build couchdb config request: %w", err)
 	}
@@ -185,33 +233,35 @@ func promptSecret(message string) (string, error) {
 	return strings.TrimSpace(string(bytes)), nil
 }
 
-func ensureCouchDBAdminUser(ctx context.Context, username, password string) error {
+// ensureCouchDBAdminUser creates the admin user document unless it exists and
+// returns the revision of a newly created document, or "" when none was created.
+func ensureCouchDBAdminUser(ctx context.Context, username, password string) (string, error) {
 	userID := fmt.Sprintf("org.couchdb.user:%s", username)
-	url := fmt.Sprintf("http://localhost:5984/_users/%s", userID)
+	url := fmt.Sprintf("%s/_users/%s", couchDBURL, userID)
 
 	client := &http.Client{Timeout: 5 * time.Second}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to build user lookup request: %w", err)
+		return "", fmt.Errorf("failed to build user lookup request: %w", err)
 	}
 	req.SetBasicAuth(username, password)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to query couchdb user document: %w", err)
+		return "", fmt.Errorf("failed to query couchdb user document: %w", err)
 	}
 	defer resp.Body.Close()
 
 	switch resp.StatusCode {
 	case http.StatusOK:
 		logging.Infof("CouchDB admin user '%s' already exists.", username)
-		return nil
+		return "", nil
 	case http.StatusNotFound:
 		// proceed to creation
 	default:
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected response checking user '%s': %s %s", username, resp.Status, strings.TrimSpace(string(body)))
+		return "", fmt.Errorf("unexpected response checking user '%s': %s %s", username, resp.Status, strings.TrimSpace(string(body)))
 	}
 
 	payload := map[string]any{
@@ -224,31 +274,63 @@ func ensureCouchDBAdminUser(ctx context.Context, username, password string) erro
 
 	body, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal couchdb user payload: %w", err)
+		return "", fmt.Errorf("failed to marshal couchdb user payload: %w", err)
 	}
 
 	putReq, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("failed to build user creation request: %w", err)
+		return "", fmt.Errorf("failed to build user creation request: %w", err)
 	}
 	putReq.Header.Set("Content-Type", "application/json")
 	putReq.SetBasicAuth(username, password)
 
 	putResp, err := client.Do(putReq)
 	if err != nil {
-		return fmt.Errorf("failed to create couchdb user: %w", err)
+		return "", fmt.Errorf("failed to create couchdb user: %w", err)
 	}
 	defer putResp.Body.Close()
 
 	respBody, err := io.ReadAll(putResp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read couchdb user creation response: %w", err)
+		return "", fmt.Errorf("failed to read couchdb user creation response: %w", err)
 	}
 
 	if putResp.StatusCode < 200 || putResp.StatusCode >= 300 {
-		return fmt.Errorf("couchdb user creation failed (%s): %s", putResp.Status, strings.TrimSpace(string(respBody)))
+		return "", fmt.Errorf("couchdb user creation failed (%s): %s", putResp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	var created struct {
+		Rev string `json:"rev"`
+	}
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return "", fmt.Errorf("failed to parse couchdb user creation response: %w", err)
 	}
 
 	logging.Infof("Created CouchDB admin user '%s'.", username)
+	return created.Rev, nil
+}
+
+// deleteCouchDBUser removes the user document created by ensureCouchDBAdminUser.
+func deleteCouchDBUser(ctx context.Context, username, password, rev string) error {
+	userURL := fmt.Sprintf("%s/_users/org.couchdb.user:%s?rev=%s", couchDBURL, username, url.QueryEscape(rev))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, userURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build user deletion request: %w", err)
+	}
+	req.SetBasicAuth(username, password)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete couchdb user: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("couchdb user deletion failed (%s): %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	logging.Infof("Deleted CouchDB admin user '%s'.", username)
 	return nil
 }
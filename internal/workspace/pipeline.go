@@ -0,0 +1,359 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	stateDirName  = ".couchfusion"
+	stateFileName = "state.json"
+)
+
+// Step statuses recorded in state.json and reported through StepEvent.
+const (
+	StepPending = "pending"
+	StepRunning = "running"
+	StepDone    = "done"
+	StepFailed  = "failed"
+	// StepSkipped is reported for steps a resumed run already completed.
+	StepSkipped = "skipped"
+)
+
+// stepDef names one step of a scaffolding workflow. Name is stable and stored
+// in state.json; Title is shown to users.
+type stepDef struct {
+	Name  string
+	Title string
+}
+
+var newAppSteps = []stepDef{
+	{Name: "clone", Title: "Clone starter template"},
+	{Name: "git", Title: "Prepare git repository"},
+	{Name: "dependencies", Title: "Add layer dependencies"},
+	{Name: "parameters", Title: "Configure layer parameters"},
+	{Name: "extends", Title: "Update nuxt.config extends"},
+	{Name: "metadata", Title: "Write couchfusion.json"},
+	{Name: "module-setup", Title: "Write docs/module_setup.json"},
+	{Name: "commit", Title: "Create initial commit"},
+	{Name: "workspace", Title: "Update couchfusion.lock and package workspaces"},
+}
+
+var createLayerSteps = []stepDef{
+	{Name: "clone", Title: "Clone layer template"},
+	{Name: "git", Title: "Prepare git repository"},
+	{Name: "package-name", Title: "Name the layer package"},
+	{Name: "commit", Title: "Create initial commit"},
+	{Name: "workspace", Title: "Update couchfusion.lock and package workspaces"},
+}
+
+// StepEvent reports a step transition to the observer installed with
+// WithStepObserver.
+type StepEvent struct {
+	Index    int
+	Total    int
+	Name     string
+	Title    string
+	Status   string
+	Duration time.Duration
+	Err      error
+}
+
+type stepObserverKey struct{}
+
+// WithStepObserver returns a context whose scaffolding runs report every step
+// transition to fn. fn is called from the goroutine running the workflow.
+func WithStepObserver(ctx context.Context, fn func(StepEvent)) context.Context {
+	return context.WithValue(ctx, stepObserverKey{}, fn)
+}
+
+func stepObserverFromContext(ctx context.Context) func(StepEvent) {
+	if fn, ok := ctx.Value(stepObserverKey{}).(func(StepEvent)); ok && fn != nil {
+		return fn
+	}
+	return func(StepEvent) {}
+}
+
+// runState is persisted as .couchfusion/state.json in the directory a scaffold
+// is built in, so a failed run can continue with --resume.
+type runState struct {
+	StateVersion int      `json:"stateVersion"`
+	Command      string   `json:"command"`
+	Name         string   `json:"name"`
+	Modules      []string `json:"modules,omitempty"`
+	// Repo replaces the configured template repository and Commit pins the
+	// clone to a commit of Ref; both are set when reproducing an app.
+	Repo     string            `json:"repo,omitempty"`
+	Ref      string            `json:"ref,omitempty"`
+	Commit   string            `json:"commit,omitempty"`
+	Revision *templateRevision `json:"revision,omitempty"`
+	// Source is the couchfusion.json an app is reproduced from.
+	Source string `json:"source,omitempty"`
+	// Parameters holds the layer parameters set so far; secret values are
+	// not kept.
+	Parameters []appParameter `json:"parameters,omitempty"`
+	// Databases holds the CouchDB objects created so far; see
+	// appMetadata.Databases.
+	Databases []string    `json:"databases,omitempty"`
+	Steps     []stepState `json:"steps"`
+}
+
+type stepState struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"durationMs,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func newRunState(command, name string, defs []stepDef) *runState {
+	state := &runState{StateVersion: 1, Command: command, Name: name}
+	for _, def := range defs {
+		state.Steps = append(state.Steps, stepState{Name: def.Name, Status: StepPending})
+	}
+	return state
+}
+
+func loadRunState(dir string) (*runState, error) {
+	path := filepath.Join(dir, stateDirName, stateFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &runState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return state, nil
+}
+
+func (s *runState) save(dir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	stateDir := filepath.Join(dir, stateDirName)
+	if err := os.MkdirAll(stateDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", stateDir, err)
+	}
+	if err := os.WriteFile(filepath.Join(stateDir, stateFileName), append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write run state: %w", err)
+	}
+	return nil
+}
+
+// remove deletes the state file, and its directory when nothing else is in it,
+// before the project is moved into place.
+func (s *runState) remove(dir string) error {
+	stateDir := filepath.Join(dir, stateDirName)
+	if err := os.Remove(filepath.Join(stateDir, stateFileName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove run state: %w", err)
+	}
+	_ = os.Remove(stateDir)
+	return nil
+}
+
+// cloneRef is the ref the template is cloned at.
+func (s *runState) cloneRef() string {
+	if s.Commit != "" {
+		return s.Commit
+	}
+	return s.Ref
+}
+
+// parameter returns the value of a recorded non-secret layer parameter; s may
+// be nil.
+func (s *runState) parameter(module, key string) string {
+	if s == nil {
+		return ""
+	}
+	for _, param := range s.Parameters {
+		if param.Module == module && param.Key == key {
+			return param.Value
+		}
+	}
+	return ""
+}
+
+// setParameter records that a layer parameter was set, dropping the value of
+// secret ones; s may be nil.
+func (s *runState) setParameter(module, key, value string, secret bool) {
+	if s == nil {
+		return
+	}
+	s.Parameters = setAppParameter(s.Parameters, appParameter{Module: module, Key: key, Value: value, Secret: secret})
+}
+
+// addDatabase records that the CouchDB object at path was created; s may be
+// nil.
+func (s *runState) addDatabase(path string) {
+	if s == nil || containsModule(s.Databases, path) {
+		return
+	}
+	s.Databases = append(s.Databases, path)
+}
+
+// step returns the recorded state of name, adding it when a resumed state file
+// predates the step.
+func (s *runState) step(name string) *stepState {
+	for i := range s.Steps {
+		if s.Steps[i].Name == name {
+			return &s.Steps[i]
+		}
+	}
+	s.Steps = append(s.Steps, stepState{Name: name, Status: StepPending})
+	return &s.Steps[len(s.Steps)-1]
+}
+
+// resumable reports whether a completed step is worth keeping for --resume.
+func (s *runState) resumable() bool {
+	for _, step := range s.Steps {
+		if step.Status == StepDone {
+			return true
+		}
+	}
+	return false
+}
+
+// failedStep returns the name of the step that failed, if any.
+func (s *runState) failedStep() string {
+	for _, step := range s.Steps {
+		if step.Status == StepFailed {
+			return step.Name
+		}
+	}
+	return ""
+}
+
+// reset marks steps whose side effects were rolled back as pending again.
+func (s *runState) reset(names map[string]bool) {
+	for i := range s.Steps {
+		if names[s.Steps[i].Name] {
+			s.Steps[i].Status = StepPending
+			s.Steps[i].DurationMs = 0
+		}
+	}
+}
+
+type pipelineStep struct {
+	stepDef
+	run func(context.Context) error
+}
+
+// bindSteps pairs every step definition with its implementation.
+func bindSteps(defs []stepDef, impls map[string]func(context.Context) error) []pipelineStep {
+	steps := make([]pipelineStep, 0, len(defs))
+	for _, def := range defs {
+		run, ok := impls[def.Name]
+		if !ok {
+			panic("workspace: no implementation for step " + def.Name)
+		}
+		steps = append(steps, pipelineStep{stepDef: def, run: run})
+	}
+	return steps
+}
+
+// runPipeline runs steps in order, skipping those the state of tx records as
+// done, and saves the state in the staging directory after each step. Undo
+// steps registered while a step runs belong to that step, so a rollback makes
+// it pending again.
+func runPipeline(ctx context.Context, tx *scaffoldTx, steps []pipelineStep) error {
+	notify := stepObserverFromContext(ctx)
+	state := tx.state
+	for i, step := range steps {
+		recorded := state.step(step.Name)
+		event := StepEvent{Index: i, Total: len(steps), Name: step.Name, Title: step.Title}
+		if recorded.Status == StepDone {
+			event.Status = StepSkipped
+			notify(event)
+			continue
+		}
+
+		event.Status = StepRunning
+		notify(event)
+		tx.current = step.Name
+		started := time.Now()
+		err := step.run(ctx)
+		event.Duration = time.Since(started)
+		recorded.DurationMs = event.Duration.Milliseconds()
+		if err != nil {
+			recorded.Status, recorded.Error = StepFailed, err.Error()
+			event.Status, event.Err = StepFailed, err
+			notify(event)
+			// rollback saves the state once side effects are undone.
+			return err
+		}
+		recorded.Status, recorded.Error = StepDone, ""
+		event.Status = StepDone
+		notify(event)
+		if err := state.save(tx.Dir()); err != nil {
+			return err
+		}
+	}
+	tx.current = ""
+	return nil
+}
+
+// resumeHint points at --resume when a failed run kept its completed steps.
+func resumeHint(err error, state *runState, command string) error {
+	if !state.resumable() {
+		return err
+	}
+	return fmt.Errorf("%w\nrun 'couchfusion %s --resume %s' to continue from step '%s'", err, command, state.Name, state.failedStep())
+}
+
+// StepTimer collects the durations reported through WithStepObserver for a
+// timing report.
+type StepTimer struct {
+	mu    sync.Mutex
+	steps []StepEvent
+}
+
+// Observe records finished, failed and skipped steps; pass it to
+// WithStepObserver.
+func (t *StepTimer) Observe(event StepEvent) {
+	if event.Status == StepRunning {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps = append(t.steps, event)
+}
+
+// Report renders one line per step plus the total.
+func (t *StepTimer) Report() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	width := len("total")
+	for _, step := range t.steps {
+		if len(step.Name) > width {
+			width = len(step.Name)
+		}
+	}
+	var total time.Duration
+	lines := make([]string, 0, len(t.steps)+1)
+	for _, step := range t.steps {
+		value := formatStepDuration(step.Duration)
+		switch step.Status {
+		case StepSkipped:
+			value = "skipped (resumed)"
+		case StepFailed:
+			value += " (failed)"
+		}
+		total += step.Duration
+		lines = append(lines, fmt.Sprintf("%-*s  %s", width, step.Name, value))
+	}
+	lines = append(lines, fmt.Sprintf("%-*s  %s", width, "total", formatStepDuration(total)))
+	return lines
+}
+
+func formatStepDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return d.Round(10 * time.Millisecond).String()
+}
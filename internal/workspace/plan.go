@@ -0,0 +1,506 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nuxt-apps/couchfusion/internal/config"
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+	"github.com/nuxt-apps/couchfusion/internal/source"
+)
+
+// Plan describes what a command run with --dry-run would do. Commands resolve
+// their inputs as usual and simulate file changes in a temporary directory;
+// nothing in the workspace or on CouchDB is touched.
+type Plan struct {
+	Command  string
+	Root     string
+	Settings []PlanSetting
+	Dirs     []PlanDir
+	Actions  []string
+	Files    []PlanFile
+	Requests []PlanRequest
+}
+
+// PlanSetting is a resolved input such as the target path or template ref.
+type PlanSetting struct {
+	Name  string
+	Value string
+}
+
+// PlanDir is a directory the command would create or delete.
+type PlanDir struct {
+	Path   string
+	Delete bool
+	Detail string
+}
+
+// PlanFile is a file the command would create or modify, with a unified diff.
+type PlanFile struct {
+	Path   string
+	Create bool
+	Diff   string
+}
+
+// PlanRequest is an HTTP request the command would send to CouchDB.
+type PlanRequest struct {
+	Method  string
+	URL     string
+	Purpose string
+}
+
+// plannedProjectFiles are diffed between the cloned template and the scaffolded
+// project.
+var plannedProjectFiles = []string{"package.json", "nuxt.config.ts", ".env", "couchfusion.json", "docs/module_setup.json"}
+
+func newPlan(command, root string) *Plan {
+	return &Plan{Command: command, Root: root}
+}
+
+func (p *Plan) set(name, value string) {
+	p.Settings = append(p.Settings, PlanSetting{Name: name, Value: value})
+}
+
+func (p *Plan) action(format string, args ...any) {
+	p.Actions = append(p.Actions, fmt.Sprintf(format, args...))
+}
+
+func (p *Plan) request(method, url, purpose string) {
+	p.Requests = append(p.Requests, PlanRequest{Method: method, URL: url, Purpose: purpose})
+}
+
+// createDir records path for creation unless it exists.
+func (p *Plan) createDir(path string) {
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	p.Dirs = append(p.Dirs, PlanDir{Path: p.rel(path)})
+}
+
+// deleteDir records the removal of path with the number of files it holds.
+func (p *Plan) deleteDir(path, reason string) {
+	count := 0
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	p.Dirs = append(p.Dirs, PlanDir{Path: p.rel(path), Delete: true, Detail: fmt.Sprintf("%s; %d files", reason, count)})
+}
+
+// file records the change of path from before to after; nil means missing.
+// Values in .env files are masked.
+func (p *Plan) file(ctx context.Context, path string, before, after []byte) error {
+	if after == nil {
+		return nil
+	}
+	if filepath.Base(path) == ".env" {
+		before, after = maskEnv(before), maskEnv(after)
+	}
+	rel := p.rel(path)
+	diff, err := gitutil.UnifiedDiff(ctx, rel, before, after)
+	if err != nil || diff == "" {
+		return err
+	}
+	p.Files = append(p.Files, PlanFile{Path: rel, Create: before == nil, Diff: diff})
+	return nil
+}
+
+func (p *Plan) rel(path string) string {
+	if rel, err := filepath.Rel(p.Root, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// maskEnv hides every value of a dotenv file except couchfusion's own
+// <placeholders>.
+func maskEnv(content []byte) []byte {
+	if content == nil {
+		return nil
+	}
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || trimmed == "" || strings.HasPrefix(trimmed, "#") || value == "" {
+			continue
+		}
+		if strings.HasPrefix(value, "<") && strings.HasSuffix(value, ">") {
+			continue
+		}
+		lines[i] = key + "=********"
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// readOptional returns the content of path, or nil when it does not exist.
+func readOptional(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// planRootFiles runs update against copies of the named workspace root files
+// and records the resulting changes.
+func planRootFiles(ctx context.Context, plan *Plan, root string, update func(shadow string) error, names ...string) error {
+	tmp, err := os.MkdirTemp("", "couchfusion-plan-root-")
+	if err != nil {
+		return fmt.Errorf("failed to create plan directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Keep the base name: a new root package.json is named after it.
+	shadow := filepath.Join(tmp, filepath.Base(root))
+	if err := os.MkdirAll(shadow, 0o755); err != nil {
+		return err
+	}
+	originals := map[string][]byte{}
+	for _, name := range names {
+		data, err := readOptional(filepath.Join(root, name))
+		if err != nil {
+			return err
+		}
+		originals[name] = data
+		if data != nil {
+			if err := os.WriteFile(filepath.Join(shadow, name), data, 0o644); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := update(shadow); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		after, err := readOptional(filepath.Join(shadow, name))
+		if err != nil {
+			return err
+		}
+		if err := plan.file(ctx, filepath.Join(root, name), originals[name], after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write prints the plan.
+func (p *Plan) Write(w io.Writer) {
+	fmt.Fprintf(w, "Plan for couchfusion %s (dry run, nothing was changed)\n", p.Command)
+
+	if len(p.Settings) > 0 {
+		fmt.Fprintln(w, "\nResolved settings:")
+		width := 0
+		for _, s := range p.Settings {
+			if len(s.Name) > width {
+				width = len(s.Name)
+			}
+		}
+		for _, s := range p.Settings {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, s.Name, s.Value)
+		}
+	}
+
+	if len(p.Dirs) > 0 {
+		fmt.Fprintln(w, "\nDirectories:")
+		for _, d := range p.Dirs {
+			switch {
+			case d.Delete:
+				fmt.Fprintf(w, "  - %s (%s)\n", d.Path, d.Detail)
+			case d.Detail != "":
+				fmt.Fprintf(w, "  + %s (%s)\n", d.Path, d.Detail)
+			default:
+				fmt.Fprintf(w, "  + %s\n", d.Path)
+			}
+		}
+	}
+
+	if len(p.Actions) > 0 {
+		fmt.Fprintln(w, "\nSteps:")
+		for _, a := range p.Actions {
+			fmt.Fprintf(w, "  • %s\n", a)
+		}
+	}
+
+	if len(p.Files) > 0 {
+		fmt.Fprintln(w, "\nFiles:")
+		for _, f := range p.Files {
+			verb := "modify"
+			if f.Create {
+				verb = "create"
+			}
+			fmt.Fprintf(w, "  %s %s\n", verb, f.Path)
+			for _, line := range strings.Split(strings.TrimRight(f.Diff, "\n"), "\n") {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+	}
+
+	if len(p.Requests) > 0 {
+		fmt.Fprintln(w, "\nCouchDB requests:")
+		for _, r := range p.Requests {
+			fmt.Fprintf(w, "  %-6s %s  (%s)\n", r.Method, r.URL, r.Purpose)
+		}
+	}
+}
+
+// PlanInit resolves an init run like RunInit and describes it. The layers are
+// cloned into a temporary directory to validate the selection and resolve the
+// commit recorded in couchfusion.lock.
+func PlanInit(ctx context.Context, cfg *config.Config, targetPath, overrideLayerBranch, layersMode, gitMode, packageWorkspaces string, layers []string, force bool, cloneOpts ...gitutil.CloneOption) (*Plan, error) {
+	root, err := resolvePath(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := cfg.ResolveLayersMode(layersMode)
+	if err != nil {
+		return nil, err
+	}
+	repoMode, err := cfg.ResolveGitMode(gitMode)
+	if err != nil {
+		return nil, err
+	}
+	if repoMode == gitModeMonorepo && mode == layersModeRemote {
+		return nil, fmt.Errorf("layers mode remote keeps /layers as its own repository; use snapshot or subtree with git mode monorepo")
+	}
+	packageManager, err := cfg.ResolvePackageWorkspaces(packageWorkspaces)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := cfg.Repos["init"]
+	ref := repo.ResolveRef(overrideLayerBranch)
+	cloneOpts = repoCloneOptions(repo, cloneOpts)
+	if mode != layersModeSnapshot && source.IsLocal(repo.URL) {
+		return nil, fmt.Errorf("layers mode %s needs a git repository URL; %s can only be copied (use --layers-mode snapshot)", mode, repo.URL)
+	}
+	if err := gitutil.CheckRef(ctx, repo.URL, ref, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+		return nil, err
+	}
+
+	selected := append([]string{}, layers...)
+	sort.Strings(selected)
+
+	plan := newPlan("init", root)
+	plan.set("workspace", root)
+	plan.set("layers template", repo.URL)
+	plan.set("ref", ref)
+	plan.set("layers mode", mode)
+	plan.set("git mode", repoMode)
+	plan.set("package workspaces", valueOr(packageManager, "none"))
+	plan.set("layers", valueOr(strings.Join(selected, ", "), "all"))
+	plan.set("profile", valueOr(cfg.Profile(), "none"))
+
+	layersDir := filepath.Join(root, layersPrefix)
+	plan.createDir(root)
+	plan.createDir(filepath.Join(root, "apps"))
+	if info, err := os.Stat(layersDir); err == nil {
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s exists but is not a directory", layersDir)
+		}
+		empty, err := isDirEmpty(layersDir)
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			if !force {
+				return nil, fmt.Errorf("directory %s already exists and is not empty (use --force to override)", layersDir)
+			}
+			plan.deleteDir(layersDir, "cleared because of --force")
+			plan.Dirs = append(plan.Dirs, PlanDir{Path: layersPrefix})
+		}
+	} else {
+		plan.createDir(layersDir)
+	}
+
+	tmp, err := os.MkdirTemp("", "couchfusion-plan-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plan directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	checkout := filepath.Join(tmp, layersPrefix)
+	if err := gitutil.Clone(ctx, repo.URL, ref, checkout, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+		return nil, err
+	}
+	revision, err := resolveTemplateRevision(ctx, repo.URL, ref, checkout)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) > 0 {
+		available, err := layerDirs(checkout)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range selected {
+			if !containsModule(available, name) {
+				return nil, fmt.Errorf("layer '%s' is not part of the base layers (available: %s)", name, strings.Join(available, ", "))
+			}
+		}
+	}
+
+	if repoMode == gitModeMonorepo {
+		if _, err := os.Stat(filepath.Join(root, ".git")); err == nil {
+			plan.action("reuse the git repository at the workspace root")
+		} else {
+			plan.action("initialize the workspace git repository at the workspace root")
+		}
+	}
+	commit := shortCommit(revision.Commit)
+	switch mode {
+	case layersModeSubtree:
+		plan.action("add %s at %s (commit %s) to the workspace repository with git subtree add --prefix=%s --squash", repo.URL, ref, commit, layersPrefix)
+	case layersModeRemote:
+		plan.action("clone %s at %s (commit %s) into %s and rename its remote to %s", repo.URL, ref, commit, layersPrefix, upstreamRemote)
+	default:
+		plan.action("clone %s at %s (commit %s) into %s", repo.URL, ref, commit, layersPrefix)
+	}
+	if len(selected) > 0 {
+		if mode == layersModeSnapshot {
+			plan.action("keep only the selected layers: %s", strings.Join(selected, ", "))
+		} else {
+			plan.action("sparse-checkout only the selected layers: %s", strings.Join(selected, ", "))
+		}
+	}
+	if mode == layersModeSnapshot {
+		planProjectRepo(plan, cfg.Git.Scaffold, repoMode, layersDir, layersPrefix)
+	}
+	if repoMode == gitModeMonorepo {
+		if cfg.Git.Scaffold.InitialCommit {
+			plan.action("commit the workspace: %q", cfg.Git.Scaffold.ResolveCommitMessage())
+		} else {
+			plan.action("stage the workspace in its git repository")
+		}
+	}
+
+	manifest := &workspaceManifest{
+		ManifestVersion:   1,
+		Layers:            layersManifest{Mode: mode, Selected: selected},
+		GitMode:           repoMode,
+		PackageWorkspaces: packageManager,
+	}
+	names := append(workspaceFileNames(packageManager), manifestFileName)
+	err = planRootFiles(ctx, plan, root, func(shadow string) error {
+		if err := syncPackageWorkspaces(shadow, packageManager); err != nil {
+			return err
+		}
+		if err := manifest.save(shadow); err != nil {
+			return err
+		}
+		return recordRevision(shadow, layersPrefix, revision)
+	}, names...)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// PlanNew resolves a `new` run like RunNew and runs its pipeline against a
+// temporary directory to describe the app it would create.
+func PlanNew(ctx context.Context, cfg *config.Config, appName string, modules []string, overrideBranch string, force bool, cloneOpts ...gitutil.CloneOption) (*Plan, error) {
+	state := newRunState("new", appName, newAppSteps)
+	state.Modules = modules
+	state.Ref = cfg.Repos["new"].ResolveRef(overrideBranch)
+	return planNewApp(ctx, cfg, state, force, cloneOpts)
+}
+
+// PlanNewFrom is PlanNew for RunNewFrom.
+func PlanNewFrom(ctx context.Context, cfg *config.Config, source *AppSource, appName, overrideBranch string, force bool, cloneOpts ...gitutil.CloneOption) (*Plan, error) {
+	state, err := source.runState(cfg, appName, overrideBranch)
+	if err != nil {
+		return nil, err
+	}
+	return planNewApp(ctx, cfg, state, force, cloneOpts)
+}
+
+func planNewApp(ctx context.Context, cfg *config.Config, state *runState, force bool, cloneOpts []gitutil.CloneOption) (*Plan, error) {
+	root, manifest, err := openWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLayersPresent(root, state.Modules); err != nil {
+		return nil, err
+	}
+
+	repo := newAppRepo(cfg, state)
+	if err := gitutil.CheckRef(ctx, repo.URL, state.cloneRef(), repo.Protocol, repo.AuthPrompt, repoCloneOptions(repo, cloneOpts)...); err != nil {
+		return nil, err
+	}
+
+	target := filepath.Join(root, "apps", state.Name)
+	plan := newPlan("new", root)
+	plan.set("app", state.Name)
+	plan.set("modules", valueOr(strings.Join(state.Modules, ", "), "none"))
+	plan.set("starter template", repo.URL)
+	plan.set("ref", state.Ref)
+	if state.Commit != "" {
+		plan.set("commit", state.Commit)
+	}
+	plan.set("target", target)
+	plan.set("git mode", manifest.GitMode)
+	plan.set("package workspaces", valueOr(manifest.PackageWorkspaces, "none"))
+
+	tx, err := planScaffold(target, force, state, plan)
+	if err != nil {
+		return nil, err
+	}
+	if err := runNewApp(ctx, cfg, root, manifest, tx, cloneOpts); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// PlanCreateLayer resolves a create_layer run like RunCreateLayer and runs its
+// pipeline against a temporary directory.
+func PlanCreateLayer(ctx context.Context, cfg *config.Config, layerName string, overrideBranch string, force bool, cloneOpts ...gitutil.CloneOption) (*Plan, error) {
+	root, manifest, err := openWorkspace()
+	if err != nil {
+		return nil, err
+	}
+
+	repo := cfg.Repos["create_layer"]
+	ref := repo.ResolveRef(overrideBranch)
+	if err := gitutil.CheckRef(ctx, repo.URL, ref, repo.Protocol, repo.AuthPrompt, repoCloneOptions(repo, cloneOpts)...); err != nil {
+		return nil, err
+	}
+
+	target := filepath.Join(root, layersPrefix, layerName)
+	plan := newPlan("create_layer", root)
+	plan.set("layer", layerName)
+	plan.set("layer template", repo.URL)
+	plan.set("ref", ref)
+	plan.set("target", target)
+	plan.set("git mode", manifest.GitMode)
+	plan.set("package workspaces", valueOr(manifest.PackageWorkspaces, "none"))
+
+	state := newRunState("create_layer", layerName, createLayerSteps)
+	state.Ref = ref
+	tx, err := planScaffold(target, force, state, plan)
+	if err != nil {
+		return nil, err
+	}
+	if err := runCreateLayer(ctx, cfg, root, manifest, tx, cloneOpts); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
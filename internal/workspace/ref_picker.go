@@ -0,0 +1,196 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/nuxt-apps/couchfusion/internal/config"
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+	"github.com/nuxt-apps/couchfusion/internal/ui"
+)
+
+// refPickerRows bounds how many refs are listed at once.
+const refPickerRows = 8
+
+type refsLoadedMsg struct {
+	refs []gitutil.RemoteRef
+	err  error
+}
+
+// loadRefsCmd lists the branches and tags of repo in the background.
+func loadRefsCmd(ctx context.Context, repo config.RepoConfig, logs *ui.LogBuffer, cloneOpts []gitutil.CloneOption) tea.Cmd {
+	opts := append(repoCloneOptions(repo, cloneOpts), gitutil.WithOutput(logs.Writer(ui.Info)))
+	return func() tea.Msg {
+		refs, err := gitutil.ListRemoteRefs(ctx, repo.URL, repo.Protocol, repo.AuthPrompt, opts...)
+		return refsLoadedMsg{refs: refs, err: err}
+	}
+}
+
+// refPickerModel filters the remote branches and tags of a repository as the
+// user types. The configured default ref is marked and highlighted initially.
+type refPickerModel struct {
+	filter  textinput.Model
+	def     string
+	refs    []gitutil.RemoteRef
+	matches []gitutil.RemoteRef
+	cursor  int
+	loaded  bool
+	err     error
+}
+
+func newRefPickerModel(hint, def string) refPickerModel {
+	filter := textinput.New()
+	filter.Placeholder = "type to filter, or enter a commit SHA"
+	filter.CharLimit = 128
+	filter.Prompt = "Filter: "
+	filter.SetValue(hint)
+	return refPickerModel{filter: filter, def: def}
+}
+
+// Loaded reports whether the ref listing has finished.
+func (m refPickerModel) Loaded() bool {
+	return m.loaded
+}
+
+func (m *refPickerModel) SetRefs(msg refsLoadedMsg) {
+	m.loaded = true
+	m.refs, m.err = msg.refs, msg.err
+	if m.def != "" && len(m.refs) > 0 && !m.has(m.def) {
+		// Keep a pinned commit (or a ref the listing lacks) selectable as the default.
+		m.refs = append([]gitutil.RemoteRef{{Name: m.def}}, m.refs...)
+	}
+	m.refilter()
+}
+
+func (m refPickerModel) has(name string) bool {
+	for _, ref := range m.refs {
+		if ref.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *refPickerModel) Focus() tea.Cmd {
+	return m.filter.Focus()
+}
+
+func (m *refPickerModel) Blur() {
+	m.filter.Blur()
+}
+
+func (m *refPickerModel) Update(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "up", "ctrl+p":
+		if m.cursor > 0 {
+			m.cursor--
+		} else if len(m.matches) > 0 {
+			m.cursor = len(m.matches) - 1
+		}
+		return nil
+	case "down", "ctrl+n":
+		if m.cursor < len(m.matches)-1 {
+			m.cursor++
+		} else {
+			m.cursor = 0
+		}
+		return nil
+	}
+	var cmd tea.Cmd
+	m.filter, cmd = m.filter.Update(msg)
+	m.refilter()
+	return cmd
+}
+
+func (m *refPickerModel) refilter() {
+	query := strings.ToLower(strings.TrimSpace(m.filter.Value()))
+	m.matches = m.matches[:0]
+	m.cursor = 0
+	for _, ref := range m.refs {
+		if query != "" && !strings.Contains(strings.ToLower(ref.Name), query) {
+			continue
+		}
+		// Prefer an exact match, otherwise the configured default.
+		if ref.Name == query || (query == "" && ref.Name == m.def) {
+			m.cursor = len(m.matches)
+		}
+		m.matches = append(m.matches, ref)
+	}
+}
+
+// Selected returns the chosen ref, or an empty string for the configured
+// default. Commit SHAs are accepted as typed, and any typed value is accepted
+// when the refs could not be listed.
+func (m refPickerModel) Selected() (string, error) {
+	typed := strings.TrimSpace(m.filter.Value())
+	var value string
+	switch {
+	case len(m.matches) > 0:
+		value = m.matches[m.cursor].Name
+	case typed == "", gitutil.IsCommitSHA(typed), m.err != nil, len(m.refs) == 0:
+		value = typed
+	default:
+		return "", fmt.Errorf("no branch or tag matches '%s'", typed)
+	}
+	if value == m.def {
+		return "", nil
+	}
+	return value, nil
+}
+
+func (m refPickerModel) View() string {
+	lines := []string{m.filter.View(), ""}
+	switch {
+	case !m.loaded:
+		lines = append(lines, hintStyle.Render("Loading branches and tags..."))
+	case m.err != nil:
+		lines = append(lines, ui.LogWarn.Render("Could not list remote refs; the typed value is used as-is."))
+	case len(m.refs) == 0:
+		lines = append(lines, hintStyle.Render("The source has no branches or tags; the typed value is used as-is."))
+	case len(m.matches) == 0:
+		if gitutil.IsCommitSHA(strings.TrimSpace(m.filter.Value())) {
+			lines = append(lines, hintStyle.Render("Commit SHA; checked out detached."))
+		} else {
+			lines = append(lines, hintStyle.Render("No branch or tag matches."))
+		}
+	default:
+		start := 0
+		if m.cursor >= refPickerRows {
+			start = m.cursor - refPickerRows + 1
+		}
+		end := start + refPickerRows
+		if end > len(m.matches) {
+			end = len(m.matches)
+		}
+		for i := start; i < end; i++ {
+			lines = append(lines, m.renderRef(i))
+		}
+		if hidden := len(m.matches) - (end - start); hidden > 0 {
+			lines = append(lines, hintStyle.Render(fmt.Sprintf("%d more...", hidden)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m refPickerModel) renderRef(index int) string {
+	ref := m.matches[index]
+	kind := "branch"
+	if ref.Tag {
+		kind = "tag"
+	}
+	label := fmt.Sprintf("%-6s %s", kind, ref.Name)
+	if ref.Name == m.def {
+		label += " (default)"
+	}
+	if index == m.cursor {
+		return rowActiveStyle.Render(cursorStyle.Render("›") + " " + label)
+	}
+	if ref.Name == m.def {
+		return rowSelectedStyle.Render("  " + label)
+	}
+	return rowStyle.Render("  " + label)
+}
@@ -0,0 +1,62 @@
+package workspace
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nuxt-apps/couchfusion/internal/ui"
+)
+
+// stepList shows the steps of a scaffolding pipeline in a TUI: the plan on the
+// summary screen, live progress while running and the timings afterwards.
+// Observe is called from the goroutine running the workflow; the spinner ticks
+// redraw the view.
+type stepList struct {
+	mu     sync.Mutex
+	defs   []stepDef
+	events map[string]StepEvent
+}
+
+func newStepList(defs []stepDef) *stepList {
+	return &stepList{defs: defs, events: map[string]StepEvent{}}
+}
+
+// Observe records a step transition; pass it to WithStepObserver.
+func (l *stepList) Observe(event StepEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events[event.Name] = event
+}
+
+// View renders one line per step; spinner is drawn in front of the running one.
+func (l *stepList) View(spinner string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lines := make([]string, 0, len(l.defs)+1)
+	var total time.Duration
+	finished := false
+	for i, def := range l.defs {
+		event, seen := l.events[def.Name]
+		label := fmt.Sprintf("%d. %s", i+1, def.Title)
+		switch {
+		case !seen:
+			lines = append(lines, hintStyle.Render("○ "+label))
+		case event.Status == StepRunning:
+			lines = append(lines, spinner+" "+label)
+		case event.Status == StepSkipped:
+			lines = append(lines, ui.LogSuccess.Render("✓ "+label)+hintStyle.Render("  resumed"))
+		case event.Status == StepFailed:
+			lines = append(lines, ui.LogError.Render("✗ "+label)+hintStyle.Render("  "+formatStepDuration(event.Duration)))
+		default:
+			total += event.Duration
+			finished = i == len(l.defs)-1
+			lines = append(lines, ui.LogSuccess.Render("✓ "+label)+hintStyle.Render("  "+formatStepDuration(event.Duration)))
+		}
+	}
+	if finished {
+		lines = append(lines, hintStyle.Render("Total "+formatStepDuration(total)))
+	}
+	return strings.Join(lines, "\n")
+}
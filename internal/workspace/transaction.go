@@ -0,0 +1,310 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nuxt-apps/couchfusion/internal/logging"
+)
+
+const stagingPrefix = ".couchfusion-staging-"
+
+// scaffoldTx builds a project in a staging directory next to its target and
+// moves it into place with a rename once every step succeeded. Side effects
+// outside the staging directory register an undo step; rollback runs them in
+// reverse. The staging directory is kept for --resume when a step completed
+// (see runPipeline) and deleted otherwise. A transaction started by
+// planScaffold only records its changes in plan; one started by editScaffold
+// changes an existing project in place.
+type scaffoldTx struct {
+	target    string
+	staging   string
+	replace   bool
+	state     *runState
+	current   string
+	undo      []undoStep
+	committed bool
+	plan      *Plan
+	baseline  map[string][]byte
+	inPlace   bool
+}
+
+type undoStep struct {
+	step        string
+	description string
+	run         func(context.Context) error
+}
+
+// beginScaffold checks target the way prepareForClone does and creates the
+// staging directory for a fresh run recorded in state. With force an existing
+// project is only replaced by commit, so a failed run leaves it untouched.
+func beginScaffold(target string, force bool, state *runState) (*scaffoldTx, error) {
+	parent, name := filepath.Dir(target), filepath.Base(target)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to ensure parent directory for %s: %w", target, err)
+	}
+
+	replace, err := checkScaffoldTarget(target, force)
+	if err != nil {
+		return nil, err
+	}
+
+	// Staging directories of failed or killed runs are superseded by this one.
+	stale, _ := filepath.Glob(filepath.Join(parent, stagingPrefix+name+"-*"))
+	for _, dir := range stale {
+		if _, err := loadRunState(dir); err == nil {
+			logging.Warnf("Discarding the unfinished run of '%s'; use --resume to continue such a run instead of starting over.", name)
+		}
+		_ = os.RemoveAll(dir)
+	}
+
+	staging, err := os.MkdirTemp(parent, stagingPrefix+name+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory for %s: %w", target, err)
+	}
+	return &scaffoldTx{target: target, staging: staging, replace: replace, state: state}, nil
+}
+
+// planScaffold is beginScaffold for --dry-run: it records the directories
+// beginScaffold and commit would create or delete and builds the project in a
+// temporary directory outside the workspace.
+func planScaffold(target string, force bool, state *runState, plan *Plan) (*scaffoldTx, error) {
+	replace, err := checkScaffoldTarget(target, force)
+	if err != nil {
+		return nil, err
+	}
+
+	stale, _ := filepath.Glob(filepath.Join(filepath.Dir(target), stagingPrefix+filepath.Base(target)+"-*"))
+	for _, dir := range stale {
+		plan.deleteDir(dir, "staging directory of an unfinished run")
+	}
+	if replace {
+		plan.deleteDir(target, "replaced because of --force")
+	}
+	plan.Dirs = append(plan.Dirs, PlanDir{Path: plan.rel(target)})
+
+	staging, err := os.MkdirTemp("", "couchfusion-plan-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plan directory: %w", err)
+	}
+	return &scaffoldTx{target: target, staging: staging, replace: replace, state: state, plan: plan}, nil
+}
+
+// editScaffold opens the existing project dir for changes in place. Rollback
+// only runs the undo steps, so callers preserve every file they change.
+func editScaffold(dir string) *scaffoldTx {
+	return &scaffoldTx{target: dir, staging: dir, inPlace: true}
+}
+
+// resumeScaffold reopens the staging directory of an unfinished command run
+// under parent. An empty name picks the only unfinished run.
+func resumeScaffold(parent, name, command string, force bool) (*scaffoldTx, error) {
+	dirs, _ := filepath.Glob(filepath.Join(parent, stagingPrefix+"*"))
+	type candidate struct {
+		dir   string
+		state *runState
+	}
+	var found []candidate
+	for _, dir := range dirs {
+		state, err := loadRunState(dir)
+		if err != nil || state.Command != command || (name != "" && state.Name != name) {
+			continue
+		}
+		found = append(found, candidate{dir: dir, state: state})
+	}
+
+	switch len(found) {
+	case 0:
+		if name != "" {
+			return nil, fmt.Errorf("no unfinished %s run of '%s' to resume", command, name)
+		}
+		return nil, fmt.Errorf("no unfinished %s run to resume", command)
+	case 1:
+	default:
+		names := make([]string, 0, len(found))
+		for _, c := range found {
+			names = append(names, c.state.Name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("several unfinished %s runs (%s); pass the name to resume", command, strings.Join(names, ", "))
+	}
+
+	target := filepath.Join(parent, found[0].state.Name)
+	replace, err := checkScaffoldTarget(target, force)
+	if err != nil {
+		return nil, err
+	}
+	return &scaffoldTx{target: target, staging: found[0].dir, replace: replace, state: found[0].state}, nil
+}
+
+// checkScaffoldTarget reports whether target exists and must be replaced on
+// commit, failing for non-empty targets without force.
+func checkScaffoldTarget(target string, force bool) (bool, error) {
+	info, err := os.Stat(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		return false, fmt.Errorf("%s exists but is not a directory", target)
+	}
+	empty, err := isDirEmpty(target)
+	if err != nil {
+		return false, err
+	}
+	if !empty && !force {
+		return false, fmt.Errorf("directory %s already exists and is not empty (use --force to override)", target)
+	}
+	return true, nil
+}
+
+// Dir is where the project is built until commit.
+func (tx *scaffoldTx) Dir() string {
+	return tx.staging
+}
+
+// onRollback registers fn to undo a side effect of the running step when the
+// transaction fails.
+func (tx *scaffoldTx) onRollback(description string, fn func(context.Context) error) {
+	tx.undo = append(tx.undo, undoStep{step: tx.current, description: description, run: fn})
+}
+
+// preserveFile restores path to its current content (or removes it again) on
+// rollback.
+func (tx *scaffoldTx) preserveFile(path string) error {
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		tx.onRollback("restore "+path, func(context.Context) error {
+			return os.WriteFile(path, data, 0o644)
+		})
+	case errors.Is(err, os.ErrNotExist):
+		tx.onRollback("remove "+path, func(context.Context) error {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			return nil
+		})
+	default:
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+// snapshot keeps the template's version of the plannedProjectFiles of a dry
+// run, right after the clone, for the diffs of planCommit.
+func (tx *scaffoldTx) snapshot() error {
+	if tx.plan == nil {
+		return nil
+	}
+	if rev := tx.state.Revision; rev != nil {
+		tx.plan.action("clone %s at %s (commit %s) into %s", rev.URL, rev.Ref, shortCommit(rev.Commit), tx.plan.rel(tx.target))
+	}
+	tx.baseline = map[string][]byte{}
+	for _, name := range plannedProjectFiles {
+		data, err := readOptional(filepath.Join(tx.staging, name))
+		if err != nil {
+			return err
+		}
+		tx.baseline[name] = data
+	}
+	return nil
+}
+
+// planCommit records the changes a dry run made to the template instead of
+// moving it into place, and the staging stageProjectRepo would do.
+func (tx *scaffoldTx) planCommit(ctx context.Context, gitMode string) error {
+	if gitMode == gitModeMonorepo {
+		tx.plan.action("stage %s and the updated workspace files in the workspace repository", tx.plan.rel(tx.target))
+	}
+	for _, name := range plannedProjectFiles {
+		after, err := readOptional(filepath.Join(tx.staging, name))
+		if err != nil {
+			return err
+		}
+		if err := tx.plan.file(ctx, filepath.Join(tx.target, name), tx.baseline[name], after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit drops the run state and moves the staging directory to the target,
+// replacing an existing project only at this point.
+func (tx *scaffoldTx) commit() error {
+	if tx.inPlace {
+		tx.committed = true
+		return nil
+	}
+	if err := tx.state.remove(tx.staging); err != nil {
+		return err
+	}
+	if !tx.replace {
+		if err := os.Rename(tx.staging, tx.target); err != nil {
+			return fmt.Errorf("failed to move %s into place: %w", tx.target, err)
+		}
+		tx.committed = true
+		return nil
+	}
+
+	backup := filepath.Join(filepath.Dir(tx.staging), ".couchfusion-replaced-"+filepath.Base(tx.target))
+	_ = os.RemoveAll(backup)
+	if err := os.Rename(tx.target, backup); err != nil {
+		return fmt.Errorf("failed to move existing %s aside: %w", tx.target, err)
+	}
+	if err := os.Rename(tx.staging, tx.target); err != nil {
+		_ = os.Rename(backup, tx.target)
+		return fmt.Errorf("failed to move %s into place: %w", tx.target, err)
+	}
+	tx.committed = true
+	if err := os.RemoveAll(backup); err != nil {
+		logging.Warnf("Failed to remove the replaced project at %s: %v", backup, err)
+	}
+	return nil
+}
+
+// rollback undoes a transaction that did not commit; it is meant to be
+// deferred right after beginScaffold or resumeScaffold. Undo failures are
+// reported but do not hide the error that caused the rollback.
+func (tx *scaffoldTx) rollback(ctx context.Context) {
+	if tx.committed {
+		return
+	}
+	if tx.plan != nil {
+		_ = os.RemoveAll(tx.staging)
+		return
+	}
+	// The run may have failed because ctx was cancelled; cleanup still runs.
+	ctx = context.WithoutCancel(ctx)
+	undone := map[string]bool{}
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		step := tx.undo[i]
+		if err := step.run(ctx); err != nil {
+			logging.Warnf("Rollback could not %s: %v", step.description, err)
+		}
+		undone[step.step] = true
+	}
+	if tx.inPlace {
+		return
+	}
+
+	if tx.state.resumable() {
+		// Keep the completed steps; undone ones run again on --resume.
+		tx.state.reset(undone)
+		err := tx.state.save(tx.staging)
+		if err == nil {
+			return
+		}
+		logging.Warnf("Failed to save the run state for --resume: %v", err)
+	}
+	if err := os.RemoveAll(tx.staging); err != nil {
+		logging.Warnf("Failed to remove staging directory %s: %v", tx.staging, err)
+	}
+}
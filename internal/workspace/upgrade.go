@@ -0,0 +1,115 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nuxt-apps/couchfusion/internal/config"
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+)
+
+// upgradeSkipPaths are generated per app and never taken from the starter.
+var upgradeSkipPaths = map[string]struct{}{
+	appMetadataFileName:      {},
+	"docs/module_setup.json": {},
+	".env":                   {},
+}
+
+// RunUpgrade merges starter changes between the app's recorded base revision and
+// targetRef (the configured starter ref when empty) into apps/<appName>.
+func RunUpgrade(ctx context.Context, cfg *config.Config, appName, targetRef string, dryRun bool, cloneOpts ...gitutil.CloneOption) (*MergeReport, error) {
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine current working directory: %w", err)
+	}
+	if err := checkInitialized(root); err != nil {
+		return nil, err
+	}
+
+	appDir := filepath.Join(root, "apps", appName)
+	meta, err := loadAppMetadata(appDir)
+	if err != nil {
+		return nil, err
+	}
+	base := meta.Starter
+	if base.Commit == "" {
+		return nil, fmt.Errorf("app '%s' has no recorded starter commit; upgrade needs an app scaffolded from a git starter", appName)
+	}
+
+	repo := cfg.Repos["new"]
+	if !gitutil.SameRepository(repo.URL, base.URL) {
+		// Keep fetching from the repository the app was created from.
+		repo = cfg.ResolveRepo(config.RepoConfig{URL: base.URL})
+	}
+	ref := repo.ResolveRef(targetRef)
+	if ref == "" {
+		ref = base.Ref
+	}
+	cloneOpts = repoCloneOptions(repo, cloneOpts)
+
+	tmp, err := os.MkdirTemp("", "couchfusion-upgrade-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	baseDir := filepath.Join(tmp, "base")
+	targetDir := filepath.Join(tmp, "target")
+	if err := gitutil.Clone(ctx, repo.URL, base.Commit, baseDir, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+		return nil, fmt.Errorf("failed to fetch base revision: %w", err)
+	}
+	if err := gitutil.Clone(ctx, repo.URL, ref, targetDir, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+		return nil, fmt.Errorf("failed to fetch target revision: %w", err)
+	}
+	target, err := resolveTemplateRevision(ctx, repo.URL, ref, targetDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MergeReport{BaseCommit: base.Commit, TargetCommit: target.Commit}
+	if target.Commit == base.Commit {
+		return report, nil
+	}
+
+	merge := treeMerge{
+		baseDir:   baseDir,
+		theirsDir: targetDir,
+		oursDir:   appDir,
+		dryRun:    dryRun,
+		skip: func(rel string) bool {
+			_, skip := upgradeSkipPaths[rel]
+			return skip
+		},
+	}
+	if err := merge.run(ctx, report); err != nil {
+		return report, err
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	if err := updateAppStarter(appDir, target); err != nil {
+		return report, err
+	}
+	return report, recordRevision(root, "apps/"+appName, target)
+}
+
+// updateAppStarter rewrites the starter revision in couchfusion.json.
+func updateAppStarter(appDir string, starter templateRevision) error {
+	return editAppMetadata(appDir, func(meta *appMetadata) {
+		meta.record("upgrade", fmt.Sprintf("starter %s -> %s", shortCommit(meta.Starter.Commit), shortCommit(starter.Commit)))
+		meta.Starter = starter
+	})
+}
+
+// editAppMetadata applies edit to the app's couchfusion.json.
+func editAppMetadata(appDir string, edit func(meta *appMetadata)) error {
+	meta, err := loadAppMetadata(appDir)
+	if err != nil {
+		return err
+	}
+	edit(meta)
+	return meta.save(appDir)
+}
@@ -0,0 +1,376 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nuxt-apps/couchfusion/internal/config"
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
+)
+
+// layerEnvKeys are the .env keys each layer needs in the apps that use it; they
+// are written by applyLayerParameters.
+var layerEnvKeys = map[string][]string{
+	"auth": {"COUCHDB_ADMIN_AUTH", "COUCHDB_COOKIE_SECRET"},
+}
+
+// VerifyIssue is a difference between an app's couchfusion.json and its files.
+type VerifyIssue struct {
+	App    string
+	File   string
+	Detail string
+	// Fix describes how --fix reconciles the issue; empty when it cannot.
+	Fix   string
+	Fixed bool
+}
+
+// VerifyReport lists the apps RunVerify checked and the issues it found.
+type VerifyReport struct {
+	Apps   []string
+	Issues []VerifyIssue
+}
+
+func (r *VerifyReport) add(app, file, fix, format string, args ...any) {
+	r.Issues = append(r.Issues, VerifyIssue{App: app, File: file, Detail: fmt.Sprintf(format, args...), Fix: fix})
+}
+
+// HasIssues reports whether issues remain that were not fixed.
+func (r *VerifyReport) HasIssues() bool {
+	for _, issue := range r.Issues {
+		if !issue.Fixed {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints the issues of every app, or that it is consistent, and a summary.
+func (r *VerifyReport) Write(w io.Writer) {
+	fixed, open := 0, 0
+	for _, app := range r.Apps {
+		path := "apps/" + app
+		clean := true
+		for _, issue := range r.Issues {
+			if issue.App != app {
+				continue
+			}
+			clean = false
+			switch {
+			case issue.Fixed:
+				fixed++
+				fmt.Fprintf(w, "  ~ %s: %s: %s (fixed: %s)\n", path, issue.File, issue.Detail, issue.Fix)
+			case issue.Fix != "":
+				open++
+				fmt.Fprintf(w, "  ! %s: %s: %s (--fix will %s)\n", path, issue.File, issue.Detail, issue.Fix)
+			default:
+				open++
+				fmt.Fprintf(w, "  ! %s: %s: %s\n", path, issue.File, issue.Detail)
+			}
+		}
+		if clean {
+			fmt.Fprintf(w, "  = %s\n", path)
+		}
+	}
+	fmt.Fprintf(w, "Verified %d apps: %d issues, %d fixed.\n", len(r.Apps), open, fixed)
+}
+
+// RunVerify cross-checks the modules recorded in the couchfusion.json of each
+// app (every app under apps/ when apps is empty) against its package.json
+// dependencies, nuxt.config.ts extends, .env keys and the layers present in the
+// workspace. couchfusion.json is the reference: with fix the files are
+// reconciled with it, which may configure layer parameters again and add
+// missing base layers through RunLayersAdd.
+func RunVerify(ctx context.Context, cfg *config.Config, apps []string, fix bool, cloneOpts ...gitutil.CloneOption) (*VerifyReport, error) {
+	root, manifest, err := openWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	if len(apps) == 0 {
+		if apps, err = listProjects(filepath.Join(root, "apps")); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &VerifyReport{Apps: apps}
+	metas := map[string]*appMetadata{}
+	for _, app := range apps {
+		meta, err := loadAppMetadata(filepath.Join(root, "apps", app))
+		if err != nil {
+			report.add(app, appMetadataFileName, "", "%v", err)
+			continue
+		}
+		metas[app] = meta
+		if err := verifyApp(cfg, root, manifest, app, meta, report); err != nil {
+			return report, err
+		}
+	}
+	if !fix {
+		return report, nil
+	}
+
+	if err := fixMissingLayers(ctx, cfg, report, cloneOpts); err != nil {
+		return report, err
+	}
+	for _, app := range apps {
+		if meta, ok := metas[app]; ok {
+			if err := fixApp(ctx, root, manifest, app, meta, report); err != nil {
+				return report, fmt.Errorf("failed to fix apps/%s: %w", app, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+func verifyApp(cfg *config.Config, root string, manifest *workspaceManifest, app string, meta *appMetadata, report *VerifyReport) error {
+	appDir := filepath.Join(root, "apps", app)
+	for _, module := range meta.Modules {
+		if _, ok := cfg.Modules[module]; !ok {
+			report.add(app, appMetadataFileName, "", "module '%s' is not in the config", module)
+		}
+		if _, err := os.Stat(filepath.Join(root, "layers", module)); err != nil {
+			fix := ""
+			if len(manifest.Layers.Selected) > 0 && !manifest.Layers.includes(module) {
+				fix = "add the base layer " + module
+			}
+			report.add(app, "layers/"+module, fix, "missing for module '%s'", module)
+		}
+	}
+
+	deps, err := readLayerDependencies(appDir)
+	if err != nil {
+		return err
+	}
+	for _, module := range meta.Modules {
+		if _, ok := deps[module]; !ok {
+			report.add(app, "package.json", "add it", "%s dependency missing", layerPackageName(module))
+		}
+	}
+	for _, module := range sortedKeys(deps) {
+		if !containsModule(meta.Modules, module) {
+			report.add(app, "package.json", "remove it", "%s dependency not in couchfusion.json", layerPackageName(module))
+		}
+	}
+
+	extends, ok, err := readLayerExtends(appDir)
+	if err != nil {
+		return err
+	}
+	if ok {
+		for _, module := range meta.Modules {
+			if !containsModule(extends, module) {
+				report.add(app, "nuxt.config.ts", "rewrite extends", "does not extend layers/%s", module)
+			}
+		}
+		for _, module := range extends {
+			if !containsModule(meta.Modules, module) {
+				report.add(app, "nuxt.config.ts", "rewrite extends", "extends layers/%s, which is not in couchfusion.json", module)
+			}
+		}
+	}
+
+	env := readEnvKeys(filepath.Join(appDir, ".env"))
+	for _, module := range meta.Modules {
+		for _, key := range layerEnvKeys[module] {
+			if _, ok := env[key]; !ok {
+				report.add(app, ".env", "configure the "+module+" layer", "%s missing for module '%s'", key, module)
+			}
+		}
+	}
+	return nil
+}
+
+// readLayerDependencies returns the layers the app's package.json depends on,
+// keyed by layer name.
+func readLayerDependencies(appDir string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(appDir, "package.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read package.json: %w", err)
+	}
+	var pkg struct {
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(appDir, "package.json"), err)
+	}
+	layers := map[string]string{}
+	prefix := layerPackageName("")
+	for name, spec := range pkg.Dependencies {
+		if layer, ok := strings.CutPrefix(name, prefix); ok {
+			layers[layer] = spec
+		}
+	}
+	return layers, nil
+}
+
+var (
+	extendsBlockPattern = regexp.MustCompile(`(?s)extends\s*:\s*\[(.*?)\]`)
+	extendsLayerPattern = regexp.MustCompile(`['"][^'"]*\blayers/([^/'"]+)/?['"]`)
+)
+
+// readLayerExtends returns the layers extended in the app's nuxt.config.ts,
+// matching the entries written by updateNuxtExtends. ok is false when the app
+// has no nuxt.config.ts.
+func readLayerExtends(appDir string) ([]string, bool, error) {
+	data, err := os.ReadFile(filepath.Join(appDir, "nuxt.config.ts"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to read nuxt.config.ts: %w", err)
+	}
+	layers := []string{}
+	block := extendsBlockPattern.FindSubmatch(data)
+	if block == nil {
+		return layers, true, nil
+	}
+	for _, match := range extendsLayerPattern.FindAllSubmatch(block[1], -1) {
+		layers = append(layers, string(match[1]))
+	}
+	return layers, true, nil
+}
+
+// readEnvKeys returns the keys set in a .env file; a missing file has none.
+func readEnvKeys(path string) map[string]struct{} {
+	keys := map[string]struct{}{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return keys
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && strings.TrimSpace(value) != "" {
+			keys[strings.TrimSpace(key)] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// fixMissingLayers adds the missing base layers reported for any app at once.
+func fixMissingLayers(ctx context.Context, cfg *config.Config, report *VerifyReport, cloneOpts []gitutil.CloneOption) error {
+	var names []string
+	for _, issue := range report.Issues {
+		if strings.HasPrefix(issue.File, "layers/") && issue.Fix != "" {
+			if name := strings.TrimPrefix(issue.File, "layers/"); !containsModule(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	if err := RunLayersAdd(ctx, cfg, names, cloneOpts...); err != nil {
+		return err
+	}
+	for i := range report.Issues {
+		if strings.HasPrefix(report.Issues[i].File, "layers/") && report.Issues[i].Fix != "" {
+			report.Issues[i].Fixed = true
+		}
+	}
+	return nil
+}
+
+// fixApp reconciles package.json, nuxt.config.ts and .env of app with its
+// couchfusion.json. Like updateAppModules it works in place and restores every
+// file when a step fails.
+func fixApp(ctx context.Context, root string, manifest *workspaceManifest, app string, meta *appMetadata, report *VerifyReport) error {
+	files := map[string]bool{}
+	var envModules []string
+	for _, issue := range report.Issues {
+		if issue.App != app || issue.Fix == "" || issue.Fixed {
+			continue
+		}
+		files[issue.File] = true
+		if issue.File == ".env" {
+			for _, module := range meta.Modules {
+				if issue.Fix == "configure the "+module+" layer" && !containsModule(envModules, module) {
+					envModules = append(envModules, module)
+				}
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	appDir := filepath.Join(root, "apps", app)
+	tx := editScaffold(appDir)
+	tx.state = newRunState("verify", app, nil)
+	defer tx.rollback(ctx)
+	for _, name := range plannedProjectFiles {
+		if err := tx.preserveFile(filepath.Join(appDir, name)); err != nil {
+			return err
+		}
+	}
+
+	if files["package.json"] {
+		deps, err := readLayerDependencies(appDir)
+		if err != nil {
+			return err
+		}
+		var extra []string
+		for module := range deps {
+			if !containsModule(meta.Modules, module) {
+				extra = append(extra, module)
+			}
+		}
+		if err := removeLayerDependencies(appDir, extra); err != nil {
+			return err
+		}
+		var missing []string
+		for _, module := range meta.Modules {
+			if _, ok := deps[module]; !ok {
+				missing = append(missing, module)
+			}
+		}
+		if err := updateLayerDependencies(appDir, missing, manifest.PackageWorkspaces); err != nil {
+			return err
+		}
+	}
+	if files["nuxt.config.ts"] {
+		if err := updateNuxtExtends(appDir, meta.Modules); err != nil {
+			return err
+		}
+	}
+	if len(envModules) > 0 {
+		if err := applyLayerParameters(ctx, tx, envModules); err != nil {
+			return err
+		}
+	}
+
+	fixed := []string{}
+	for _, file := range []string{"package.json", "nuxt.config.ts", ".env"} {
+		if files[file] {
+			fixed = append(fixed, file)
+		}
+	}
+	err := editAppMetadata(appDir, func(meta *appMetadata) {
+		meta.setParameters(tx.state.Parameters)
+		meta.addDatabases(tx.state.Databases)
+		meta.record("verify", "fixed "+strings.Join(fixed, ", "))
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.commit(); err != nil {
+		return err
+	}
+	for i := range report.Issues {
+		if report.Issues[i].App == app && files[report.Issues[i].File] {
+			report.Issues[i].Fixed = true
+		}
+	}
+	return nil
+}
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -22,13 +21,44 @@ import (
 	"github.com/nuxt-apps/couchfusion/internal/gitutil"
 )
 
-// RunInit performs workspace initialization.
-func RunInit(ctx context.Context, cfg *config.Config, targetPath, overrideLayerBranch string, force bool, cloneOpts ...gitutil.CloneOption) error {
+// RunInit performs workspace initialization. layersMode overrides
+// workspace.layersMode (snapshot, remote or subtree), gitMode overrides
+// workspace.gitMode (per-project or monorepo) and packageWorkspaces overrides
+// workspace.packageWorkspaces (bun, npm, pnpm or none) when set; a non-empty
+// layers list materializes only those base layers.
+func RunInit(ctx context.Context, cfg *config.Config, targetPath, overrideLayerBranch, layersMode, gitMode, packageWorkspaces string, layers []string, force bool, cloneOpts ...gitutil.CloneOption) error {
 	root, err := resolvePath(targetPath)
 	if err != nil {
 		return err
 	}
 
+	mode, err := cfg.ResolveLayersMode(layersMode)
+	if err != nil {
+		return err
+	}
+
+	repoMode, err := cfg.ResolveGitMode(gitMode)
+	if err != nil {
+		return err
+	}
+	if repoMode == gitModeMonorepo && mode == layersModeRemote {
+		return fmt.Errorf("layers mode remote keeps /layers as its own repository; use snapshot or subtree with git mode monorepo")
+	}
+
+	packageManager, err := cfg.ResolvePackageWorkspaces(packageWorkspaces)
+	if err != nil {
+		return err
+	}
+
+	repo := cfg.Repos["init"]
+	ref := repo.ResolveRef(overrideLayerBranch)
+	cloneOpts = repoCloneOptions(repo, cloneOpts)
+
+	// Reject unknown branches and tags before any directory is created.
+	if err := gitutil.CheckRef(ctx, repo.URL, ref, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+		return err
+	}
+
 	if err := os.MkdirAll(root, 0o755); err != nil {
 		return fmt.Errorf("failed to create target path: %w", err)
 	}
@@ -44,37 +74,61 @@ func RunInit(ctx context.Context, cfg *config.Config, targetPath, overrideLayerB
 		return err
 	}
 
-	repo := cfg.Repos["init"]
-	branch := repo.Branch
-	if strings.TrimSpace(overrideLayerBranch) != "" {
-		branch = overrideLayerBranch
+	if repoMode == gitModeMonorepo {
+		if err := initWorkspaceRepo(ctx, cfg.Git.Scaffold, root); err != nil {
+			return err
+		}
+	}
+
+	selected := append([]string{}, layers...)
+	sort.Strings(selected)
+
+	revision, err := initLayers(ctx, root, repo, ref, mode, selected, cloneOpts)
+	if err != nil {
+		return err
+	}
+
+	if mode == layersModeSnapshot {
+		if err := prepareProjectRepo(ctx, cfg.Git.Scaffold, repoMode, layersDir, layersPrefix); err != nil {
+			return err
+		}
+		if repoMode == gitModePerProject {
+			if err := commitScaffold(ctx, cfg.Git.Scaffold, layersDir); err != nil {
+				return err
+			}
+		}
 	}
 
-	if err := gitutil.Clone(ctx, repo.URL, branch, layersDir, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+	if err := syncPackageWorkspaces(root, packageManager); err != nil {
 		return err
 	}
 
-	if err := reinitializeGitRepo(ctx, layersDir); err != nil {
+	manifest := &workspaceManifest{
+		ManifestVersion:   1,
+		Layers:            layersManifest{Mode: mode, Selected: selected},
+		GitMode:           repoMode,
+		PackageWorkspaces: packageManager,
+		Profile:           cfg.Profile(),
+	}
+	if err := manifest.save(root); err != nil {
+		return err
+	}
+
+	if err := recordRevision(root, "layers", revision); err != nil {
 		return err
 	}
 
+	if repoMode == gitModeMonorepo {
+		return finishWorkspaceRepo(ctx, cfg.Git.Scaffold, root)
+	}
 	return nil
 }
 
 // ResolveAppCreationInputs handles name/module selection logic.
 func ResolveAppCreationInputs(cfg *config.Config, providedName, providedModules string) (string, []string, error) {
-	name := strings.TrimSpace(providedName)
-	if name == "" {
-		var err error
-		name, err = prompt("Enter app name: ")
-		if err != nil {
-			return "", nil, err
-		}
-	}
-
-	name = sanitizeName(name)
-	if name == "" {
-		return "", nil, errors.New("app name cannot be empty")
+	name, err := ResolveAppName(providedName)
+	if err != nil {
+		return "", nil, err
 	}
 
 	modules := parseModules(providedModules)
@@ -107,92 +161,316 @@ func ResolveAppCreationInputs(cfg *config.Config, providedName, providedModules
 	return name, modules, nil
 }
 
-// RunNew scaffolds a new application directory and clones starter repo.
+// ResolveAppName ensures the app name is collected when missing.
+func ResolveAppName(provided string) (string, error) {
+	name := strings.TrimSpace(provided)
+	if name == "" {
+		var err error
+		name, err = prompt("Enter app name: ")
+		if err != nil {
+			return "", err
+		}
+	}
+	name = sanitizeName(name)
+	if name == "" {
+		return "", errors.New("app name cannot be empty")
+	}
+	return name, nil
+}
+
+// RunNew scaffolds a new application directory and clones starter repo. The app
+// is built by the newAppSteps pipeline in a staging directory and only moved to
+// apps/<name> when every step succeeded. A failure undoes CouchDB changes and
+// workspace file updates (see scaffoldTx) and keeps the completed steps for
+// ResumeNew.
 func RunNew(ctx context.Context, cfg *config.Config, appName string, modules []string, overrideBranch string, force bool, cloneOpts ...gitutil.CloneOption) error {
-	root, err := os.Getwd()
+	state := newRunState("new", appName, newAppSteps)
+	state.Modules = modules
+	state.Ref = cfg.Repos["new"].ResolveRef(overrideBranch)
+	return startNewApp(ctx, cfg, state, force, cloneOpts)
+}
+
+// RunNewFrom creates appName as a copy of the app described by source: same
+// modules, starter repository and commit, and non-secret parameters. A
+// non-empty overrideBranch replaces the recorded starter revision.
+func RunNewFrom(ctx context.Context, cfg *config.Config, source *AppSource, appName, overrideBranch string, force bool, cloneOpts ...gitutil.CloneOption) error {
+	state, err := source.runState(cfg, appName, overrideBranch)
 	if err != nil {
-		return fmt.Errorf("unable to determine current working directory: %w", err)
+		return err
 	}
-	appsDir := filepath.Join(root, "apps")
+	return startNewApp(ctx, cfg, state, force, cloneOpts)
+}
 
-	if err := checkInitialized(root); err != nil {
+func startNewApp(ctx context.Context, cfg *config.Config, state *runState, force bool, cloneOpts []gitutil.CloneOption) error {
+	root, manifest, err := openWorkspace()
+	if err != nil {
+		return err
+	}
+
+	if err := checkLayersPresent(root, state.Modules); err != nil {
 		return err
 	}
 
-	targetDir := filepath.Join(appsDir, appName)
-	if err := prepareForClone(targetDir, force); err != nil {
+	tx, err := beginScaffold(filepath.Join(root, "apps", state.Name), force, state)
+	if err != nil {
 		return err
 	}
+	return runNewApp(ctx, cfg, root, manifest, tx, cloneOpts)
+}
 
+// newAppRepo is the starter repository of a new app: the configured one unless
+// the run reproduces an app created from another repository.
+func newAppRepo(cfg *config.Config, state *runState) config.RepoConfig {
 	repo := cfg.Repos["new"]
-	branch := repo.Branch
-	if strings.TrimSpace(overrideBranch) != "" {
-		branch = overrideBranch
+	if state.Repo != "" && !gitutil.SameRepository(repo.URL, state.Repo) {
+		repo = cfg.ResolveRepo(config.RepoConfig{URL: state.Repo})
 	}
+	return repo
+}
 
-	if err := gitutil.Clone(ctx, repo.URL, branch, targetDir, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
-		return err
+// ResumeNew continues the unfinished `new` run of appName (or the only
+// unfinished one when appName is empty) from its first incomplete step and
+// returns the app name and modules recorded for it.
+func ResumeNew(ctx context.Context, cfg *config.Config, appName string, force bool, cloneOpts ...gitutil.CloneOption) (string, []string, error) {
+	root, manifest, err := openWorkspace()
+	if err != nil {
+		return "", nil, err
 	}
 
-	if err := reinitializeGitRepo(ctx, targetDir); err != nil {
-		return err
+	tx, err := resumeScaffold(filepath.Join(root, "apps"), appName, "new", force)
+	if err != nil {
+		return "", nil, err
 	}
+	state := tx.state
+	return state.Name, state.Modules, runNewApp(ctx, cfg, root, manifest, tx, cloneOpts)
+}
 
-	if err := updateLayerDependencies(targetDir, modules); err != nil {
-		return err
+func runNewApp(ctx context.Context, cfg *config.Config, root string, manifest *workspaceManifest, tx *scaffoldTx, cloneOpts []gitutil.CloneOption) error {
+	defer tx.rollback(ctx)
+	state := tx.state
+	dir := tx.Dir()
+
+	repo := newAppRepo(cfg, state)
+	cloneOpts = repoCloneOptions(repo, cloneOpts)
+
+	steps := bindSteps(newAppSteps, map[string]func(context.Context) error{
+		"clone": func(ctx context.Context) error {
+			if err := gitutil.Clone(ctx, repo.URL, state.cloneRef(), dir, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+				return err
+			}
+			revision, err := resolveTemplateRevision(ctx, repo.URL, state.Ref, dir)
+			if err != nil {
+				return err
+			}
+			state.Revision = &revision
+			return tx.snapshot()
+		},
+		"git": func(ctx context.Context) error {
+			if tx.plan != nil {
+				planProjectRepo(tx.plan, cfg.Git.Scaffold, manifest.GitMode, tx.target, state.Name)
+				return nil
+			}
+			return prepareProjectRepo(ctx, cfg.Git.Scaffold, manifest.GitMode, dir, state.Name)
+		},
+		"dependencies": func(context.Context) error {
+			return updateLayerDependencies(dir, state.Modules, manifest.PackageWorkspaces)
+		},
+		"parameters": func(ctx context.Context) error {
+			return applyLayerParameters(ctx, tx, state.Modules)
+		},
+		"extends": func(context.Context) error {
+			return updateNuxtExtends(dir, state.Modules)
+		},
+		"metadata": func(context.Context) error {
+			return writeAppMetadata(root, dir, state)
+		},
+		"module-setup": func(context.Context) error {
+			return writeModuleSetup(dir, cfg, state.Modules)
+		},
+		"commit": func(ctx context.Context) error {
+			if tx.plan != nil {
+				return nil
+			}
+			return commitProjectRepo(ctx, cfg.Git.Scaffold, manifest.GitMode, dir)
+		},
+		"workspace": func(ctx context.Context) error {
+			if err := updateWorkspaceFiles(ctx, tx, root, "apps/"+state.Name, *state.Revision, manifest.PackageWorkspaces); err != nil {
+				return err
+			}
+			if manifest.PackageWorkspaces != "" {
+				warnLayerPackageNames(root, state.Modules)
+			}
+			return nil
+		},
+	})
+	if err := runPipeline(ctx, tx, steps); err != nil {
+		if tx.plan != nil {
+			return err
+		}
+		return resumeHint(err, state, "new")
+	}
+	if tx.plan != nil {
+		return tx.planCommit(ctx, manifest.GitMode)
 	}
 
-	if err := applyLayerParameters(ctx, targetDir, modules); err != nil {
+	if err := tx.commit(); err != nil {
 		return err
 	}
+	return stageProjectRepo(ctx, manifest.GitMode, root, tx.target)
+}
 
-	if err := updateNuxtExtends(targetDir, modules); err != nil {
+// RunCreateLayer clones a new layer repository under /layers, staged and
+// committed by the createLayerSteps pipeline like RunNew.
+func RunCreateLayer(ctx context.Context, cfg *config.Config, layerName string, overrideBranch string, force bool, cloneOpts ...gitutil.CloneOption) error {
+	root, manifest, err := openWorkspace()
+	if err != nil {
 		return err
 	}
 
-	if err := writeAppMetadata(targetDir, appName, modules); err != nil {
+	repo := cfg.Repos["create_layer"]
+	ref := repo.ResolveRef(overrideBranch)
+
+	if err := gitutil.CheckRef(ctx, repo.URL, ref, repo.Protocol, repo.AuthPrompt, repoCloneOptions(repo, cloneOpts)...); err != nil {
 		return err
 	}
 
-	if err := writeModuleSetup(targetDir, cfg, modules); err != nil {
+	state := newRunState("create_layer", layerName, createLayerSteps)
+	state.Ref = ref
+
+	tx, err := beginScaffold(filepath.Join(root, "layers", layerName), force, state)
+	if err != nil {
 		return err
 	}
-
-	return nil
+	return runCreateLayer(ctx, cfg, root, manifest, tx, cloneOpts)
 }
 
-// RunCreateLayer clones a new layer repository under /layers.
-func RunCreateLayer(ctx context.Context, cfg *config.Config, layerName string, overrideBranch string, force bool, cloneOpts ...gitutil.CloneOption) error {
-	root, err := os.Getwd()
+// ResumeCreateLayer continues the unfinished create_layer run of layerName (or
+// the only unfinished one) and returns the layer name.
+func ResumeCreateLayer(ctx context.Context, cfg *config.Config, layerName string, force bool, cloneOpts ...gitutil.CloneOption) (string, error) {
+	root, manifest, err := openWorkspace()
 	if err != nil {
-		return fmt.Errorf("unable to determine current working directory: %w", err)
+		return "", err
 	}
 
-	if err := checkInitialized(root); err != nil {
-		return err
+	tx, err := resumeScaffold(filepath.Join(root, "layers"), layerName, "create_layer", force)
+	if err != nil {
+		return "", err
 	}
+	return tx.state.Name, runCreateLayer(ctx, cfg, root, manifest, tx, cloneOpts)
+}
 
-	layersDir := filepath.Join(root, "layers")
-	targetDir := filepath.Join(layersDir, layerName)
-	if err := prepareForClone(targetDir, force); err != nil {
-		return err
-	}
+func runCreateLayer(ctx context.Context, cfg *config.Config, root string, manifest *workspaceManifest, tx *scaffoldTx, cloneOpts []gitutil.CloneOption) error {
+	defer tx.rollback(ctx)
+	state := tx.state
+	dir := tx.Dir()
 
 	repo := cfg.Repos["create_layer"]
-	branch := repo.Branch
-	if strings.TrimSpace(overrideBranch) != "" {
-		branch = overrideBranch
+	cloneOpts = repoCloneOptions(repo, cloneOpts)
+
+	steps := bindSteps(createLayerSteps, map[string]func(context.Context) error{
+		"clone": func(ctx context.Context) error {
+			if err := gitutil.Clone(ctx, repo.URL, state.Ref, dir, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+				return err
+			}
+			revision, err := resolveTemplateRevision(ctx, repo.URL, state.Ref, dir)
+			if err != nil {
+				return err
+			}
+			state.Revision = &revision
+			return tx.snapshot()
+		},
+		"git": func(ctx context.Context) error {
+			if tx.plan != nil {
+				planProjectRepo(tx.plan, cfg.Git.Scaffold, manifest.GitMode, tx.target, state.Name)
+				return nil
+			}
+			return prepareProjectRepo(ctx, cfg.Git.Scaffold, manifest.GitMode, dir, state.Name)
+		},
+		"package-name": func(context.Context) error {
+			if manifest.PackageWorkspaces == "" {
+				return nil
+			}
+			return setLayerPackageName(dir, state.Name)
+		},
+		"commit": func(ctx context.Context) error {
+			if tx.plan != nil {
+				return nil
+			}
+			return commitProjectRepo(ctx, cfg.Git.Scaffold, manifest.GitMode, dir)
+		},
+		"workspace": func(ctx context.Context) error {
+			return updateWorkspaceFiles(ctx, tx, root, "layers/"+state.Name, *state.Revision, manifest.PackageWorkspaces)
+		},
+	})
+	if err := runPipeline(ctx, tx, steps); err != nil {
+		if tx.plan != nil {
+			return err
+		}
+		return resumeHint(err, state, "create_layer")
+	}
+	if tx.plan != nil {
+		return tx.planCommit(ctx, manifest.GitMode)
 	}
 
-	if err := gitutil.Clone(ctx, repo.URL, branch, targetDir, repo.Protocol, repo.AuthPrompt, cloneOpts...); err != nil {
+	if err := tx.commit(); err != nil {
 		return err
 	}
+	return stageProjectRepo(ctx, manifest.GitMode, root, tx.target)
+}
+
+// openWorkspace returns the current directory as an initialized workspace root
+// together with its manifest.
+func openWorkspace() (string, *workspaceManifest, error) {
+	root, err := os.Getwd()
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to determine current working directory: %w", err)
+	}
+	if err := checkInitialized(root); err != nil {
+		return "", nil, err
+	}
+	manifest, err := loadManifest(root)
+	if err != nil {
+		return "", nil, err
+	}
+	return root, manifest, nil
+}
+
+// updateWorkspaceFiles records the scaffold in couchfusion.lock and syncs the
+// package workspace files, restoring their previous content on rollback. A dry
+// run updates copies of them for its plan instead.
+func updateWorkspaceFiles(ctx context.Context, tx *scaffoldTx, root, key string, revision templateRevision, packageManager string) error {
+	paths := workspaceFileNames(packageManager)
+	if tx.plan != nil {
+		return planRootFiles(ctx, tx.plan, root, func(shadow string) error {
+			if err := recordRevision(shadow, key, revision); err != nil {
+				return err
+			}
+			return syncPackageWorkspaces(shadow, packageManager)
+		}, paths...)
+	}
+	for _, name := range paths {
+		if err := tx.preserveFile(filepath.Join(root, name)); err != nil {
+			return err
+		}
+	}
 
-	if err := reinitializeGitRepo(ctx, targetDir); err != nil {
+	if err := recordRevision(root, key, revision); err != nil {
 		return err
 	}
+	return syncPackageWorkspaces(root, packageManager)
+}
 
-	return nil
+// workspaceFileNames lists the root files scaffolds update: the lock and the
+// package workspace files of packageManager.
+func workspaceFileNames(packageManager string) []string {
+	paths := []string{lockFileName}
+	if packageManager != "" {
+		paths = append(paths, rootPackageFileName)
+		if packageManager == "pnpm" {
+			paths = append(paths, pnpmWorkspaceFileName)
+		}
+	}
+	return paths
 }
 
 // ResolveLayerName ensures layer name is collected when missing.
@@ -212,6 +490,11 @@ func ResolveLayerName(provided string) (string, error) {
 	return name, nil
 }
 
+// repoCloneOptions adds the clone options implied by repo's configuration.
+func repoCloneOptions(repo config.RepoConfig, opts []gitutil.CloneOption) []gitutil.CloneOption {
+	return append(append([]gitutil.CloneOption{}, opts...), gitutil.WithCredentialStore(repo.CredentialStore))
+}
+
 func ensureDir(path string) error {
 	if _, err := os.Stat(path); err == nil {
 		// already exists
@@ -275,20 +558,43 @@ func checkInitialized(root string) error {
 	return nil
 }
 
-func writeAppMetadata(targetDir, appName string, modules []string) error {
-	meta := map[string]any{
-		"appName":     appName,
-		"modules":     modules,
-		"generatedAt": time.Now().UTC().Format(time.RFC3339),
-		"cliVersion":  version(),
+// checkLayersPresent fails when a workspace created with a layer selection lacks
+// one of the requested modules.
+func checkLayersPresent(root string, modules []string) error {
+	manifest, err := loadManifest(root)
+	if err != nil {
+		return err
+	}
+	for _, module := range modules {
+		if manifest.Layers.includes(module) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, "layers", module)); err == nil {
+			// Layers created with create_layer live outside the base selection.
+			continue
+		}
+		return fmt.Errorf("layer '%s' is not present in this workspace (run `couchfusion layers add %s`)", module, module)
 	}
+	return nil
+}
 
-	metaPath := filepath.Join(targetDir, "couchfusion.json")
-	data, err := json.MarshalIndent(meta, "", "  ")
+// writeAppMetadata writes the couchfusion.json of the app scaffolded by state.
+func writeAppMetadata(root, targetDir string, state *runState) error {
+	layers, err := layerRevisions(root, state.Modules)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(metaPath, data, 0o644)
+	meta := newAppMetadata(state.Name, state.Modules, *state.Revision)
+	meta.setModules(state.Modules, layers)
+	meta.setParameters(state.Parameters)
+	meta.addDatabases(state.Databases)
+
+	detail := "modules: " + valueOr(strings.Join(state.Modules, ", "), "none")
+	if state.Source != "" {
+		detail = "from " + state.Source + ", " + detail
+	}
+	meta.record(state.Command, detail)
+	return meta.save(targetDir)
 }
 
 func writeModuleSetup(targetDir string, cfg *config.Config, modules []string) error {
@@ -399,7 +705,9 @@ func EnsureCurrentWorkspace() error {
 	return checkInitialized(root)
 }
 
-func updateLayerDependencies(targetDir string, modules []string) error {
+// updateLayerDependencies adds an @my/<module> dependency per module, using the
+// spec that matches the workspace's package manager (see layerDependencySpec).
+func updateLayerDependencies(targetDir string, modules []string, manager string) error {
 	if len(modules) == 0 {
 		return nil
 	}
@@ -432,8 +740,7 @@ func updateLayerDependencies(targetDir string, modules []string) error {
 		}
 		seen[module] = struct{}{}
 
-		depName := fmt.Sprintf("@my/%s", module)
-		deps[depName] = fmt.Sprintf("link:../../layers/%s", module)
+		deps[layerPackageName(module)] = layerDependencySpec(manager, module)
 	}
 
 	pkg["dependencies"] = deps
@@ -546,20 +853,81 @@ func resolvePath(path string) (string, error) {
 	return filepath.Clean(filepath.Join(cwd, path)), nil
 }
 
-func reinitializeGitRepo(ctx context.Context, targetDir string) error {
+// reinitializeGitRepo replaces the starter's history in targetDir with a fresh
+// repository; see initProjectRepo.
+func reinitializeGitRepo(ctx context.Context, settings config.GitScaffoldConfig, targetDir, name string) error {
 	gitDir := filepath.Join(targetDir, ".git")
 	if err := os.RemoveAll(gitDir); err != nil {
 		return fmt.Errorf("failed to remove git history in %s: %w", targetDir, err)
 	}
+	return initProjectRepo(ctx, settings, targetDir, name)
+}
+
+// initProjectRepo runs git init in targetDir on the configured default branch,
+// makes sure .env is ignored and adds the templated origin remote for project name.
+func initProjectRepo(ctx context.Context, settings config.GitScaffoldConfig, targetDir, name string) error {
+	args := []string{"init", "--quiet"}
+	if branch := strings.TrimSpace(settings.DefaultBranch); branch != "" {
+		args = append(args, "--initial-branch="+branch)
+	}
+	if _, err := gitutil.Run(ctx, targetDir, args...); err != nil {
+		return fmt.Errorf("failed to initialize git repository in %s: %w", targetDir, err)
+	}
 
-	cmd := exec.CommandContext(ctx, "git", "init")
-	cmd.Dir = targetDir
-	cmd.Stdout = io.Discard
-	cmd.Stderr = io.Discard
+	if err := ensureEnvIgnored(ctx, targetDir); err != nil {
+		return err
+	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to reinitialize git repository in %s: %w", targetDir, err)
+	if remote := settings.RemoteURL(name); remote != "" {
+		if _, err := gitutil.Run(ctx, targetDir, "remote", "add", "origin", remote); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureEnvIgnored appends .env to the project's .gitignore unless git already
+// ignores it; the auth layer writes CouchDB secrets there.
+func ensureEnvIgnored(ctx context.Context, targetDir string) error {
+	// check-ignore exits 0 when the path is ignored and 1 when it is not.
+	if _, err := gitutil.Run(ctx, targetDir, "check-ignore", "--quiet", "--no-index", ".env"); err == nil {
+		return nil
 	}
 
+	path := filepath.Join(targetDir, ".gitignore")
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	content := string(existing)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += "# Local secrets written by couchfusion\n.env\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// commitScaffold records every file in targetDir as the initial commit when
+// git.scaffold.initialCommit is enabled.
+func commitScaffold(ctx context.Context, settings config.GitScaffoldConfig, targetDir string) error {
+	if !settings.InitialCommit {
+		return nil
+	}
+	// The run state of a scaffold in progress never belongs to the project.
+	if _, err := gitutil.Run(ctx, targetDir, "add", "--all", "--", ".", ":(exclude)"+stateDirName+"/"+stateFileName); err != nil {
+		return err
+	}
+
+	args := []string{}
+	if settings.AuthorName != "" {
+		args = append(args, "-c", "user.name="+settings.AuthorName, "-c", "user.email="+settings.AuthorEmail)
+	}
+	args = append(args, "commit", "--quiet", "--allow-empty", "-m", settings.ResolveCommitMessage())
+	if _, err := gitutil.Run(ctx, targetDir, args...); err != nil {
+		return fmt.Errorf("failed to create initial commit in %s: %w", targetDir, err)
+	}
 	return nil
 }
@@ -6,35 +6,95 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/nuxt-apps/couchfusion/internal/checks"
 	"github.com/nuxt-apps/couchfusion/internal/config"
+	"github.com/nuxt-apps/couchfusion/internal/gitutil"
 	"github.com/nuxt-apps/couchfusion/internal/logging"
 	"github.com/nuxt-apps/couchfusion/internal/workspace"
 )
 
 const version = "0.4.2"
 
+// globalDryRun is set by a --dry-run given before the command; it is the
+// default of every command's own --dry-run flag.
+var globalDryRun bool
+
+// globalOverrides collects the --set key=value flags given before the command;
+// they are the last configuration layer.
+var globalOverrides []string
+
+// globalProfile is the config profile selected by a --profile given before the
+// command.
+var globalProfile string
+
 func main() {
-	if len(os.Args) < 2 {
+	if gitutil.HandleAskPass() {
+		return
+	}
+
+	args := os.Args[1:]
+	for len(args) > 0 {
+		switch {
+		case args[0] == "--dry-run" || args[0] == "-dry-run":
+			globalDryRun = true
+			args = args[1:]
+			continue
+		case (args[0] == "--set" || args[0] == "-set") && len(args) > 1:
+			globalOverrides = append(globalOverrides, args[1])
+			args = args[2:]
+			continue
+		case strings.HasPrefix(args[0], "--set="):
+			globalOverrides = append(globalOverrides, strings.TrimPrefix(args[0], "--set="))
+			args = args[1:]
+			continue
+		case (args[0] == "--profile" || args[0] == "-profile") && len(args) > 1:
+			globalProfile = args[1]
+			args = args[2:]
+			continue
+		case strings.HasPrefix(args[0], "--profile="):
+			globalProfile = strings.TrimPrefix(args[0], "--profile=")
+			args = args[1:]
+			continue
+		}
+		break
+	}
+
+	if len(args) < 1 {
 		printUsage()
 		os.Exit(1)
 	}
 
-	command := os.Args[1]
+	command := args[0]
 
 	switch command {
 	case "version", "--version", "-v":
 		fmt.Println(version)
 		return
 	case "init":
-		runInit(os.Args[2:])
+		runInit(args[1:])
 	case "new":
-		runNew(os.Args[2:])
+		runNew(args[1:])
 	case "create_layer":
-		runCreateLayer(os.Args[2:])
+		runCreateLayer(args[1:])
+	case "dev":
+		runDev(args[1:])
+	case "cache":
+		runCache(args[1:])
+	case "upgrade":
+		runUpgrade(args[1:])
+	case "layers":
+		runLayers(args[1:])
+	case "apply":
+		runApply(args[1:])
+	case "verify":
+		runVerify(args[1:])
+	case "config":
+		runConfig(args[1:])
 	default:
 		logging.Errorf("unknown command: %s", command)
 		printUsage()
@@ -45,26 +105,44 @@ func main() {
 func printUsage() {
 	fmt.Println("couchfusion " + version)
 	fmt.Println("Usage:")
-	fmt.Println("  couchfusion init [--config path] [--path dir] [--layers-branch name] [--force]")
-	fmt.Println("  couchfusion new [--config path] [--name app] [--modules m1,m2] [--branch name] [--force]")
-	fmt.Println("  couchfusion create_layer [--config path] [--name layer] [--branch name] [--force]")
+	fmt.Println("  couchfusion [--dry-run] [--profile name] [--set key=value]... <command> [flags]")
+	fmt.Println("  couchfusion init [--config path] [--path dir] [--layers-branch name] [--layers-mode snapshot|remote|subtree] [--git-mode per-project|monorepo] [--package-workspaces bun|npm|pnpm|none] [--layers l1,l2] [--force] [--offline] [--dry-run]")
+	fmt.Println("  couchfusion new [--config path] [--name app] [--modules m1,m2 | --from app-dir|couchfusion.json] [--branch name] [--force] [--offline] [--resume] [--timings] [--dry-run]")
+	fmt.Println("  couchfusion create_layer [--config path] [--name layer] [--branch name] [--force] [--offline] [--resume] [--timings] [--dry-run]")
+	fmt.Println("  couchfusion upgrade [--config path] [--ref ref] [--dry-run] [--offline] <app>")
+	fmt.Println("  couchfusion layers update [--config path] [--ref ref] [--dry-run] [--offline] [layer...]")
+	fmt.Println("  couchfusion layers add [--config path] [--offline] [--dry-run] <layer>...")
+	fmt.Println("  couchfusion apply [--config path] [-f workspace.yaml] [--offline] [--dry-run]")
+	fmt.Println("  couchfusion verify [--config path] [--fix] [--offline] [--dry-run] [app...]")
+	fmt.Println("  couchfusion dev [--port 3000] [--layers l1,l2] [--command \"bun run dev\"] [--max-restarts n] [--dry-run] [app...]")
+	fmt.Println("  couchfusion cache list|update|prune [--config path] [--all] [--older-than 720h] [--dry-run]")
+	fmt.Println("  couchfusion config init [--config path] [--force]")
+	fmt.Println("  couchfusion config show [--config path] [--origin]")
+	fmt.Println("  couchfusion config validate [--config path]")
+	fmt.Println("  couchfusion config schema")
+	fmt.Println("  couchfusion config profiles [--config path]")
+	fmt.Println("  couchfusion config profiles use [--config path] [--dry-run] <name>|--none")
+	fmt.Println("  couchfusion config get [--config path] <key>")
+	fmt.Println("  couchfusion config set [--config path] [--workspace] [--dry-run] <key> <value>")
+	fmt.Println("  couchfusion config modules add [--config path] [--workspace] [--description text] [--extends layer] [--dry-run] <name>")
+	fmt.Println("  couchfusion config modules remove [--config path] [--workspace] [--dry-run] <name>")
 }
 
 func runInit(args []string) {
 	fs := flag.NewFlagSet("init", flag.ExitOnError)
 	configPath := fs.String("config", "", "Path to config file")
 	targetPath := fs.String("path", ".", "Target directory to initialize")
-	layerBranch := fs.String("layers-branch", "", "Override branch for layers clone")
+	layerBranch := fs.String("layers-branch", "", "Override branch, tag or commit SHA for the layers clone")
+	layersMode := fs.String("layers-mode", "", "How layers track upstream: snapshot, remote or subtree (defaults to workspace.layersMode)")
+	gitMode := fs.String("git-mode", "", "Git repository layout: per-project or monorepo (defaults to workspace.gitMode)")
+	packageWorkspaces := fs.String("package-workspaces", "", "Root package workspace over apps and layers: bun, npm, pnpm or none (defaults to workspace.packageWorkspaces)")
+	layers := fs.String("layers", "", "Comma-separated base layers to materialize (defaults to all)")
 	force := fs.Bool("force", false, "Allow reinitialization when directories exist")
+	offline := fs.Bool("offline", false, "Clone from the local repository cache without network access")
+	dryRun := dryRunFlag(fs)
 	_ = fs.Parse(args)
 
-	cfg, usedDefaultConfig, err := config.Load(*configPath)
-	if err != nil {
-		logging.Fatalf("failed to load config: %v", err)
-	}
-	if usedDefaultConfig {
-		logging.Warnf("No ~/.couchfusion/config.yaml found; using embedded default configuration.")
-	}
+	cfg := loadConfigOrExit(*configPath)
 
 	ctx := context.Background()
 	warnings := checks.Run(ctx)
@@ -72,8 +150,17 @@ func runInit(args []string) {
 		logging.Warnf(w)
 	}
 
+	if *dryRun {
+		plan, err := workspace.PlanInit(ctx, cfg, *targetPath, *layerBranch, *layersMode, *gitMode, *packageWorkspaces, splitList(*layers), *force, dryRunCloneOptions(*offline, true)...)
+		if err != nil {
+			logging.Fatalf("init failed: %v", err)
+		}
+		plan.Write(os.Stdout)
+		return
+	}
+
 	if workspace.ShouldUseTUI() {
-		target, err := workspace.RunInitTUI(ctx, cfg, *targetPath, *layerBranch, *force)
+		target, err := workspace.RunInitTUI(ctx, cfg, *targetPath, *layerBranch, *layersMode, *gitMode, *packageWorkspaces, splitList(*layers), *force, cacheCloneOptions(*offline)...)
 		if err != nil {
 			if errors.Is(err, workspace.ErrAborted) {
 				logging.Warnf("init cancelled by user")
@@ -85,7 +172,7 @@ func runInit(args []string) {
 		return
 	}
 
-	if err := workspace.RunInit(ctx, cfg, *targetPath, *layerBranch, *force); err != nil {
+	if err := workspace.RunInit(ctx, cfg, *targetPath, *layerBranch, *layersMode, *gitMode, *packageWorkspaces, splitList(*layers), *force, cacheCloneOptions(*offline)...); err != nil {
 		logging.Fatalf("init failed: %v", err)
 	}
 
@@ -97,25 +184,33 @@ func runNew(args []string) {
 	configPath := fs.String("config", "", "Path to config file")
 	name := fs.String("name", "", "Name of the new app")
 	modules := fs.String("modules", "", "Comma-separated module list")
-	branch := fs.String("branch", "", "Override starter branch")
+	from := fs.String("from", "", "Recreate the app described by this couchfusion.json or app directory")
+	branch := fs.String("branch", "", "Override starter branch, tag or commit SHA")
 	force := fs.Bool("force", false, "Allow overwriting empty existing directories")
+	offline := fs.Bool("offline", false, "Clone from the local repository cache without network access")
+	resume := fs.Bool("resume", false, "Continue the unfinished run of the app from its failed step")
+	timings := fs.Bool("timings", false, "Print how long each scaffolding step took")
+	dryRun := dryRunFlag(fs)
 	_ = fs.Parse(args)
 
 	if *name == "" && len(fs.Args()) > 0 {
 		*name = fs.Args()[0]
 	}
+	if *dryRun && *resume {
+		logging.Fatalf("input error: --dry-run cannot be combined with --resume")
+	}
+	if *from != "" && *modules != "" {
+		logging.Fatalf("input error: --from takes the modules of its source app; drop --modules")
+	}
+	if *from != "" && *resume {
+		logging.Fatalf("input error: --from cannot be combined with --resume")
+	}
 
 	if err := workspace.EnsureCurrentWorkspace(); err != nil {
 		logging.Fatalf("workspace validation failed: %v", err)
 	}
 
-	cfg, usedDefaultConfig, err := config.Load(*configPath)
-	if err != nil {
-		logging.Fatalf("failed to load config: %v", err)
-	}
-	if usedDefaultConfig {
-		logging.Warnf("No ~/.couchfusion/config.yaml found; using embedded default configuration.")
-	}
+	cfg := loadConfigOrExit(*configPath)
 
 	ctx := context.Background()
 	warnings := checks.Run(ctx)
@@ -123,8 +218,63 @@ func runNew(args []string) {
 		logging.Warnf(w)
 	}
 
+	timer := &workspace.StepTimer{}
+	if *timings {
+		ctx = workspace.WithStepObserver(ctx, timer.Observe)
+	}
+
+	if *resume {
+		appName, selectedModules, err := workspace.ResumeNew(ctx, cfg, strings.TrimSpace(*name), *force, cacheCloneOptions(*offline)...)
+		printTimings(*timings, timer)
+		if err != nil {
+			logging.Fatalf("new failed: %v", err)
+		}
+		logging.Infof("App '%s' created with modules: %s", appName, strings.Join(selectedModules, ", "))
+		return
+	}
+
+	if *from != "" {
+		appName, err := workspace.ResolveAppName(*name)
+		if err != nil {
+			logging.Fatalf("input error: %v", err)
+		}
+		source, err := workspace.LoadAppSource(*from)
+		if err != nil {
+			logging.Fatalf("input error: %v", err)
+		}
+		if *dryRun {
+			plan, err := workspace.PlanNewFrom(ctx, cfg, source, appName, *branch, *force, dryRunCloneOptions(*offline, true)...)
+			if err != nil {
+				logging.Fatalf("new failed: %v", err)
+			}
+			plan.Write(os.Stdout)
+			return
+		}
+		logging.Infof("Recreating '%s' from %s (%s)", source.Name, source.Path, source.Starter())
+		err = workspace.RunNewFrom(ctx, cfg, source, appName, *branch, *force, cacheCloneOptions(*offline)...)
+		printTimings(*timings, timer)
+		if err != nil {
+			logging.Fatalf("new failed: %v", err)
+		}
+		logging.Infof("App '%s' created from %s with modules: %s", appName, source.Path, strings.Join(source.Modules, ", "))
+		return
+	}
+
+	if *dryRun {
+		appName, selectedModules, err := workspace.ResolveAppCreationInputs(cfg, *name, *modules)
+		if err != nil {
+			logging.Fatalf("input error: %v", err)
+		}
+		plan, err := workspace.PlanNew(ctx, cfg, appName, selectedModules, *branch, *force, dryRunCloneOptions(*offline, true)...)
+		if err != nil {
+			logging.Fatalf("new failed: %v", err)
+		}
+		plan.Write(os.Stdout)
+		return
+	}
+
 	if workspace.ShouldUseTUI() {
-		appName, selectedModules, err := workspace.RunNewTUI(ctx, cfg, *name, *modules, *branch, *force)
+		appName, selectedModules, err := workspace.RunNewTUI(ctx, cfg, *name, *modules, *branch, *force, cacheCloneOptions(*offline)...)
 		if err != nil {
 			if errors.Is(err, workspace.ErrAborted) {
 				logging.Warnf("new cancelled by user")
@@ -142,7 +292,9 @@ func runNew(args []string) {
 		logging.Fatalf("input error: %v", err)
 	}
 
-	if err := workspace.RunNew(ctx, cfg, appName, selectedModules, *branch, *force); err != nil {
+	err = workspace.RunNew(ctx, cfg, appName, selectedModules, *branch, *force, cacheCloneOptions(*offline)...)
+	printTimings(*timings, timer)
+	if err != nil {
 		logging.Fatalf("new failed: %v", err)
 	}
 
@@ -153,18 +305,23 @@ func runCreateLayer(args []string) {
 	fs := flag.NewFlagSet("create_layer", flag.ExitOnError)
 	configPath := fs.String("config", "", "Path to config file")
 	name := fs.String("name", "", "Name of the new layer")
-	branch := fs.String("branch", "", "Override starter branch")
+	branch := fs.String("branch", "", "Override starter branch, tag or commit SHA")
 	force := fs.Bool("force", false, "Allow overwriting empty existing directories")
+	offline := fs.Bool("offline", false, "Clone from the local repository cache without network access")
+	resume := fs.Bool("resume", false, "Continue the unfinished run of the layer from its failed step")
+	timings := fs.Bool("timings", false, "Print how long each scaffolding step took")
+	dryRun := dryRunFlag(fs)
 	_ = fs.Parse(args)
 
-	cfg, usedDefaultConfig, err := config.Load(*configPath)
-	if err != nil {
-		logging.Fatalf("failed to load config: %v", err)
+	if *name == "" && len(fs.Args()) > 0 {
+		*name = fs.Args()[0]
 	}
-	if usedDefaultConfig {
-		logging.Warnf("No ~/.couchfusion/config.yaml found; using embedded default configuration.")
+	if *dryRun && *resume {
+		logging.Fatalf("input error: --dry-run cannot be combined with --resume")
 	}
 
+	cfg := loadConfigOrExit(*configPath)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	defer cancel()
 
@@ -173,8 +330,36 @@ func runCreateLayer(args []string) {
 		logging.Warnf(w)
 	}
 
+	timer := &workspace.StepTimer{}
+	if *timings {
+		ctx = workspace.WithStepObserver(ctx, timer.Observe)
+	}
+
+	if *resume {
+		layerName, err := workspace.ResumeCreateLayer(ctx, cfg, strings.TrimSpace(*name), *force, cacheCloneOptions(*offline)...)
+		printTimings(*timings, timer)
+		if err != nil {
+			logging.Fatalf("create_layer failed: %v", err)
+		}
+		logging.Infof("Layer '%s' created.", layerName)
+		return
+	}
+
+	if *dryRun {
+		layerName, err := workspace.ResolveLayerName(*name)
+		if err != nil {
+			logging.Fatalf("input error: %v", err)
+		}
+		plan, err := workspace.PlanCreateLayer(ctx, cfg, layerName, *branch, *force, dryRunCloneOptions(*offline, true)...)
+		if err != nil {
+			logging.Fatalf("create_layer failed: %v", err)
+		}
+		plan.Write(os.Stdout)
+		return
+	}
+
 	if workspace.ShouldUseTUI() {
-		layerName, err := workspace.RunCreateLayerTUI(ctx, cfg, *name, *branch, *force)
+		layerName, err := workspace.RunCreateLayerTUI(ctx, cfg, *name, *branch, *force, cacheCloneOptions(*offline)...)
 		if err != nil {
 			if errors.Is(err, workspace.ErrAborted) {
 				logging.Warnf("create_layer cancelled by user")
@@ -191,13 +376,580 @@ func runCreateLayer(args []string) {
 		logging.Fatalf("input error: %v", err)
 	}
 
-	if err := workspace.RunCreateLayer(ctx, cfg, layerName, *branch, *force); err != nil {
+	err = workspace.RunCreateLayer(ctx, cfg, layerName, *branch, *force, cacheCloneOptions(*offline)...)
+	printTimings(*timings, timer)
+	if err != nil {
 		logging.Fatalf("create_layer failed: %v", err)
 	}
 
 	logging.Infof("Layer '%s' created.", layerName)
 }
 
+func runUpgrade(args []string) {
+	fs := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	ref := fs.String("ref", "", "Starter branch, tag or commit SHA to upgrade to (defaults to the configured ref)")
+	dryRun := dryRunFlag(fs)
+	offline := fs.Bool("offline", false, "Fetch starter revisions from the local repository cache only")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		logging.Fatalf("input error: upgrade requires exactly one app name")
+	}
+	appName := fs.Arg(0)
+
+	if err := workspace.EnsureCurrentWorkspace(); err != nil {
+		logging.Fatalf("workspace validation failed: %v", err)
+	}
+	cfg := loadConfigOrExit(*configPath)
+
+	ctx := context.Background()
+	opts := append(dryRunCloneOptions(*offline, *dryRun), gitutil.WithLogger(logging.Infof))
+	report, err := workspace.RunUpgrade(ctx, cfg, appName, *ref, *dryRun, opts...)
+	if err != nil {
+		logging.Fatalf("upgrade failed: %v", err)
+	}
+
+	report.WriteSummary(os.Stdout, *dryRun)
+	if report.HasConflicts() {
+		logging.Warnf("Resolve the conflicts above, then review and commit the result.")
+		os.Exit(2)
+	}
+}
+
+func runLayers(args []string) {
+	if len(args) == 0 {
+		logging.Errorf("layers requires a subcommand: update or add")
+		printUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "update":
+		runLayersUpdate(args[1:])
+	case "add":
+		runLayersAdd(args[1:])
+	default:
+		logging.Errorf("unknown layers subcommand: %s", args[0])
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func runLayersUpdate(args []string) {
+	fs := flag.NewFlagSet("layers update", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	ref := fs.String("ref", "", "Layers branch, tag or commit SHA to update to (defaults to the configured ref)")
+	dryRun := dryRunFlag(fs)
+	offline := fs.Bool("offline", false, "Fetch layer revisions from the local repository cache only")
+	_ = fs.Parse(args)
+
+	if err := workspace.EnsureCurrentWorkspace(); err != nil {
+		logging.Fatalf("workspace validation failed: %v", err)
+	}
+	cfg := loadConfigOrExit(*configPath)
+
+	ctx := context.Background()
+	opts := append(dryRunCloneOptions(*offline, *dryRun), gitutil.WithLogger(logging.Infof))
+	updates, err := workspace.RunLayersUpdate(ctx, cfg, *ref, fs.Args(), *dryRun, opts...)
+	if err != nil {
+		logging.Fatalf("layers update failed: %v", err)
+	}
+
+	workspace.WriteLayerUpdates(os.Stdout, updates, *dryRun)
+	if workspace.LayerUpdatesHaveConflicts(updates) {
+		logging.Warnf("Resolve the conflicts above, then review and commit the result.")
+		os.Exit(2)
+	}
+}
+
+func runLayersAdd(args []string) {
+	fs := flag.NewFlagSet("layers add", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	offline := fs.Bool("offline", false, "Fetch the base revision from the local repository cache only")
+	dryRun := dryRunFlag(fs)
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		logging.Fatalf("input error: layers add requires at least one layer name")
+	}
+	if err := workspace.EnsureCurrentWorkspace(); err != nil {
+		logging.Fatalf("workspace validation failed: %v", err)
+	}
+	cfg := loadConfigOrExit(*configPath)
+
+	ctx := context.Background()
+	if *dryRun {
+		plan, err := workspace.PlanLayersAdd(ctx, fs.Args())
+		if err != nil {
+			logging.Fatalf("layers add failed: %v", err)
+		}
+		plan.Write(os.Stdout)
+		return
+	}
+	opts := append(cacheCloneOptions(*offline), gitutil.WithLogger(logging.Infof))
+	if err := workspace.RunLayersAdd(ctx, cfg, fs.Args(), opts...); err != nil {
+		logging.Fatalf("layers add failed: %v", err)
+	}
+	logging.Infof("Added layers: %s", strings.Join(fs.Args(), ", "))
+}
+
+func runApply(args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	var specPath string
+	fs.StringVar(&specPath, "f", "workspace.yaml", "Workspace spec to converge on")
+	fs.StringVar(&specPath, "file", "workspace.yaml", "Workspace spec to converge on")
+	offline := fs.Bool("offline", false, "Clone from the local repository cache without network access")
+	dryRun := dryRunFlag(fs)
+	_ = fs.Parse(args)
+
+	if err := workspace.EnsureCurrentWorkspace(); err != nil {
+		logging.Fatalf("workspace validation failed: %v", err)
+	}
+	cfg := loadConfigOrExit(*configPath)
+
+	ctx := context.Background()
+	warnings := checks.Run(ctx)
+	for _, w := range warnings {
+		logging.Warnf(w)
+	}
+
+	// A failed apply keeps the changes made before the failure; running it
+	// again converges the rest.
+	report, err := workspace.RunApply(ctx, cfg, specPath, *dryRun, dryRunCloneOptions(*offline, *dryRun)...)
+	if err != nil {
+		logging.Fatalf("apply failed: %v", err)
+	}
+	report.Write(os.Stdout, *dryRun)
+	if report.HasDrift() {
+		logging.Warnf("The workspace has drifted from %s; see the entries marked with !.", specPath)
+	}
+}
+
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	fix := fs.Bool("fix", false, "Reconcile package.json, nuxt.config.ts, .env and layers/ with couchfusion.json")
+	offline := fs.Bool("offline", false, "Clone from the local repository cache without network access")
+	dryRun := dryRunFlag(fs)
+	_ = fs.Parse(args)
+
+	if err := workspace.EnsureCurrentWorkspace(); err != nil {
+		logging.Fatalf("workspace validation failed: %v", err)
+	}
+	cfg := loadConfigOrExit(*configPath)
+
+	// --dry-run only reports, which is what verify does without --fix.
+	report, err := workspace.RunVerify(context.Background(), cfg, fs.Args(), *fix && !*dryRun, cacheCloneOptions(*offline)...)
+	if err != nil {
+		logging.Fatalf("verify failed: %v", err)
+	}
+	report.Write(os.Stdout)
+	if report.HasIssues() {
+		logging.Errorf("Apps differ from their couchfusion.json; see the entries marked with !.")
+		os.Exit(1)
+	}
+}
+
+func runConfig(args []string) {
+	if len(args) == 0 {
+		logging.Errorf("config requires a subcommand: init, show, validate, schema, get, set, modules or profiles")
+		printUsage()
+		os.Exit(1)
+	}
+
+	sub := args[0]
+	switch sub {
+	case "modules":
+		runConfigModules(args[1:])
+		return
+	case "profiles":
+		runConfigProfiles(args[1:])
+		return
+	}
+	fs := flag.NewFlagSet("config "+sub, flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	origin := fs.Bool("origin", false, "List every value with the source that set it (show only)")
+	force := fs.Bool("force", false, "Replace an existing config file (init only)")
+	inWorkspace := fs.Bool("workspace", false, "Edit the nearest .couchfusion.yaml instead of the user file (set only)")
+	dryRun := dryRunFlag(fs)
+	_ = fs.Parse(args[1:])
+	opts := configOptions(*configPath)
+
+	switch sub {
+	case "init":
+		if *dryRun {
+			logging.Infof("Would write the default configuration to %s", configFileOrDefault(*configPath))
+			return
+		}
+		path, err := config.InitFile(*configPath, *force)
+		if err != nil {
+			logging.Fatalf("config init failed: %v", err)
+		}
+		logging.Infof("Wrote the default configuration to %s", path)
+	case "show":
+		cfg := loadConfigOrExit(*configPath)
+		if err := cfg.Write(os.Stdout, *origin); err != nil {
+			logging.Fatalf("config show failed: %v", err)
+		}
+	case "schema":
+		if err := config.WriteSchema(os.Stdout); err != nil {
+			logging.Fatalf("config schema failed: %v", err)
+		}
+	case "validate":
+		problems, err := config.Validate(opts)
+		if err != nil {
+			logging.Fatalf("config validate failed: %v", err)
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			logging.Errorf("Found %d configuration problems.", len(problems))
+			os.Exit(1)
+		}
+		logging.Infof("Configuration is valid.")
+	case "get":
+		if fs.NArg() != 1 {
+			logging.Fatalf("input error: config get takes one key, e.g. repos.new.branch")
+		}
+		cfg := loadConfigOrExit(*configPath)
+		value, err := cfg.Get(fs.Arg(0))
+		if err != nil {
+			logging.Fatalf("config get failed: %v", err)
+		}
+		fmt.Println(value)
+	case "set":
+		if fs.NArg() != 2 {
+			logging.Fatalf("input error: config set takes a key and a value, e.g. repos.new.branch develop")
+		}
+		edit := config.Edit{Options: opts, Workspace: *inWorkspace, DryRun: *dryRun}
+		path, err := edit.Set(fs.Arg(0), fs.Arg(1))
+		if err != nil {
+			logging.Fatalf("config set failed: %v", err)
+		}
+		logConfigEdit(path, *dryRun, "Set %s = %s", fs.Arg(0), fs.Arg(1))
+	default:
+		logging.Errorf("unknown config subcommand: %s", sub)
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func runConfigModules(args []string) {
+	if len(args) == 0 || (args[0] != "add" && args[0] != "remove") {
+		logging.Errorf("config modules requires a subcommand: add or remove")
+		printUsage()
+		os.Exit(1)
+	}
+
+	sub := args[0]
+	fs := flag.NewFlagSet("config modules "+sub, flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	description := fs.String("description", "", "Module description shown by new (add only)")
+	extends := fs.String("extends", "", "Layer the module extends (add only, defaults to @layers/<name>)")
+	inWorkspace := fs.Bool("workspace", false, "Edit the nearest .couchfusion.yaml instead of the user file")
+	dryRun := dryRunFlag(fs)
+	_ = fs.Parse(args[1:])
+
+	if fs.NArg() != 1 {
+		logging.Fatalf("input error: config modules %s takes one module name", sub)
+	}
+	name := fs.Arg(0)
+	edit := config.Edit{
+		Options:   configOptions(*configPath),
+		Workspace: *inWorkspace,
+		DryRun:    *dryRun,
+	}
+
+	if sub == "add" {
+		module := config.ModuleConfig{Description: *description, Extends: *extends}
+		if strings.TrimSpace(module.Extends) == "" {
+			module.Extends = "@layers/" + name
+		}
+		path, err := edit.AddModule(name, module)
+		if err != nil {
+			logging.Fatalf("config modules add failed: %v", err)
+		}
+		logConfigEdit(path, *dryRun, "Added module '%s' extending %s", name, module.Extends)
+		return
+	}
+
+	path, err := edit.RemoveModule(name)
+	if err != nil {
+		logging.Fatalf("config modules remove failed: %v", err)
+	}
+	logConfigEdit(path, *dryRun, "Removed module '%s'", name)
+}
+
+func runConfigProfiles(args []string) {
+	use := len(args) > 0 && args[0] == "use"
+	if use {
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet("config profiles", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	none := fs.Bool("none", false, "Clear the profile recorded by the workspace (use only)")
+	dryRun := dryRunFlag(fs)
+	_ = fs.Parse(args)
+	opts := configOptions(*configPath)
+
+	if !use {
+		profiles, err := config.ListProfiles(opts)
+		if err != nil {
+			logging.Fatalf("config profiles failed: %v", err)
+		}
+		if len(profiles) == 0 {
+			logging.Infof("No profiles defined; add them under profiles in the user file or as ~/.couchfusion/%s/<name>.yaml.", config.ProfilesDirName)
+			return
+		}
+		for _, profile := range profiles {
+			marker := " "
+			if profile.Active {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\t%s\n", marker, profile.Name, strings.Join(profile.Sources, ", "))
+		}
+		return
+	}
+
+	if (fs.NArg() == 1) == *none {
+		logging.Fatalf("input error: config profiles use takes one profile name or --none")
+	}
+	name := fs.Arg(0)
+	if name != "" {
+		// Load the profile to reject unknown or invalid ones before recording it.
+		opts.Profile = name
+		if _, _, err := config.LoadLayers(opts); err != nil {
+			logging.Fatalf("config profiles use failed: %v", err)
+		}
+	}
+	if *dryRun {
+		if name == "" {
+			logging.Infof("Would clear the profile recorded by this workspace")
+		} else {
+			logging.Infof("Would record profile %s for this workspace", name)
+		}
+		return
+	}
+	manifest, err := workspace.RecordProfile(name)
+	if err != nil {
+		logging.Fatalf("config profiles use failed: %v", err)
+	}
+	if name == "" {
+		logging.Infof("Cleared the profile recorded in %s", manifest)
+		return
+	}
+	logging.Infof("Recorded profile %s in %s", name, manifest)
+}
+
+// logConfigEdit reports a config edit and the file it was written to.
+func logConfigEdit(path string, dryRun bool, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if dryRun {
+		logging.Infof("Would update %s: %s", path, message)
+		return
+	}
+	logging.Infof("%s in %s", message, path)
+}
+
+// configFileOrDefault describes the user config file path selects.
+func configFileOrDefault(path string) string {
+	if strings.TrimSpace(path) != "" {
+		return path
+	}
+	return "~/.couchfusion/config.yaml"
+}
+
+func runDev(args []string) {
+	fs := flag.NewFlagSet("dev", flag.ExitOnError)
+	port := fs.Int("port", 3000, "First port to assign; each target gets the next free port")
+	layers := fs.String("layers", "", "Comma-separated layer playgrounds to run alongside apps")
+	command := fs.String("command", "bun run dev", "Dev server command run inside each project")
+	maxRestarts := fs.Int("max-restarts", 5, "Consecutive restarts before giving up on a crashing process (-1 for unlimited)")
+	dryRun := dryRunFlag(fs)
+	_ = fs.Parse(args)
+
+	if err := workspace.EnsureCurrentWorkspace(); err != nil {
+		logging.Fatalf("workspace validation failed: %v", err)
+	}
+
+	commandParts := strings.Fields(*command)
+	if len(commandParts) == 0 {
+		logging.Fatalf("input error: --command cannot be empty")
+	}
+
+	targets, err := workspace.ResolveDevTargets(fs.Args(), splitList(*layers), *port)
+	if err != nil {
+		logging.Fatalf("input error: %v", err)
+	}
+
+	if *dryRun {
+		for _, t := range targets {
+			logging.Infof("Would run %q in %s with PORT=%d -> http://localhost:%d", *command, t.Dir, t.Port, t.Port)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	warnings := checks.Run(ctx)
+	for _, w := range warnings {
+		logging.Warnf(w)
+	}
+
+	opts := workspace.DevOptions{Command: commandParts, MaxRestarts: *maxRestarts}
+
+	if workspace.ShouldUseTUI() {
+		if err := workspace.RunDevTUI(ctx, targets, opts); err != nil {
+			logging.Fatalf("dev failed: %v", err)
+		}
+		logging.Infof("All dev servers stopped.")
+		return
+	}
+
+	for _, t := range targets {
+		logging.Infof("%s -> http://localhost:%d", t.Label(), t.Port)
+	}
+	if err := workspace.RunDev(ctx, targets, opts, os.Stdout); err != nil {
+		logging.Fatalf("dev failed: %v", err)
+	}
+	logging.Infof("All dev servers stopped.")
+}
+
+func runCache(args []string) {
+	if len(args) == 0 {
+		logging.Errorf("cache requires a subcommand: list, update or prune")
+		printUsage()
+		os.Exit(1)
+	}
+
+	sub := args[0]
+	fs := flag.NewFlagSet("cache "+sub, flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	all := fs.Bool("all", false, "Remove every cached mirror (prune only)")
+	olderThan := fs.Duration("older-than", 0, "Also remove mirrors not refreshed within this duration, e.g. 720h (prune only)")
+	dryRun := dryRunFlag(fs)
+	_ = fs.Parse(args[1:])
+
+	cacheDir, err := gitutil.DefaultCacheDir()
+	if err != nil {
+		logging.Fatalf("cache unavailable: %v", err)
+	}
+	ctx := context.Background()
+
+	switch sub {
+	case "list":
+		if err := workspace.RunCacheList(ctx, cacheDir, os.Stdout); err != nil {
+			logging.Fatalf("cache list failed: %v", err)
+		}
+	case "update":
+		cfg := loadConfigOrExit(*configPath)
+		if err := workspace.RunCacheUpdate(ctx, cfg, cacheDir, *dryRun, gitutil.WithLogger(logging.Infof)); err != nil {
+			logging.Fatalf("cache update failed: %v", err)
+		}
+		if !*dryRun {
+			logging.Infof("Cache updated.")
+		}
+	case "prune":
+		cfg := loadConfigOrExit(*configPath)
+		removed, err := workspace.RunCachePrune(ctx, cfg, cacheDir, *all, *olderThan, *dryRun)
+		verb := "Removed"
+		if *dryRun {
+			verb = "Would remove"
+		}
+		for _, entry := range removed {
+			logging.Infof("%s cached mirror of %s (%s)", verb, entry.URL, entry.Key)
+		}
+		if err != nil {
+			logging.Fatalf("cache prune failed: %v", err)
+		}
+		if !*dryRun {
+			logging.Infof("Pruned %d cached mirror(s).", len(removed))
+		}
+	default:
+		logging.Errorf("unknown cache subcommand: %s", sub)
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+// dryRunFlag defines the --dry-run flag of a command, defaulting to the global
+// --dry-run.
+func dryRunFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("dry-run", globalDryRun, "Report what would change without changing anything")
+}
+
+// configOptions selects the config layers for the user file at path, the
+// global --set and --profile flags and the profile recorded by the current
+// workspace.
+func configOptions(path string) config.Options {
+	opts := config.Options{Path: path, Overrides: globalOverrides, Profile: globalProfile}
+	profile, manifest, err := workspace.RecordedProfile("")
+	if err != nil {
+		logging.Warnf("Ignoring the workspace profile: %v", err)
+	}
+	opts.RecordedProfile, opts.RecordedIn = profile, manifest
+	return opts
+}
+
+func loadConfigOrExit(path string) *config.Config {
+	cfg, usedDefaultConfig, err := config.LoadLayers(configOptions(path))
+	if err != nil {
+		logging.Fatalf("failed to load config: %v", err)
+	}
+	if usedDefaultConfig {
+		logging.Warnf("No ~/.couchfusion/config.yaml or %s found; using embedded default configuration.", config.WorkspaceFileName)
+	}
+	return cfg
+}
+
+// cacheCloneOptions routes clones through the local mirror cache when it is available.
+func cacheCloneOptions(offline bool) []gitutil.CloneOption {
+	cacheDir, err := gitutil.DefaultCacheDir()
+	if err != nil {
+		if offline {
+			logging.Fatalf("offline mode unavailable: %v", err)
+		}
+		logging.Warnf("Repository cache disabled: %v", err)
+		return nil
+	}
+	return []gitutil.CloneOption{gitutil.WithCache(cacheDir), gitutil.WithOffline(offline)}
+}
+
+// dryRunCloneOptions is cacheCloneOptions for --dry-run, which must not create
+// or refresh mirrors: online clones bypass the cache and offline ones read it.
+func dryRunCloneOptions(offline, dryRun bool) []gitutil.CloneOption {
+	opts := cacheCloneOptions(offline)
+	if dryRun {
+		opts = append(opts, gitutil.WithCacheReadOnly(true))
+	}
+	return opts
+}
+
+// printTimings logs the per-step timing report collected by timer when enabled.
+func printTimings(enabled bool, timer *workspace.StepTimer) {
+	if !enabled {
+		return
+	}
+	logging.Infof("Step timings:")
+	for _, line := range timer.Report() {
+		logging.Infof("  %s", line)
+	}
+}
+
+func splitList(input string) []string {
+	out := []string{}
+	for _, part := range strings.Split(input, ",") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
+
 func init() {
 	logging.SetVersion(version)
 	os.Setenv("COUCHFUSION_VERSION", version)